@@ -0,0 +1,95 @@
+// Command keys manages the JWT signing key file used by the API
+// (JWT_KEYS_FILE). Rotating adds a new active key while the previous ones
+// keep verifying the tokens they signed until those expire:
+//
+//	go run ./cmd/keys rotate -alg RS256
+//	go run ./cmd/keys list
+//	go run ./cmd/keys prune
+//
+// A running server picks up the changed file without a restart.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+)
+
+func main() {
+	_ = godotenv.Load()
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	defaultFile := os.Getenv("JWT_KEYS_FILE")
+	if defaultFile == "" {
+		defaultFile = "jwt_keys.json"
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	file := fs.String("file", defaultFile, "key file to manage")
+	alg := fs.String("alg", tokens.AlgRS256, "signing algorithm of the new key: HS256, RS256 or EdDSA")
+	fs.Parse(os.Args[2:])
+
+	switch os.Args[1] {
+	case "rotate":
+		keys, err := tokens.LoadKeySet(*file)
+		if errors.Is(err, os.ErrNotExist) {
+			keys, err = &tokens.KeySet{}, nil
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		key, err := keys.Rotate(*alg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := keys.Save(*file); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Added %s key %s and made it active\n", key.Algorithm, key.ID)
+
+	case "prune":
+		keys, err := tokens.LoadKeySet(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg := tokens.ConfigFromEnv()
+		removed := keys.Prune(time.Now(), cfg.TTL+cfg.Leeway)
+		if err := keys.Save(*file); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Removed %d retired key(s) %v\n", len(removed), removed)
+
+	case "list":
+		keys, err := tokens.LoadKeySet(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, k := range keys.Keys {
+			status := "verifying"
+			if k.ID == keys.Active {
+				status = "active"
+			} else if k.RetiredAt != nil {
+				status = "retired " + k.RetiredAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", k.ID, k.Algorithm, k.CreatedAt.Format(time.RFC3339), status)
+		}
+
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keys rotate|prune|list [-file path] [-alg HS256|RS256|EdDSA]")
+	os.Exit(2)
+}
@@ -0,0 +1,63 @@
+// Command lockout lets administrators inspect and lift login lockouts:
+//
+//	go run ./cmd/lockout list
+//	go run ./cmd/lockout unlock -email leon@gmail.com
+//	go run ./cmd/lockout unlock -ip 203.0.113.7
+//
+// It connects to the database selected by ENV, like the server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	email := fs.String("email", "", "account to unlock")
+	ip := fs.String("ip", "", "client IP address to unlock")
+	fs.Parse(os.Args[2:])
+
+	switch os.Args[1] {
+	case "list":
+		models.InitDB()
+		for _, t := range models.GetLockedLogins() {
+			fmt.Printf("%s\t%d failures\tlocked until %s\n", t.Key, t.Failures, t.LockedUntil.Format(time.RFC3339))
+		}
+
+	case "unlock":
+		var key string
+		switch {
+		case *email != "":
+			key = models.AccountThrottleKey(*email)
+		case *ip != "":
+			key = models.IPThrottleKey(*ip)
+		default:
+			usage()
+		}
+		models.InitDB()
+		if !models.ResetLoginFailures(key) {
+			log.Fatalf("%s has no failed login attempts", key)
+		}
+		fmt.Printf("Unlocked %s\n", key)
+
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: lockout list | lockout unlock -email address | -ip address")
+	os.Exit(2)
+}
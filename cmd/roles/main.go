@@ -0,0 +1,61 @@
+// Command roles assigns roles from the command line, e.g. to create the
+// first administrator before anyone can use the admin API:
+//
+//	go run ./cmd/roles assign -email leon@gmail.com -role admin
+//	go run ./cmd/roles list
+//
+// It connects to the database selected by ENV, like the server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	email := fs.String("email", "", "account to assign the role to")
+	role := fs.String("role", models.RoleAdmin, "role to assign")
+	fs.Parse(os.Args[2:])
+
+	switch os.Args[1] {
+	case "list":
+		models.InitDB()
+		for _, r := range models.GetRoles() {
+			fmt.Printf("%s\t%s\t%s\n", r.Name, strings.Join(r.Permissions, ","), r.Description)
+		}
+
+	case "assign":
+		if *email == "" {
+			usage()
+		}
+		models.InitDB()
+		user, found := models.GetUserByEmail(*email)
+		if !found {
+			log.Fatalf("No user with email %s", *email)
+		}
+		if _, found := models.SetUserRole(user.ID, *role); !found {
+			log.Fatalf("Unknown role %s", *role)
+		}
+		fmt.Printf("%s now has the %s role\n", user.Email, *role)
+
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: roles list | roles assign -email address [-role name]")
+	os.Exit(2)
+}
@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+	"gorm.io/gorm"
+)
+
+// adminUserResponse extends userResponse with the fields only administrators see.
+func adminUserResponse(user models.User) map[string]interface{} {
+	resp := userResponse(user)
+	resp["role"] = user.Role
+	resp["disabled_at"] = user.DisabledAt
+	resp["deleted_at"] = nil
+	if user.DeletedAt.Valid {
+		resp["deleted_at"] = user.DeletedAt.Time
+	}
+	return resp
+}
+
+// targetUserID parses the {id} URL parameter of the /admin/users routes.
+func targetUserID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid User ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// notSelf rejects actions an administrator must not take on their own account,
+// so that nobody can lock themselves out of the admin API.
+func notSelf(w http.ResponseWriter, r *http.Request, targetID uint) bool {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	if userIDUint == targetID {
+		http.Error(w, "Cannot apply this action to your own account", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List user accounts. Filter by status: active, disabled or deleted. Without a status every account that is not deleted is listed.
+// @Tags admin
+// @Produce json
+// @Param status query string false "active, disabled or deleted"
+// @Success 200 {array} map[string]interface{} "Users"
+// @Failure 400 {string} string "Invalid status"
+// @Failure 403 {string} string "Missing permission"
+// @Security BearerAuth
+// @Router /admin/users [get]
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.UserStatusActive, models.UserStatusDisabled, models.UserStatusDeleted:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	users := models.GetUsersByStatus(status)
+	resp := make([]map[string]interface{}, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, adminUserResponse(user))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description Get any user account, including disabled and deleted ones.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "User"
+// @Failure 400 {string} string "Invalid User ID"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /admin/users/{id} [get]
+func GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, found := models.GetUserByIDUnscoped(id)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminUserResponse(user))
+}
+
+// ListUserTasks godoc
+// @Summary List a user's tasks
+// @Description Inspect the tasks of any user.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {array} models.Task "Tasks"
+// @Failure 400 {string} string "Invalid User ID"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /admin/users/{id}/tasks [get]
+func ListUserTasks(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, found := models.GetUserByIDUnscoped(id); !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	tasks := models.GetTasks(id)
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// DisableUser godoc
+// @Summary Disable a user
+// @Description Block a user from signing in and revoke all of their sessions. Their data is kept.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Disabled user"
+// @Failure 400 {string} string "Invalid User ID or own account"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "User Not Found or already disabled"
+// @Security BearerAuth
+// @Router /admin/users/{id}/disable [post]
+func DisableUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok || !notSelf(w, r, id) {
+		return
+	}
+
+	user, found := models.DisableUser(id)
+	if !found {
+		http.Error(w, "User Not Found or already disabled", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeAllSessions(user.ID); err != nil {
+		http.Error(w, "Error revoking tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminUserResponse(user))
+}
+
+// RestoreUser godoc
+// @Summary Restore a user
+// @Description Re-enable a disabled user, or undelete a deleted user together with the tasks deleted with the account.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Restored user"
+// @Failure 400 {string} string "Invalid User ID"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "User Not Found or not disabled"
+// @Security BearerAuth
+// @Router /admin/users/{id}/restore [post]
+func RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, found := models.RestoreUser(id)
+	if !found {
+		http.Error(w, "User Not Found or not disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminUserResponse(user))
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Delete a user account with all of its tasks and revoke its sessions. The account can be restored.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Deleted user"
+// @Failure 400 {string} string "Invalid User ID or own account"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /admin/users/{id} [delete]
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok || !notSelf(w, r, id) {
+		return
+	}
+
+	deleted, found := models.DeleteUser(id)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeAllSessions(deleted.ID); err != nil {
+		http.Error(w, "Error revoking tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminUserResponse(deleted))
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user's login
+// @Description Clear the failed login attempts of a user, lifting a lockout.
+// @Tags admin
+// @Param id path int true "User ID"
+// @Success 204 "Unlocked"
+// @Failure 400 {string} string "Invalid User ID"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /admin/users/{id}/unlock [post]
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, found := models.GetUserByID(id)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	models.ResetLoginFailures(models.AccountThrottleKey(user.Email))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setRoleRequest is the body expected by SetUserRole.
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// SetUserRole godoc
+// @Summary Assign a role
+// @Description Give a user one of the existing roles. Callers can only assign roles whose permissions their own role grants, to users whose current role they could assign.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body setRoleRequest true "Role name"
+// @Success 200 {object} map[string]interface{} "Updated user"
+// @Failure 400 {string} string "Invalid input or own account"
+// @Failure 403 {string} string "Missing permission, or role grants more than the caller's"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /admin/users/{id}/role [put]
+func SetUserRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	role, found := models.GetRole(req.Role)
+	if !found {
+		http.Error(w, "Unknown role "+req.Role, http.StatusBadRequest)
+		return
+	}
+	if !notSelf(w, r, id) {
+		return
+	}
+
+	// users:manage must not lead to more permissions than the caller has,
+	// nor take roles away from users who have more
+	callerID, _ := utils.GetUserID(r)
+	caller, _ := models.GetUserByID(callerID)
+	callerRole, _ := models.GetRole(caller.Role)
+	if !callerRole.Covers(role) {
+		http.Error(w, "Cannot assign a role with permissions you do not have", http.StatusForbidden)
+		return
+	}
+	if target, found := models.GetUserByID(id); found {
+		if current, ok := models.GetRole(target.Role); ok && !callerRole.Covers(current) {
+			http.Error(w, "Cannot change the role of a user with permissions you do not have", http.StatusForbidden)
+			return
+		}
+	}
+
+	user, found := models.SetUserRole(id, req.Role)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminUserResponse(user))
+}
+
+// roleRequest is the body expected by CreateRole and UpdateRole.
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// validPermissions answers 400 Bad Request for unknown permissions.
+func validPermissions(w http.ResponseWriter, permissions []string) bool {
+	for _, p := range permissions {
+		if !models.ValidPermission(p) {
+			http.Error(w, "Unknown permission "+p, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List the built-in and custom roles with their permissions.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.Role "Roles"
+// @Failure 403 {string} string "Missing permission"
+// @Security BearerAuth
+// @Router /admin/roles [get]
+func ListRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GetRoles())
+}
+
+// CreateRole godoc
+// @Summary Create a custom role
+// @Description Create a role with a set of permissions.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param role body roleRequest true "Name, description and permissions"
+// @Success 201 {object} models.Role "Created role"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 409 {string} string "Role already exists"
+// @Security BearerAuth
+// @Router /admin/roles [post]
+func CreateRole(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if !validPermissions(w, req.Permissions) {
+		return
+	}
+	if _, found := models.GetRole(name); found {
+		http.Error(w, "Role already exists", http.StatusConflict)
+		return
+	}
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+
+	role, err := models.AddRole(models.Role{Name: name, Description: req.Description, Permissions: req.Permissions})
+	if err != nil {
+		http.Error(w, "Error saving role", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(role)
+}
+
+// UpdateRole godoc
+// @Summary Update a custom role
+// @Description Replace the description and permissions of a custom role. Built-in roles cannot be changed.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param role body roleRequest true "Description and permissions"
+// @Success 200 {object} models.Role "Updated role"
+// @Failure 400 {string} string "Invalid input or built-in role"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "Role Not Found"
+// @Security BearerAuth
+// @Router /admin/roles/{name} [put]
+func UpdateRole(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !validPermissions(w, req.Permissions) {
+		return
+	}
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+
+	role, err := models.UpdateRole(chi.URLParam(r, "name"), req.Description, req.Permissions)
+	if !writeRoleError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(role)
+}
+
+// DeleteRole godoc
+// @Summary Delete a custom role
+// @Description Delete a custom role that is not assigned to any user.
+// @Tags admin
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 200 {object} models.Role "Deleted role"
+// @Failure 400 {string} string "Built-in role"
+// @Failure 403 {string} string "Missing permission"
+// @Failure 404 {string} string "Role Not Found"
+// @Failure 409 {string} string "Role still assigned"
+// @Security BearerAuth
+// @Router /admin/roles/{name} [delete]
+func DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role, err := models.DeleteRole(chi.URLParam(r, "name"))
+	if !writeRoleError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(role)
+}
+
+// writeRoleError maps role errors to responses. It returns true when err is nil.
+func writeRoleError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Role Not Found", http.StatusNotFound)
+	case errors.Is(err, models.ErrRoleBuiltin):
+		http.Error(w, "Built-in roles cannot be changed", http.StatusBadRequest)
+	case errors.Is(err, models.ErrRoleInUse):
+		http.Error(w, "Role is still assigned to users", http.StatusConflict)
+	default:
+		http.Error(w, "Error saving role", http.StatusInternalServerError)
+	}
+	return false
+}
@@ -2,21 +2,55 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/youssef-abbih/go-todo-list/utils"
 	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
 	
 )
+// passwordLoginEnabled reports whether accounts may sign in with a password.
+// Deployments that rely on single sign-on set PASSWORD_LOGIN=false.
+func passwordLoginEnabled() bool {
+	return utils.EnvBool("PASSWORD_LOGIN", true)
+}
+
+// requirePasswordLogin answers 403 Forbidden when password sign-in is disabled.
+func requirePasswordLogin(w http.ResponseWriter) bool {
+	if !passwordLoginEnabled() {
+		http.Error(w, "Password login is disabled, use single sign-on", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Register godoc
+// @Summary Register a new user
+// @Description Create a user account from an email and password. A verification link is emailed to the address.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body models.User true "Email and password"
+// @Success 201 {object} map[string]interface{} "Created user"
+// @Failure 400 {object} map[string]interface{} "Invalid input or password policy violations"
+// @Failure 409 {string} string "User already exist"
+// @Router /users/register [post]
 func Register(w http.ResponseWriter, r *http.Request){
 	if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		if !requirePasswordLogin(w) {
+			return
+		}
+
 		var user models.User
 		
 		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
@@ -34,35 +68,56 @@ func Register(w http.ResponseWriter, r *http.Request){
 			return
 		}
 
-		var err error
-		user.Password, err = models.HashPassword(user.Password) 
-
-		if err != nil {
-			http.Error(w, "Error while hashing the password", http.StatusBadRequest)
+		if !acceptablePassword(w, user.Password, user.Email) {
 			return
 		}
 
-		createdUser, err := models.AddUser(user)
+		// AddUser hashes the password before storing it. Only take the
+		// credentials from the body, new accounts always start unverified.
+		createdUser, err := models.AddUser(models.User{Email: user.Email, Password: user.Password})
 		if err != nil {
 			http.Error(w, "Error saving user to database", http.StatusInternalServerError)
 			return
 		}
+
+		if err := sendVerificationEmail(r, createdUser); err != nil {
+			slog.Error("Failed to send verification email", "user_id", createdUser.ID, "error", err)
+		}
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status": http.StatusCreated,
 			"user": map[string]interface{}{
-				"id":    createdUser.ID,
-				"email": createdUser.Email,
+				"id":             createdUser.ID,
+				"email":          createdUser.Email,
+				"email_verified": createdUser.EmailVerified,
 			},
 		})
 }
 
+// Login godoc
+// @Summary Log in
+// @Description Exchange an email and password for a short-lived JWT access token and a refresh token. Users with two-factor authentication get an mfa_token instead, to be completed at /users/login/mfa. Every login starts a session, listed under /users/me/sessions; send X-Device-Name to name it.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body models.User true "Email and password"
+// @Success 200 {object} map[string]interface{} "Access token and refresh token"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Invalid email or password"
+// @Failure 403 {string} string "Account disabled"
+// @Failure 429 {string} string "Too many failed login attempts"
+// @Router /users/login [post]
 func Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if !requirePasswordLogin(w) {
+		return
+	}
+
 	var user models.User
 	
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
@@ -70,34 +125,277 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if loginThrottled(w, r, user.Email) {
+		return
+	}
+
 	existingUser, found := models.GetUserByEmail(user.Email)
 
+	// Unknown emails cost a comparison too, so that neither the answer nor
+	// its timing tells which emails are registered
+	hash := []byte(existingUser.Password)
 	if !found {
-		http.Error(w, "Invalid email or password", http.StatusBadRequest)
+		hash = dummyPasswordHash()
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(user.Password)); err != nil || !found {
+		recordLoginFailure(r, user.Email)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(user.Password)); err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+	if existingUser.DisabledAt != nil {
+		http.Error(w, "Account disabled", http.StatusForbidden)
+		return
+	}
+	// With two-factor authentication, the password only earns a challenge
+	if existingUser.TOTPEnabled {
+		writeMFAChallenge(w, existingUser)
 		return
 	}
-		claims := jwt.MapClaims{
-			"sub": existingUser.ID,
-			"email": existingUser.Email,
-			"iat": time.Now().Unix(),
-			"exp": time.Now().Add(time.Hour * 72).Unix(),
+
+	recordLoginSuccess(existingUser.Email)
+	issueTokenPair(w, r, existingUser)
+}
+
+// writeMFAChallenge responds with the mfa_token a user with two-factor
+// authentication completes at /users/login/mfa.
+func writeMFAChallenge(w http.ResponseWriter, user models.User) {
+	challenge, err := tokens.Default().IssueChallenge(user.ID, tokens.ChallengeMFA, mfaChallengeTTL)
+	if err != nil {
+		http.Error(w, "Error while signing the JWT Token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    challenge,
+		"expires_in":   int(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// dummyPasswordHash is compared against on logins with an unknown email.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(tokens.NewID()), bcrypt.DefaultCost)
+	return hash
+})
+
+// issueTokenPair starts a new login session for user on the requesting device
+// and responds with its first access token and refresh token.
+func issueTokenPair(w http.ResponseWriter, r *http.Request, user models.User) {
+	familyID := tokens.NewID()
+	signedJwtToken, claims, err := tokens.Default().IssueSession(user.ID, user.Email, familyID)
+	if err != nil {
+		http.Error(w, "Error while signing the JWT Token", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, refreshHash := tokens.NewOpaqueToken()
+	expiresAt := time.Now().Add(tokens.Default().RefreshTTL())
+	if _, err := models.AddRefreshToken(user.ID, familyID, refreshHash, expiresAt); err != nil {
+		http.Error(w, "Error saving refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = models.AddSession(models.Session{
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		LastJTI:    claims.ID,
+		DeviceName: deviceName(r),
+		UserAgent:  truncate(r.UserAgent(), 512),
+		IP:         clientIP(r),
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		http.Error(w, "Error saving session", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenPair(w, signedJwtToken, refreshToken)
+}
+
+// writeTokenPair encodes the token response shared by Login and RefreshToken.
+func writeTokenPair(w http.ResponseWriter, accessToken, refreshToken string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Token":         accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(tokens.Default().TTL().Seconds()),
+		"refresh_token": refreshToken,
+	})
+}
+
+// refreshRequest is the body expected by RefreshToken.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken godoc
+// @Summary Refresh an access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Every refresh token can be used once; presenting a used one revokes its whole token family.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body refreshRequest true "Refresh token"
+// @Success 200 {object} map[string]interface{} "New token pair"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Invalid or expired refresh token"
+// @Router /users/token/refresh [post]
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	newToken, newHash := tokens.NewOpaqueToken()
+	expiresAt := time.Now().Add(tokens.Default().RefreshTTL())
+	rotated, err := models.RotateRefreshToken(tokens.HashOpaqueToken(req.RefreshToken), newHash, expiresAt, 0)
+	if errors.Is(err, models.ErrRefreshTokenReused) {
+		slog.Warn("Refresh token reuse detected, token family revoked", "remote_addr", r.RemoteAddr)
+		// The access tokens of the session may have been stolen along with
+		// the refresh token
+		if err := models.RevokeSessionByFamily(rotated.FamilyID, time.Now().Add(tokens.Default().MaxAge())); err != nil {
+			slog.Error("Failed to revoke the session of a reused refresh token", "error", err)
 		}
-		secretKey := utils.LoadJWTSecretkey()
-		jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256,claims)
-		signedJwtToken, err :=jwtToken.SignedString([]byte(secretKey))
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
 
-		if err != nil {
-			http.Error(w, "Error while signing the JWT Token", http.StatusInternalServerError)
+	user, found := models.GetUserByID(rotated.UserID)
+	if !found || user.DisabledAt != nil {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	signedJwtToken, claims, err := tokens.Default().IssueSession(user.ID, user.Email, rotated.FamilyID)
+	if err != nil {
+		http.Error(w, "Error while signing the JWT Token", http.StatusInternalServerError)
+		return
+	}
+	if err := models.RefreshSession(rotated.FamilyID, claims.ID, expiresAt); err != nil {
+		http.Error(w, "Error saving session", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenPair(w, signedJwtToken, newToken)
+}
+
+// logoutRequest is the optional body of Logout.
+type logoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Logout godoc
+// @Summary Log out the current session
+// @Description Revoke the session of the access token used for this request. If a refresh token is given, its whole token family is revoked as well.
+// @Tags users
+// @Accept json
+// @Param token body logoutRequest false "Refresh token of the session"
+// @Success 204 "Logged out"
+// @Failure 400 {string} string "Invalid JSON"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /users/logout [post]
+func Logout(w http.ResponseWriter, r *http.Request) {
+	var req logoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "user not authorized", http.StatusUnauthorized)
+		return
+	}
+	if claims.IsPersonalAccessToken() {
+		http.Error(w, "Personal access tokens cannot log out, revoke them instead", http.StatusBadRequest)
+		return
+	}
+	userIDUint, err := claims.UserID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := models.RevokeToken(claims.ID, userIDUint, claims.ExpiresAt.Time); err != nil {
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+
+	if claims.SessionID != "" {
+		if err := models.RevokeSessionByFamily(claims.SessionID, time.Now().Add(tokens.Default().MaxAge())); err != nil {
+			http.Error(w, "Error revoking session", http.StatusInternalServerError)
 			return
 		}
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-	    json.NewEncoder(w).Encode(map[string]string{"Token": signedJwtToken})
+	if req.RefreshToken != "" {
+		refresh, found := models.GetRefreshTokenByHash(tokens.HashOpaqueToken(req.RefreshToken))
+		if found && refresh.UserID == userIDUint {
+			if err := models.RevokeRefreshTokenFamily(refresh.FamilyID); err != nil {
+				http.Error(w, "Error revoking refresh token", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
 
-	
-}
\ No newline at end of file
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+// @Summary Log out all sessions
+// @Description Revoke every access token and refresh token of the authenticated user.
+// @Tags users
+// @Success 204 "Logged out everywhere"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /users/logout/all [post]
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "user not authorized", http.StatusUnauthorized)
+		return
+	}
+	if claims.IsPersonalAccessToken() {
+		http.Error(w, "Personal access tokens cannot log out, revoke them instead", http.StatusBadRequest)
+		return
+	}
+	userIDUint, err := claims.UserID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// The user-wide revocation covers earlier seconds only, so revoke this token explicitly
+	if err := models.RevokeToken(claims.ID, userIDUint, claims.ExpiresAt.Time); err != nil {
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+	if err := revokeAllSessions(userIDUint); err != nil {
+		http.Error(w, "Error revoking tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllSessions revokes every session, access token and refresh token of a user.
+func revokeAllSessions(userID uint) error {
+	if err := models.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+	if err := models.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+	return models.RevokeAllTokens(userID, time.Now().Add(tokens.Default().MaxAge()))
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// boardParams returns the project ID of a board URL and the authenticated
+// user, answering 400 or 401 if either is missing.
+func boardParams(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "project"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Project ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	return uint(id), userID, true
+}
+
+// GetBoard godoc
+// @Summary Get a project board
+// @Description Get the tasks of a project in one column per status of its workflow, each with its work-in-progress limit (0 for none) and task count. Columns are in their manual order and take the filters and sort options of GET /tasks.
+// @Tags boards
+// @Produce json
+// @Param project path int true "Project ID"
+// @Success 200 {object} models.Board "Board"
+// @Failure 400 {string} string "Invalid Project ID or filter"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /boards/{project} [get]
+func GetBoard(w http.ResponseWriter, r *http.Request) {
+	projectID, userID, ok := boardParams(w, r)
+	if !ok {
+		return
+	}
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	board, found := models.GetBoard(projectID, userID, filter)
+	if !found {
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(board)
+}
+
+// MoveOnBoard godoc
+// @Summary Move a task on a board
+// @Description Move a task of the project to the column of status, directly before or after another task of that column, or to its end when neither is set. The column and position change together; the move is rejected if the workflow does not allow the status change or the column is at its work-in-progress limit, and moves that complete a blocked task unless force=true.
+// @Tags boards
+// @Accept json
+// @Produce json
+// @Param project path int true "Project ID"
+// @Param move body models.BoardMove true "Task, column and neighbour"
+// @Param force query bool false "Complete the task even if it is blocked"
+// @Success 200 {object} models.Task "Moved task"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Failure 409 {string} string "Status change not allowed, column full, or task blocked"
+// @Security BearerAuth
+// @Router /boards/{project}/move [post]
+func MoveOnBoard(w http.ResponseWriter, r *http.Request) {
+	projectID, userID, ok := boardParams(w, r)
+	if !ok {
+		return
+	}
+	var move models.BoardMove
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if move.TaskID == 0 || move.Status == "" {
+		http.Error(w, "task_id and status are required", http.StatusBadRequest)
+		return
+	}
+	if move.Before != 0 && move.After != 0 {
+		http.Error(w, "At most one of before and after may be set", http.StatusBadRequest)
+		return
+	}
+
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	task, err := models.MoveOnBoard(projectID, userID, move, force)
+	if errors.Is(err, models.ErrMoveTarget) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !writeTaskError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// addBlockerRequest is the body of AddTaskBlocker.
+type addBlockerRequest struct {
+	BlockerID uint `json:"blocker_id"`
+}
+
+// ListTaskBlockers godoc
+// @Summary List the blockers of a task
+// @Description List the tasks that block a task of the authenticated user, in their manual order.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {array} models.Task "Blockers"
+// @Failure 400 {string} string "Invalid Task ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/blockers [get]
+func ListTaskBlockers(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	blockers, found := models.GetBlockers(uint(id), userID)
+	if !found {
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+		return
+	}
+	if blockers == nil {
+		blockers = []models.Task{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blockers)
+}
+
+// AddTaskBlocker godoc
+// @Summary Block a task by another
+// @Description Record that a task of the authenticated user cannot be completed before another of their tasks. Dependencies that would make a task wait for itself are refused.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param blocker body addBlockerRequest true "Blocking task"
+// @Success 200 {object} models.Task "Task with its blockers"
+// @Failure 400 {string} string "Invalid Task ID, JSON or blocker"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Failure 409 {string} string "Dependency would create a cycle"
+// @Security BearerAuth
+// @Router /tasks/{id}/blockers [post]
+func AddTaskBlocker(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req addBlockerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.BlockerID == 0 {
+		http.Error(w, "blocker_id is required", http.StatusBadRequest)
+		return
+	}
+
+	task, err := models.AddBlocker(uint(id), req.BlockerID, userID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrBlockerInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrDependencyCycle):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Error saving dependency", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// RemoveTaskBlocker godoc
+// @Summary Unblock a task
+// @Description Remove a blocker from one of the authenticated user's tasks.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param blockerID path int true "Blocking task ID"
+// @Success 200 {object} models.Task "Task with its remaining blockers"
+// @Failure 400 {string} string "Invalid Task ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task or Dependency Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/blockers/{blockerID} [delete]
+func RemoveTaskBlocker(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	blockerID, err := strconv.Atoi(chi.URLParam(r, "blockerID"))
+	if err != nil || blockerID <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	task, ok := models.RemoveBlocker(uint(id), uint(blockerID), userID)
+	if !ok {
+		http.Error(w, "Task or Dependency Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// GetNextTasks godoc
+// @Summary List what can be done next
+// @Description List the open tasks of the authenticated user so that every task comes after the tasks blocking it. Among tasks that can go next, higher priorities come first, then the manual order; blocked tasks are flagged.
+// @Tags tasks
+// @Produce json
+// @Success 200 {array} models.Task "Open tasks in dependency order"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /tasks/next [get]
+func GetNextTasks(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.NextTasks(userID))
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/youssef-abbih/go-todo-list/tokens"
+)
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys other services can use to verify tokens issued by this API, identified by the kid token header.
+// @Tags Default
+// @Produce json
+// @Success 200 {object} tokens.JWKS
+// @Router /.well-known/jwks.json [get]
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(tokens.Default().JWKS())
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// accountLoginPolicy throttles failed logins per email address.
+func accountLoginPolicy() models.LoginPolicy {
+	return models.LoginPolicy{
+		MaxFailures:     utils.EnvInt("LOGIN_MAX_FAILURES", 10),
+		LockoutDuration: utils.EnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		DelayAfter:      utils.EnvInt("LOGIN_DELAY_AFTER", 3),
+		BaseDelay:       utils.EnvDuration("LOGIN_DELAY_BASE", time.Second),
+		MaxDelay:        utils.EnvDuration("LOGIN_DELAY_MAX", 30*time.Second),
+		Window:          utils.EnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+}
+
+// ipLoginPolicy throttles failed logins per client IP address, across accounts.
+func ipLoginPolicy() models.LoginPolicy {
+	policy := accountLoginPolicy()
+	policy.MaxFailures = utils.EnvInt("LOGIN_IP_MAX_FAILURES", 50)
+	policy.DelayAfter = utils.EnvInt("LOGIN_IP_DELAY_AFTER", 10)
+	return policy
+}
+
+// resetAccountPolicy throttles password reset requests per email address:
+// after the first one, each further request has to wait.
+func resetAccountPolicy() models.LoginPolicy {
+	return models.LoginPolicy{
+		MaxFailures:     utils.EnvInt("PASSWORD_RESET_MAX_REQUESTS", 5),
+		LockoutDuration: utils.EnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		DelayAfter:      1,
+		BaseDelay:       utils.EnvDuration("PASSWORD_RESET_DELAY", time.Minute),
+		MaxDelay:        15 * time.Minute,
+		Window:          utils.EnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+}
+
+// resetIPPolicy throttles password reset requests per client IP address,
+// across accounts.
+func resetIPPolicy() models.LoginPolicy {
+	policy := resetAccountPolicy()
+	policy.MaxFailures = utils.EnvInt("PASSWORD_RESET_IP_MAX_REQUESTS", 20)
+	policy.DelayAfter = 5
+	return policy
+}
+
+// clientIP returns the IP address of the client without the port.
+func clientIP(r *http.Request) string {
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// loginThrottled answers 429 Too Many Requests when the account or the client
+// IP address has to wait before trying again.
+func loginThrottled(w http.ResponseWriter, r *http.Request, email string) bool {
+	return throttled(w, "Too many failed login attempts, try again later",
+		models.AccountThrottleKey(email), models.IPThrottleKey(clientIP(r)))
+}
+
+// resetThrottled answers 429 Too Many Requests when the email address or the
+// client IP address has to wait before requesting another password reset.
+func resetThrottled(w http.ResponseWriter, r *http.Request, email string) bool {
+	return throttled(w, "Too many password reset requests, try again later",
+		models.ResetAccountThrottleKey(email), models.ResetIPThrottleKey(clientIP(r)))
+}
+
+// throttled answers 429 Too Many Requests with message when any of the
+// throttle keys has to wait.
+func throttled(w http.ResponseWriter, message string, keys ...string) bool {
+	wait := time.Until(models.LoginRetryAt(keys...))
+	if wait <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, message, http.StatusTooManyRequests)
+	return true
+}
+
+// recordLoginFailure counts a failed attempt against the account and the
+// client IP address, and logs any lockout it triggers.
+func recordLoginFailure(r *http.Request, email string) {
+	ip := clientIP(r)
+	for _, c := range []struct {
+		scope  string
+		key    string
+		policy models.LoginPolicy
+	}{
+		{"account", models.AccountThrottleKey(email), accountLoginPolicy()},
+		{"ip", models.IPThrottleKey(ip), ipLoginPolicy()},
+	} {
+		throttle, locked, err := models.RecordLoginFailure(c.key, c.policy)
+		if err != nil {
+			slog.Error("Failed to record login failure", "key", c.key, "error", err)
+			continue
+		}
+		if locked {
+			slog.Warn("Login lockout triggered",
+				"scope", c.scope,
+				"key", c.key,
+				"email", email,
+				"remote_ip", ip,
+				"failures", throttle.Failures,
+				"locked_until", throttle.LockedUntil,
+			)
+		}
+	}
+}
+
+// recordResetRequest counts a password reset request against the email
+// address and the client IP address, whether or not the email belongs to an
+// account.
+func recordResetRequest(r *http.Request, email string) {
+	for _, c := range []struct {
+		key    string
+		policy models.LoginPolicy
+	}{
+		{models.ResetAccountThrottleKey(email), resetAccountPolicy()},
+		{models.ResetIPThrottleKey(clientIP(r)), resetIPPolicy()},
+	} {
+		if _, _, err := models.RecordLoginFailure(c.key, c.policy); err != nil {
+			slog.Error("Failed to record password reset request", "key", c.key, "error", err)
+		}
+	}
+}
+
+// recordLoginSuccess clears the failures of the account. Failures of the IP
+// address are kept, so one valid account cannot be used to reset them.
+func recordLoginSuccess(email string) {
+	models.ResetLoginFailures(models.AccountThrottleKey(email))
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/totp"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+const (
+	// mfaChallengeTTL is how long a user has to enter their code after the password step.
+	mfaChallengeTTL = 5 * time.Minute
+	// recoveryCodeCount is how many recovery codes are handed out at a time.
+	recoveryCodeCount = 10
+)
+
+// secondFactorRequest carries either a TOTP code or a recovery code.
+type secondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, of a user
+// with TOTP enabled. Both are single-use.
+func verifySecondFactor(user models.User, req secondFactorRequest) bool {
+	if req.Code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now())
+		return ok && models.UseTOTPStep(user.ID, step)
+	}
+	if req.RecoveryCode != "" {
+		return models.UseRecoveryCode(user.ID, hashRecoveryCode(req.RecoveryCode))
+	}
+	return false
+}
+
+// newRecoveryCodes returns fresh recovery codes and their hashes.
+func newRecoveryCodes() (codes, hashes []string) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		code := strings.ToLower(enc.EncodeToString(b))[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// hashRecoveryCode hashes a recovery code regardless of case and dashes.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return tokens.HashOpaqueToken(code)
+}
+
+// EnrollTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a TOTP secret for the authenticated user. Two-factor authentication is only enabled once a code is confirmed.
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} map[string]string "Secret and otpauth:// provisioning URI for a QR code"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "TOTP already enabled"
+// @Security BearerAuth
+// @Router /users/me/mfa/totp [post]
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "TOTP already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+	if !models.SetPendingTOTPSecret(user.ID, secret) {
+		http.Error(w, "Error saving secret", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_url": totp.ProvisioningURI(utils.Env("TOTP_ISSUER", "Todo List"), user.Email, secret),
+	})
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication with a code from the authenticator, and receive single-use recovery codes. The recovery codes are only shown once.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body secondFactorRequest true "Current TOTP code"
+// @Success 200 {object} map[string][]string "Recovery codes"
+// @Failure 400 {string} string "Invalid code or no enrollment in progress"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "TOTP already enabled"
+// @Security BearerAuth
+// @Router /users/me/mfa/totp/confirm [post]
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req secondFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "TOTP already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "No TOTP enrollment in progress", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := models.EnableTOTP(user.ID, step, hashes); err != nil {
+		http.Error(w, "Error enabling TOTP", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTOTP godoc
+// @Summary Disable TOTP
+// @Description Turn off two-factor authentication. Requires a current TOTP code or a recovery code.
+// @Tags mfa
+// @Accept json
+// @Param code body secondFactorRequest true "TOTP code or recovery code"
+// @Success 204 "TOTP disabled"
+// @Failure 400 {string} string "TOTP not enabled"
+// @Failure 401 {string} string "Unauthorized or invalid code"
+// @Security BearerAuth
+// @Router /users/me/mfa/totp [delete]
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req secondFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "TOTP not enabled", http.StatusBadRequest)
+		return
+	}
+	if !verifySecondFactor(user, req) {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := models.DisableTOTP(user.ID); err != nil {
+		http.Error(w, "Error disabling TOTP", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes with new ones. Requires a current TOTP code.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body secondFactorRequest true "Current TOTP code"
+// @Success 200 {object} map[string][]string "New recovery codes"
+// @Failure 400 {string} string "TOTP not enabled"
+// @Failure 401 {string} string "Unauthorized or invalid code"
+// @Security BearerAuth
+// @Router /users/me/mfa/recovery-codes [post]
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req secondFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "TOTP not enabled", http.StatusBadRequest)
+		return
+	}
+	// Recovery codes cannot be used to mint new ones
+	if !verifySecondFactor(user, secondFactorRequest{Code: req.Code}) {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := models.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		http.Error(w, "Error saving recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// mfaLoginRequest is the body expected by LoginMFA.
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	secondFactorRequest
+}
+
+// LoginMFA godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the mfa_token returned by Login and a TOTP code (or a recovery code) for an access token and a refresh token.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body mfaLoginRequest true "MFA challenge token and code"
+// @Success 200 {object} map[string]interface{} "Access token and refresh token"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Invalid or expired challenge, or invalid code"
+// @Failure 429 {string} string "Too many failed login attempts"
+// @Router /users/login/mfa [post]
+func LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "mfa_token and code or recovery_code are required", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := tokens.Default().ParseChallenge(req.MFAToken, tokens.ChallengeMFA)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found || !user.TOTPEnabled || user.DisabledAt != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	if loginThrottled(w, r, user.Email) {
+		return
+	}
+	if !verifySecondFactor(user, req.secondFactorRequest) {
+		recordLoginFailure(r, user.Email)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	recordLoginSuccess(user.Email)
+	issueTokenPair(w, r, user)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// createClientRequest is the body expected by CreateOAuthClient.
+type createClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grant_types"`
+	Confidential bool     `json:"confidential"`
+}
+
+// validateClientRequest checks a client registration and fills in the default
+// grant types. It returns an error message when the registration is invalid.
+func validateClientRequest(req *createClientRequest) string {
+	if strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		return "name and scopes are required"
+	}
+	for _, scope := range req.Scopes {
+		if !tokens.ValidOAuthScope(scope) {
+			return "Scope " + scope + " cannot be granted to clients"
+		}
+	}
+
+	if len(req.GrantTypes) == 0 {
+		req.GrantTypes = []string{models.GrantAuthorizationCode, models.GrantRefreshToken}
+	}
+	for _, grant := range req.GrantTypes {
+		switch grant {
+		case models.GrantAuthorizationCode, models.GrantRefreshToken:
+		case models.GrantClientCredentials:
+			if !req.Confidential {
+				return "Only confidential clients can use client_credentials"
+			}
+		default:
+			return "Unknown grant type " + grant
+		}
+	}
+
+	for _, uri := range req.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return "Invalid redirect URI " + uri
+		}
+	}
+	for _, grant := range req.GrantTypes {
+		if grant == models.GrantAuthorizationCode && len(req.RedirectURIs) == 0 {
+			return "authorization_code needs at least one redirect URI"
+		}
+	}
+	return ""
+}
+
+// validRedirectURI reports whether a client may register uri to receive
+// authorization codes: an https URL, or an http URL on the loopback
+// interface for native apps, without a fragment. Other schemes, such as
+// javascript: or data:, would be followed by the consent screen.
+func validRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" || parsed.User != nil || parsed.Fragment != "" {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := parsed.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
+
+// ListOAuthClients godoc
+// @Summary List OAuth clients
+// @Description List the OAuth clients registered by the authenticated user. Secrets are never returned.
+// @Tags oauth
+// @Produce json
+// @Success 200 {array} models.OAuthClient "Clients"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Login session required"
+// @Security BearerAuth
+// @Router /oauth/clients [get]
+func ListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	clients := models.GetOAuthClients(userIDUint)
+	if clients == nil {
+		clients = []models.OAuthClient{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+// CreateOAuthClient godoc
+// @Summary Register an OAuth client
+// @Description Register a third-party application. Confidential clients get a secret, which is only returned in this response; public clients must use PKCE. Grant types default to authorization_code and refresh_token. Redirect URIs must use https, or http on a loopback address.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param client body createClientRequest true "Client registration"
+// @Success 201 {object} map[string]interface{} "Registered client including its secret"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Login session required"
+// @Security BearerAuth
+// @Router /oauth/clients [post]
+func CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	var req createClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if msg := validateClientRequest(&req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	client := models.OAuthClient{
+		ClientID:     tokens.NewID(),
+		Name:         strings.TrimSpace(req.Name),
+		Confidential: req.Confidential,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		GrantTypes:   req.GrantTypes,
+		OwnerID:      userIDUint,
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+	var secret string
+	if client.Confidential {
+		secret, client.SecretHash = tokens.NewOpaqueToken()
+	}
+
+	created, err := models.AddOAuthClient(client)
+	if err != nil {
+		http.Error(w, "Error saving client", http.StatusInternalServerError)
+		return
+	}
+
+	body := map[string]interface{}{
+		"id":            created.ID,
+		"client_id":     created.ClientID,
+		"name":          created.Name,
+		"confidential":  created.Confidential,
+		"redirect_uris": created.RedirectURIs,
+		"scopes":        created.Scopes,
+		"grant_types":   created.GrantTypes,
+		"created_at":    created.CreatedAt,
+	}
+	if secret != "" {
+		body["client_secret"] = secret
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(body)
+}
+
+// DeleteOAuthClient godoc
+// @Summary Delete an OAuth client
+// @Description Delete one of the authenticated user's OAuth clients. Its consents, refresh tokens and access tokens are revoked.
+// @Tags oauth
+// @Produce json
+// @Param id path int true "Client ID"
+// @Success 200 {object} models.OAuthClient "Deleted client"
+// @Failure 400 {string} string "Invalid Client ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Login session required"
+// @Failure 404 {string} string "Client Not Found"
+// @Security BearerAuth
+// @Router /oauth/clients/{id} [delete]
+func DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Client ID", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	client, found := models.RevokeOAuthClient(uint(id), userIDUint, time.Now().Add(tokens.Default().MaxAge()))
+	if !found {
+		http.Error(w, "Client Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client)
+}
+
+// ListConsents godoc
+// @Summary List OAuth consents
+// @Description List the clients the authenticated user has authorized, with the scopes granted to each.
+// @Tags oauth
+// @Produce json
+// @Success 200 {array} models.OAuthConsent "Consents"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /users/me/consents [get]
+func ListConsents(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	consents := models.GetOAuthConsents(userIDUint)
+	if consents == nil {
+		consents = []models.OAuthConsent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consents)
+}
+
+// RevokeConsent godoc
+// @Summary Revoke an OAuth consent
+// @Description Withdraw the authenticated user's consent for a client. The refresh and access tokens the client holds for the user are revoked.
+// @Tags oauth
+// @Produce json
+// @Param id path int true "Consent ID"
+// @Success 200 {object} models.OAuthConsent "Revoked consent"
+// @Failure 400 {string} string "Invalid Consent ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Consent Not Found"
+// @Security BearerAuth
+// @Router /users/me/consents/{id} [delete]
+func RevokeConsent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Consent ID", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	consent, found := models.RevokeOAuthConsent(uint(id), userIDUint, time.Now().Add(tokens.Default().MaxAge()))
+	if !found {
+		http.Error(w, "Consent Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consent)
+}
@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/oidc"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// oauthCodeTTL is how long a client has to exchange an authorization code.
+const oauthCodeTTL = 5 * time.Minute
+
+// authorizeRequest carries the parameters of an authorization request. GET
+// /oauth/authorize reads them from the query string, POST from a JSON body.
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// validateAuthorizeRequest checks an authorization request and returns the
+// client and the requested scopes. Scopes default to everything the client
+// was registered for.
+func validateAuthorizeRequest(w http.ResponseWriter, req authorizeRequest) (models.OAuthClient, []string, bool) {
+	client, found := models.GetOAuthClient(req.ClientID)
+	if !found {
+		http.Error(w, "Unknown client", http.StatusBadRequest)
+		return models.OAuthClient{}, nil, false
+	}
+	if !client.AllowsGrant(models.GrantAuthorizationCode) {
+		http.Error(w, "Client is not allowed to use the authorization code grant", http.StatusBadRequest)
+		return models.OAuthClient{}, nil, false
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+		return models.OAuthClient{}, nil, false
+	}
+	if req.ResponseType != "code" {
+		http.Error(w, "response_type must be code", http.StatusBadRequest)
+		return models.OAuthClient{}, nil, false
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		http.Error(w, "PKCE with code_challenge_method S256 is required", http.StatusBadRequest)
+		return models.OAuthClient{}, nil, false
+	}
+
+	scopes, ok := clientScopes(client, req.Scope)
+	if !ok {
+		http.Error(w, "Invalid scope", http.StatusBadRequest)
+		return models.OAuthClient{}, nil, false
+	}
+	return client, scopes, true
+}
+
+// clientScopes parses a space-separated scope parameter, which must only name
+// scopes the client was registered for. An empty parameter means all of them.
+func clientScopes(client models.OAuthClient, param string) ([]string, bool) {
+	requested := strings.Fields(param)
+	if len(requested) == 0 {
+		return client.Scopes, len(client.Scopes) > 0
+	}
+	for _, scope := range requested {
+		if !tokens.ValidOAuthScope(scope) || !slices.Contains(client.Scopes, scope) {
+			return nil, false
+		}
+	}
+	return requested, true
+}
+
+// Authorize godoc
+// @Summary Review an OAuth authorization request
+// @Description Validate an authorization code request of a third-party client and describe it for the consent screen. Requires a login session; PKCE with S256 is mandatory.
+// @Tags oauth
+// @Produce json
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space-separated scopes"
+// @Param state query string false "Opaque client state"
+// @Param code_challenge query string true "PKCE challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {object} map[string]interface{} "Client, scopes and whether consent is required"
+// @Failure 400 {string} string "Invalid request"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /oauth/authorize [get]
+func Authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := authorizeRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	client, scopes, ok := validateAuthorizeRequest(w, req)
+	if !ok {
+		return
+	}
+	consent, found := models.GetOAuthConsent(userIDUint, client.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"client":           map[string]interface{}{"client_id": client.ClientID, "name": client.Name},
+		"scopes":           scopes,
+		"redirect_uri":     req.RedirectURI,
+		"consent_required": !found || !consent.Covers(scopes),
+	})
+}
+
+// ApproveAuthorization godoc
+// @Summary Answer an OAuth authorization request
+// @Description Approve or deny an authorization request. Approving records the consent and returns the redirect URI with a single-use authorization code; denying returns it with error=access_denied.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param request body authorizeRequest true "Authorization request and decision"
+// @Success 200 {object} map[string]string "Redirect URI for the client"
+// @Failure 400 {string} string "Invalid request"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /oauth/authorize [post]
+func ApproveAuthorization(w http.ResponseWriter, r *http.Request) {
+	var req authorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	client, scopes, ok := validateAuthorizeRequest(w, req)
+	if !ok {
+		return
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !req.Approve {
+		params.Set("error", "access_denied")
+	} else {
+		if _, err := models.GrantOAuthConsent(userIDUint, client.ID, scopes); err != nil {
+			http.Error(w, "Error saving consent", http.StatusInternalServerError)
+			return
+		}
+
+		code, codeHash := tokens.NewOpaqueToken()
+		err := models.AddOAuthAuthorizationCode(models.OAuthAuthorizationCode{
+			CodeHash:      codeHash,
+			ClientID:      client.ID,
+			UserID:        userIDUint,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        scopes,
+			CodeChallenge: req.CodeChallenge,
+			FamilyID:      tokens.NewID(),
+			ExpiresAt:     time.Now().Add(oauthCodeTTL),
+		})
+		if err != nil {
+			http.Error(w, "Error saving authorization code", http.StatusInternalServerError)
+			return
+		}
+		params.Set("code", code)
+	}
+
+	redirect := req.RedirectURI
+	if strings.Contains(redirect, "?") {
+		redirect += "&" + params.Encode()
+	} else {
+		redirect += "?" + params.Encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"redirect_uri": redirect})
+}
+
+// writeOAuthError responds with an RFC 6749 error object.
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// authenticateClient identifies the client of a token endpoint request, from
+// HTTP Basic credentials or the client_id and client_secret form fields.
+// Confidential clients must present their secret; public clients have none.
+func authenticateClient(r *http.Request) (models.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 form-encodes the credentials before Basic encoding them
+		var err1, err2 error
+		clientID, err1 = url.QueryUnescape(clientID)
+		secret, err2 = url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			return models.OAuthClient{}, false
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client, found := models.GetOAuthClient(clientID)
+	if !found {
+		return models.OAuthClient{}, false
+	}
+	if !client.Confidential {
+		return client, secret == ""
+	}
+	hash := tokens.HashOpaqueToken(secret)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) != 1 {
+		return models.OAuthClient{}, false
+	}
+	return client, true
+}
+
+// writeOAuthTokens issues an access token to a client and responds with it
+// and, when refreshToken is set, the refresh token it was issued with.
+func writeOAuthTokens(w http.ResponseWriter, user models.User, client models.OAuthClient, scopes []string, refreshToken string) {
+	accessToken, _, err := tokens.Default().IssueScoped(user.ID, user.Email, scopes, client.ClientID)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Error while signing the JWT Token")
+		return
+	}
+
+	body := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokens.Default().TTL().Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	}
+	if refreshToken != "" {
+		body["refresh_token"] = refreshToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(body)
+}
+
+// OAuthToken godoc
+// @Summary Issue OAuth tokens
+// @Description Token endpoint for the authorization_code (with PKCE), refresh_token and client_credentials grants. Clients authenticate with HTTP Basic or client_id/client_secret form fields. Client credentials tokens act on behalf of the client's owner.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param code_verifier formData string false "PKCE verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Space-separated scopes for client_credentials"
+// @Success 200 {object} map[string]interface{} "Access token and optional refresh token"
+// @Failure 400 {object} map[string]string "OAuth error"
+// @Failure 401 {object} map[string]string "Invalid client"
+// @Router /oauth/token [post]
+func OAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+		return
+	}
+
+	client, ok := authenticateClient(r)
+	if !ok {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	grant := r.PostForm.Get("grant_type")
+	if !client.AllowsGrant(grant) {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Client is not allowed to use this grant type")
+		return
+	}
+
+	switch grant {
+	case models.GrantAuthorizationCode:
+		exchangeAuthorizationCode(w, r, client)
+	case models.GrantRefreshToken:
+		refreshClientToken(w, r, client)
+	case models.GrantClientCredentials:
+		issueClientCredentials(w, r, client)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+}
+
+// exchangeAuthorizationCode redeems an authorization code for tokens.
+func exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client models.OAuthClient) {
+	code, err := models.ConsumeOAuthAuthorizationCode(tokens.HashOpaqueToken(r.PostForm.Get("code")), time.Now().Add(tokens.Default().MaxAge()))
+	if errors.Is(err, models.ErrAuthorizationCodeReused) {
+		slog.Warn("Authorization code reuse detected, tokens revoked", "client_id", client.ClientID)
+	}
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return
+	}
+	verifier := r.PostForm.Get("code_verifier")
+	if verifier == "" || subtle.ConstantTimeCompare([]byte(oidc.PKCEChallenge(verifier)), []byte(code.CodeChallenge)) != 1 {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	user, found := models.GetUserByID(code.UserID)
+	if !found || user.DisabledAt != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return
+	}
+
+	var refreshToken string
+	if client.AllowsGrant(models.GrantRefreshToken) {
+		var refreshHash string
+		refreshToken, refreshHash = tokens.NewOpaqueToken()
+		expiresAt := time.Now().Add(tokens.Default().RefreshTTL())
+		if _, err := models.AddClientRefreshToken(user.ID, client.ID, code.Scopes, code.FamilyID, refreshHash, expiresAt); err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "Error saving refresh token")
+			return
+		}
+	}
+
+	writeOAuthTokens(w, user, client, code.Scopes, refreshToken)
+}
+
+// refreshClientToken rotates a refresh token issued to the client.
+func refreshClientToken(w http.ResponseWriter, r *http.Request, client models.OAuthClient) {
+	newToken, newHash := tokens.NewOpaqueToken()
+	expiresAt := time.Now().Add(tokens.Default().RefreshTTL())
+	rotated, err := models.RotateRefreshToken(tokens.HashOpaqueToken(r.PostForm.Get("refresh_token")), newHash, expiresAt, client.ID)
+	if errors.Is(err, models.ErrRefreshTokenReused) {
+		slog.Warn("Refresh token reuse detected, token family revoked", "client_id", client.ClientID)
+	}
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+		return
+	}
+
+	user, found := models.GetUserByID(rotated.UserID)
+	if !found || user.DisabledAt != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+		return
+	}
+
+	writeOAuthTokens(w, user, client, rotated.Scopes, newToken)
+}
+
+// issueClientCredentials issues an access token acting as the client's owner.
+func issueClientCredentials(w http.ResponseWriter, r *http.Request, client models.OAuthClient) {
+	if !client.Confidential {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Public clients cannot use client credentials")
+		return
+	}
+	scopes, ok := clientScopes(client, r.PostForm.Get("scope"))
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Invalid scope")
+		return
+	}
+
+	owner, found := models.GetUserByID(client.OwnerID)
+	if !found || owner.DisabledAt != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Client owner is not active")
+		return
+	}
+
+	writeOAuthTokens(w, owner, client, scopes, "")
+}
+
+// introspectAccessToken describes an access token issued to the client, or
+// returns nil when it is not active.
+func introspectAccessToken(value string, client models.OAuthClient) map[string]interface{} {
+	claims, err := tokens.Default().Parse(value)
+	if err != nil || claims.ClientID != client.ClientID {
+		return nil
+	}
+	userID, _ := claims.UserID()
+	if models.IsTokenRevoked(claims.ID, userID, claims.IssuedAt.Time) || models.IsClientRevoked(claims.ClientID, userID, claims.IssuedAt.Time) {
+		return nil
+	}
+	return map[string]interface{}{
+		"active":     true,
+		"token_type": "access_token",
+		"scope":      strings.Join(claims.Scopes, " "),
+		"client_id":  claims.ClientID,
+		"sub":        claims.Subject,
+		"exp":        claims.ExpiresAt.Unix(),
+		"iat":        claims.IssuedAt.Unix(),
+		"jti":        claims.ID,
+	}
+}
+
+// introspectRefreshToken describes a refresh token issued to the client, or
+// returns nil when it is not active.
+func introspectRefreshToken(value string, client models.OAuthClient) map[string]interface{} {
+	refresh, found := models.GetRefreshTokenByHash(tokens.HashOpaqueToken(value))
+	if !found || refresh.ClientID != client.ID || refresh.UsedAt != nil ||
+		refresh.RevokedAt != nil || time.Now().After(refresh.ExpiresAt) {
+		return nil
+	}
+	return map[string]interface{}{
+		"active":     true,
+		"token_type": "refresh_token",
+		"scope":      strings.Join(refresh.Scopes, " "),
+		"client_id":  client.ClientID,
+		"sub":        refresh.UserID,
+		"exp":        refresh.ExpiresAt.Unix(),
+	}
+}
+
+// IntrospectToken godoc
+// @Summary Introspect an OAuth token
+// @Description RFC 7662 token introspection for confidential clients. Only tokens issued to the calling client are reported as active.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Success 200 {object} map[string]interface{} "Token state"
+// @Failure 401 {object} map[string]string "Invalid client"
+// @Router /oauth/introspect [post]
+func IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+		return
+	}
+
+	client, ok := authenticateClient(r)
+	if !ok || !client.Confidential {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	value := r.PostForm.Get("token")
+	result := introspectAccessToken(value, client)
+	if result == nil {
+		result = introspectRefreshToken(value, client)
+	}
+	if result == nil {
+		result = map[string]interface{}{"active": false}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RevokeOAuthToken godoc
+// @Summary Revoke an OAuth token
+// @Description RFC 7009 token revocation. Revoking a refresh token revokes its whole family; access tokens are revoked until they expire. Unknown tokens are ignored.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Access or refresh token"
+// @Success 200 "Revoked"
+// @Failure 401 {object} map[string]string "Invalid client"
+// @Router /oauth/revoke [post]
+func RevokeOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+		return
+	}
+
+	client, ok := authenticateClient(r)
+	if !ok {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	value := r.PostForm.Get("token")
+	if refresh, found := models.GetRefreshTokenByHash(tokens.HashOpaqueToken(value)); found {
+		if refresh.ClientID == client.ID {
+			if err := models.RevokeRefreshTokenFamily(refresh.FamilyID); err != nil {
+				writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "Error revoking token")
+				return
+			}
+		}
+	} else if claims, err := tokens.Default().Parse(value); err == nil && claims.ClientID == client.ClientID {
+		userID, _ := claims.UserID()
+		if err := models.RevokeToken(claims.ID, userID, claims.ExpiresAt.Time); err != nil {
+			writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "Error revoking token")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
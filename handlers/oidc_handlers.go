@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/oidc"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+const (
+	// oidcStateTTL is how long a user has to sign in at the provider.
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookie binds an authorization request to the browser that started it.
+	oidcStateCookie = "oidc_state"
+)
+
+// startOIDC records a new authorization request and returns the provider URL
+// to send the browser to. linkUserID is non-zero when linking an identity.
+func startOIDC(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, linkUserID uint) (string, bool) {
+	state, stateHash := tokens.NewOpaqueToken()
+	nonce := tokens.NewID()
+	verifier, challenge := oidc.NewPKCE()
+
+	err := models.AddOIDCLoginState(models.OIDCLoginState{
+		StateHash:    stateHash,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		http.Error(w, "Error saving sign-in state", http.StatusInternalServerError)
+		return "", false
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		slog.Error("OIDC provider unavailable", "provider", provider.Name, "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return "", false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, true
+}
+
+// lookupProvider resolves the {provider} URL parameter.
+func lookupProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, found := oidc.Lookup(chi.URLParam(r, "provider"))
+	if !found {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
+
+// OIDCLogin godoc
+// @Summary Sign in with an identity provider
+// @Description Redirect the browser to the OpenID Connect provider to sign in. The provider redirects back to /auth/oidc/{provider}/callback.
+// @Tags oidc
+// @Param provider path string true "Provider name"
+// @Success 302 "Redirect to the provider"
+// @Failure 404 {string} string "Unknown identity provider"
+// @Failure 502 {string} string "Identity provider unavailable"
+// @Router /auth/oidc/{provider}/login [get]
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := lookupProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, ok := startOIDC(w, r, provider, 0)
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback godoc
+// @Summary Complete a sign-in with an identity provider
+// @Description Exchange the authorization code for a validated ID token. Signing in returns this API's access and refresh tokens; the user is found by linked identity, linked by an email both sides verified, or created. Users with two-factor authentication get an mfa_token instead, to be completed at /users/login/mfa. When linking, the identity is added to the signed-in user.
+// @Tags oidc
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} map[string]interface{} "Access and refresh token, MFA challenge, or the linked identity"
+// @Failure 400 {string} string "Invalid or expired state"
+// @Failure 401 {string} string "Sign-in failed"
+// @Failure 403 {string} string "Account disabled"
+// @Failure 409 {string} string "Identity or email already in use"
+// @Router /auth/oidc/{provider}/callback [get]
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := lookupProvider(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		http.Error(w, "Sign-in failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	pending, found := models.ConsumeOIDCLoginState(tokens.HashOpaqueToken(state))
+	if !found || pending.Provider != provider.Name {
+		http.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), q.Get("code"), pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		slog.Warn("OIDC sign-in failed", "provider", provider.Name, "error", err)
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+
+	if pending.LinkUserID != 0 {
+		identity, err := models.LinkIdentity(pending.LinkUserID, provider.Name, idToken.Subject, idToken.Email)
+		if errors.Is(err, models.ErrIdentityLinked) {
+			http.Error(w, "Identity is linked to another account", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error linking identity", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(identity)
+		return
+	}
+
+	user, status, msg := oidcUser(provider.Name, idToken)
+	if status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	if user.DisabledAt != nil {
+		http.Error(w, "Account disabled", http.StatusForbidden)
+		return
+	}
+	// The provider's own checks are unknown: accounts with two-factor
+	// authentication complete it here as they do after a password
+	if user.TOTPEnabled {
+		writeMFAChallenge(w, user)
+		return
+	}
+
+	issueTokenPair(w, r, user)
+}
+
+// oidcUser finds the user of a verified ID token: by linked identity first,
+// then by email when both the provider and the account have verified it,
+// creating the account if there is none yet. It returns an HTTP status and
+// message when the identity cannot be used.
+func oidcUser(provider string, idToken *oidc.IDToken) (models.User, int, string) {
+	if identity, found := models.GetIdentity(provider, idToken.Subject); found {
+		user, found := models.GetUserByID(identity.UserID)
+		if !found {
+			return models.User{}, http.StatusUnauthorized, "Sign-in failed"
+		}
+		return user, http.StatusOK, ""
+	}
+
+	if idToken.Email == "" {
+		return models.User{}, http.StatusBadRequest, "The identity provider did not return an email address"
+	}
+
+	user, found := models.GetUserByEmail(idToken.Email)
+	if found && (!idToken.EmailVerified || !user.EmailVerified) {
+		// Anyone could claim this address at the provider, or have
+		// registered it here before its owner
+		return models.User{}, http.StatusConflict, "An account with this email exists; sign in and link the identity"
+	}
+	if !found {
+		if !utils.EnvBool("OIDC_AUTO_REGISTER", true) {
+			return models.User{}, http.StatusForbidden, "No account is linked to this identity"
+		}
+		// SSO users get a random password nobody knows
+		password, _ := tokens.NewOpaqueToken()
+		newUser := models.User{Email: idToken.Email, Password: password, EmailVerified: idToken.EmailVerified}
+		if idToken.EmailVerified {
+			now := time.Now()
+			newUser.EmailVerifiedAt = &now
+		}
+		created, err := models.AddUser(newUser)
+		if err != nil {
+			return models.User{}, http.StatusInternalServerError, "Error creating user"
+		}
+		user = created
+	}
+
+	if _, err := models.LinkIdentity(user.ID, provider, idToken.Subject, idToken.Email); err != nil {
+		return models.User{}, http.StatusInternalServerError, "Error linking identity"
+	}
+	return user, http.StatusOK, ""
+}
+
+// ListIdentities godoc
+// @Summary List linked identities
+// @Description List the external identities linked to the authenticated user.
+// @Tags oidc
+// @Produce json
+// @Success 200 {array} models.Identity "Identities"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /users/me/identities [get]
+func ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	identities := models.GetIdentities(userIDUint)
+	if identities == nil {
+		identities = []models.Identity{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// LinkIdentity godoc
+// @Summary Start linking an identity
+// @Description Return the provider URL to open in the browser. After signing in there, the identity is linked to the authenticated user.
+// @Tags oidc
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} map[string]string "Authorization URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Unknown identity provider"
+// @Security BearerAuth
+// @Router /users/me/identities/{provider} [post]
+func LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	provider, ok := lookupProvider(w, r)
+	if !ok {
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	authURL, ok := startOIDC(w, r, provider, userIDUint)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"authorization_url": authURL})
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink an identity
+// @Description Remove an external identity from the authenticated user. The last identity cannot be removed while password login is disabled.
+// @Tags oidc
+// @Produce json
+// @Param id path int true "Identity ID"
+// @Success 200 {object} models.Identity "Unlinked identity"
+// @Failure 400 {string} string "Invalid Identity ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Identity Not Found"
+// @Failure 409 {string} string "Last identity"
+// @Security BearerAuth
+// @Router /users/me/identities/{id} [delete]
+func UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Identity ID", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !passwordLoginEnabled() && len(models.GetIdentities(userIDUint)) == 1 {
+		http.Error(w, "Cannot unlink the only way to sign in", http.StatusConflict)
+		return
+	}
+
+	identity, found := models.UnlinkIdentity(uint(id), userIDUint)
+	if !found {
+		http.Error(w, "Identity Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identity)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/mailer"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/password"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// acceptablePassword answers 400 Bad Request with the rules the new password
+// failed when it does not follow the password policy.
+func acceptablePassword(w http.ResponseWriter, plain, email string) bool {
+	err := password.Default().Check(plain, email)
+	var rejected *password.ValidationError
+	if errors.As(err, &rejected) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      "Password does not meet the requirements",
+			"violations": rejected.Violations,
+		})
+		return false
+	}
+	return true
+}
+
+// forgotPasswordRequest is the body expected by ForgotPassword.
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use, time-limited password reset token to the user. The response is the same, and takes as long, whether or not the email belongs to an account; the email is sent in the background. Requests are throttled per email and per client IP address.
+// @Tags users
+// @Accept json
+// @Param request body forgotPasswordRequest true "Account email"
+// @Success 202 "Reset email sent if the account exists"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 429 {string} string "Too many requests, see Retry-After"
+// @Router /users/password/forgot [post]
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if !requirePasswordLogin(w) {
+		return
+	}
+
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	if resetThrottled(w, r, req.Email) {
+		return
+	}
+	recordResetRequest(r, req.Email)
+
+	// Only the background work depends on whether the account exists
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		user, found := models.GetUserByEmail(req.Email)
+		if !found {
+			return
+		}
+		if err := sendPasswordReset(ctx, user); err != nil {
+			slog.Error("Failed to send password reset", "user_id", user.ID, "error", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset creates a reset token for user and emails it.
+func sendPasswordReset(ctx context.Context, user models.User) error {
+	token, hash := tokens.NewOpaqueToken()
+	ttl := utils.EnvDuration("PASSWORD_RESET_TTL", time.Hour)
+	if _, err := models.AddOneTimeToken(user.ID, models.PurposePasswordReset, hash, time.Now().Add(ttl)); err != nil {
+		return err
+	}
+
+	link := utils.Env("PASSWORD_RESET_URL", "http://localhost:8080/users/password/reset") + "?token=" + url.QueryEscape(token)
+	return mailer.Default().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Someone asked to reset the password of your Todo List account.\n\n" +
+			"Use this link within " + ttl.String() + " to choose a new password:\n" + link + "\n\n" +
+			"Reset token: " + token + "\n\n" +
+			"If this wasn't you, you can ignore this email.\n",
+	})
+}
+
+// resetPasswordRequest is the body expected by ResetPassword.
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ResetPassword godoc
+// @Summary Reset a forgotten password
+// @Description Set a new password with a token from the reset email. The token works once; it is not used up by a password the policy rejects. All existing sessions of the user are revoked.
+// @Tags users
+// @Accept json
+// @Param request body resetPasswordRequest true "Reset token and new password"
+// @Success 204 "Password reset"
+// @Failure 400 {string} string "Invalid input, password policy violations or invalid/expired token"
+// @Router /users/password/reset [post]
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if !requirePasswordLogin(w) {
+		return
+	}
+
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.NewPassword == "" {
+		http.Error(w, "token and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	// The token is only used up once the new password is accepted
+	tokenHash := tokens.HashOpaqueToken(req.Token)
+	reset, err := models.GetOneTimeToken(models.PurposePasswordReset, tokenHash)
+	if err != nil {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	user, found := models.GetUserByID(reset.UserID)
+	if !found {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	if !acceptablePassword(w, req.NewPassword, user.Email) {
+		return
+	}
+
+	passwordHash, err := models.HashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Error while hashing the password", http.StatusInternalServerError)
+		return
+	}
+
+	user, err = models.ResetPassword(tokenHash, passwordHash)
+	if errors.Is(err, models.ErrOneTimeTokenInvalid) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error resetting the password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := revokeAllSessions(user.ID); err != nil {
+		http.Error(w, "Error revoking tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// projectRequest is the body of CreateProject and UpdateProject.
+type projectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// decodeProject reads and checks a project request, answering 400 if it is
+// invalid.
+func decodeProject(w http.ResponseWriter, r *http.Request) (projectRequest, bool) {
+	var req projectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// projectParams returns the project ID from the URL and the authenticated
+// user, answering 400 or 401 if either is missing.
+func projectParams(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Project ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	return uint(id), userID, true
+}
+
+// ListProjects godoc
+// @Summary List projects
+// @Description List the projects of the authenticated user by name, with their counts of open and completed tasks. Archived projects are left out unless archived=true.
+// @Tags projects
+// @Produce json
+// @Param archived query bool false "Include archived projects"
+// @Success 200 {array} models.Project "Projects"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /projects [get]
+func ListProjects(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	includeArchived, _ := strconv.ParseBool(r.URL.Query().Get("archived"))
+	projects := models.GetProjects(userID, includeArchived)
+	if projects == nil {
+		projects = []models.Project{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projects)
+}
+
+// CreateProject godoc
+// @Summary Create a project
+// @Description Create a project to group tasks.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param project body projectRequest true "Name and description"
+// @Success 201 {object} models.Project "Created project"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /projects [post]
+func CreateProject(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	req, ok := decodeProject(w, r)
+	if !ok {
+		return
+	}
+
+	project, err := models.AddProject(models.Project{Name: req.Name, Description: req.Description}, userID)
+	if err != nil {
+		http.Error(w, "Error saving project", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(project)
+}
+
+// GetProject godoc
+// @Summary Get a project
+// @Description Get a project of the authenticated user with its task counts.
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project "The requested project"
+// @Failure 400 {string} string "Invalid Project ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /projects/{id} [get]
+func GetProject(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := projectParams(w, r)
+	if !ok {
+		return
+	}
+
+	project, found := models.GetProject(id, userID)
+	if !found {
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// UpdateProject godoc
+// @Summary Update a project
+// @Description Rename a project of the authenticated user or change its description.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param project body projectRequest true "Name and description"
+// @Success 200 {object} models.Project "Updated project"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /projects/{id} [put]
+func UpdateProject(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := projectParams(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeProject(w, r)
+	if !ok {
+		return
+	}
+
+	project, found := models.UpdateProject(id, userID, req.Name, req.Description)
+	if !found {
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// DeleteProject godoc
+// @Summary Delete a project
+// @Description Delete a project of the authenticated user. Its tasks are kept without a project and move to the default workflow.
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project "Deleted project"
+// @Failure 400 {string} string "Invalid Project ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /projects/{id} [delete]
+func DeleteProject(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := projectParams(w, r)
+	if !ok {
+		return
+	}
+
+	project, found := models.DeleteProject(id, userID)
+	if !found {
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// ArchiveProject godoc
+// @Summary Archive a project
+// @Description Archive a project of the authenticated user. Archived projects keep their tasks but take no new ones.
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project "Archived project"
+// @Failure 400 {string} string "Invalid Project ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /projects/{id}/archive [post]
+func ArchiveProject(w http.ResponseWriter, r *http.Request) {
+	setProjectArchived(w, r, true)
+}
+
+// UnarchiveProject godoc
+// @Summary Restore an archived project
+// @Description Restore an archived project of the authenticated user.
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project "Restored project"
+// @Failure 400 {string} string "Invalid Project ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /projects/{id}/unarchive [post]
+func UnarchiveProject(w http.ResponseWriter, r *http.Request) {
+	setProjectArchived(w, r, false)
+}
+
+func setProjectArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id, userID, ok := projectParams(w, r)
+	if !ok {
+		return
+	}
+
+	project, found := models.ArchiveProject(id, userID, archived)
+	if !found {
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// ListProjectTasks godoc
+// @Summary List the tasks of a project
+// @Description List the tasks of a project of the authenticated user. Takes the filters and sort options of GET /tasks.
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.Task "Tasks of the project"
+// @Failure 400 {string} string "Invalid Project ID or filter"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /projects/{id}/tasks [get]
+func ListProjectTasks(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := projectParams(w, r)
+	if !ok {
+		return
+	}
+	if _, found := models.GetProject(id, userID); !found {
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	}
+
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.ProjectID = &id
+
+	tasks := models.FindTasks(userID, filter)
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// CreateProjectTask godoc
+// @Summary Create a task in a project
+// @Description Create a task in a project of the authenticated user, as POST /tasks does. Archived projects take no new tasks.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param task body models.Task true "New task"
+// @Success 201 {object} models.Task "Created task"
+// @Failure 400 {string} string "Invalid input, or unknown or archived project"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "Column is at its work-in-progress limit"
+// @Security BearerAuth
+// @Router /projects/{id}/tasks [post]
+func CreateProjectTask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Project ID", http.StatusBadRequest)
+		return
+	}
+	projectID := uint(id)
+	createTask(w, r, &projectID)
+}
+
+// GetProjectWorkflow godoc
+// @Summary Get the workflow of a project
+// @Description Get the statuses, allowed transitions and done statuses of a project's tasks. Projects without their own workflow use todo, doing and done with any change allowed.
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Workflow "Workflow"
+// @Failure 400 {string} string "Invalid Project ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Security BearerAuth
+// @Router /projects/{id}/workflow [get]
+func GetProjectWorkflow(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := projectParams(w, r)
+	if !ok {
+		return
+	}
+	if _, found := models.GetProject(id, userID); !found {
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.WorkflowFor(models.DB, &id))
+}
+
+// SetProjectWorkflow godoc
+// @Summary Change the workflow of a project
+// @Description Replace the workflow of a project, or restore the default one with a null body. statuses are in board order and tasks start in the first; transitions maps each status to the statuses it may move to, and without it any change is allowed; tasks in a done status are completed. Statuses that tasks of the project are in cannot be removed.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param workflow body models.Workflow true "Workflow"
+// @Success 200 {object} models.Project "Updated project"
+// @Failure 400 {string} string "Invalid workflow"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Project Not Found"
+// @Failure 409 {string} string "A removed status is still in use"
+// @Security BearerAuth
+// @Router /projects/{id}/workflow [put]
+func SetProjectWorkflow(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := projectParams(w, r)
+	if !ok {
+		return
+	}
+	var wf *models.Workflow
+	if err := json.NewDecoder(r.Body).Decode(&wf); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if wf != nil {
+		if err := wf.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	project, err := models.SetProjectWorkflow(id, userID, wf)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Project Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrStatusInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Error saving workflow", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
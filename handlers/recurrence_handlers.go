@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/rrule"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// maxPreviewOccurrences caps the count of GetTaskOccurrences.
+const maxPreviewOccurrences = 100
+
+// validateTaskRecurrence checks the recurrence rule and time zone of a task,
+// storing the rule in canonical form, and returns an error message, or ""
+// when they are valid.
+func validateTaskRecurrence(task *models.Task) string {
+	if task.TimeZone != "" {
+		if _, err := time.LoadLocation(task.TimeZone); err != nil {
+			return "Unknown time zone " + task.TimeZone
+		}
+	}
+	if task.Recurrence == "" {
+		return ""
+	}
+	if task.DueAt == nil {
+		return "recurrence needs a due_at"
+	}
+	rule, err := rrule.Parse(task.Recurrence)
+	if err != nil {
+		return "Invalid recurrence: " + err.Error()
+	}
+	task.Recurrence = rule.String()
+	return ""
+}
+
+// GetTaskOccurrences godoc
+// @Summary Preview the next occurrences of a recurring task
+// @Description List the due dates of the occurrences that follow a recurring task, in the task's time zone. Tasks that do not repeat have none.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param count query int false "Number of occurrences, default 5, at most 100"
+// @Success 200 {array} string "Due dates (RFC 3339)"
+// @Failure 400 {string} string "Invalid Task ID or count"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/occurrences [get]
+func GetTaskOccurrences(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	count := 5
+	if v := r.URL.Query().Get("count"); v != "" {
+		count, err = strconv.Atoi(v)
+		if err != nil || count < 1 || count > maxPreviewOccurrences {
+			http.Error(w, "count must be between 1 and "+strconv.Itoa(maxPreviewOccurrences), http.StatusBadRequest)
+			return
+		}
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	task, found := models.GetTaskByID(uint(id), userID)
+	if !found {
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+		return
+	}
+	occurrences := task.UpcomingOccurrences(count)
+	if occurrences == nil {
+		occurrences = []time.Time{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(occurrences)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/mailer"
+	"github.com/youssef-abbih/go-todo-list/models"
+)
+
+// SendDueReminders emails the reminders whose time has come and returns how
+// many were sent. A reminder is claimed before it is sent, so instances
+// running side by side never send it twice; one that fails to send is not
+// retried.
+func SendDueReminders(ctx context.Context) (int, error) {
+	sent := 0
+	for _, task := range models.GetDueReminders(time.Now()) {
+		if !models.ClaimReminder(task.ID) {
+			continue
+		}
+		err := mailer.Default().Send(ctx, mailer.Message{
+			To:      task.User.Email,
+			Subject: "Reminder: " + task.Title,
+			Body: "Your task \"" + task.Title + "\" is due at " +
+				task.DueAt.UTC().Format("Mon, 02 Jan 2006 15:04 MST") + ".\n\n" +
+				task.Description + "\n",
+		})
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// StartReminders sends due reminders every interval until ctx is cancelled.
+func StartReminders(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := SendDueReminders(ctx); err != nil {
+					slog.Error("Failed to send task reminders", "error", err)
+				}
+			}
+		}
+	}()
+}
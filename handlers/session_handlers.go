@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// sessionResponse is a session as listed to its user.
+type sessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// deviceName names the device of a login: the X-Device-Name header if the
+// client sent one, otherwise the browser and OS read from the User-Agent.
+func deviceName(r *http.Request) string {
+	if name := strings.TrimSpace(r.Header.Get("X-Device-Name")); name != "" {
+		return truncate(name, 100)
+	}
+
+	ua := r.UserAgent()
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	platform := ""
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Android", "Android"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			platform = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ListSessions godoc
+// @Summary List login sessions
+// @Description List the active login sessions of the authenticated user with their device, IP address and last activity. The session of the calling token is marked current. Last-seen times are recorded in batches and may lag by a few seconds.
+// @Tags sessions
+// @Produce json
+// @Success 200 {array} sessionResponse "Sessions"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /users/me/sessions [get]
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "user not authorized", http.StatusUnauthorized)
+		return
+	}
+	userIDUint, err := claims.UserID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessions := models.GetSessions(userIDUint)
+	response := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = sessionResponse{Session: session, Current: session.FamilyID == claims.SessionID}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a login session
+// @Description Sign out one of the authenticated user's sessions, e.g. a lost device. Its refresh token and access tokens stop working immediately.
+// @Tags sessions
+// @Produce json
+// @Param id path int true "Session ID"
+// @Success 200 {object} models.Session "Revoked session"
+// @Failure 400 {string} string "Invalid Session ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Session Not Found"
+// @Security BearerAuth
+// @Router /users/me/sessions/{id} [delete]
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Session ID", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, found := models.RevokeSession(uint(id), userIDUint, time.Now().Add(tokens.Default().MaxAge()))
+	if !found {
+		http.Error(w, "Session Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// maxTaskDepth is how many levels of subtasks a top-level task may have.
+func maxTaskDepth() int {
+	return utils.EnvInt("TASK_MAX_DEPTH", 3)
+}
+
+// validateTaskParent checks the parent of a task and returns an error
+// message, or "" when it is valid. taskID is 0 for new tasks.
+func validateTaskParent(task models.Task, userID, taskID uint) string {
+	if task.ParentID == nil {
+		return ""
+	}
+	err := models.ValidateParent(taskID, *task.ParentID, userID, maxTaskDepth())
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, models.ErrTaskTooDeep):
+		return "Subtasks can be nested at most " + strconv.Itoa(maxTaskDepth()) + " levels deep"
+	default:
+		return err.Error()
+	}
+}
+
+// GetTaskChildren godoc
+// @Summary List the subtasks of a task
+// @Description List the direct subtasks of a task of the authenticated user, in their manual order.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {array} models.Task "Subtasks"
+// @Failure 400 {string} string "Invalid Task ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/children [get]
+func GetTaskChildren(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	children, found := models.GetChildren(uint(id), userID)
+	if !found {
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+		return
+	}
+	if children == nil {
+		children = []models.Task{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(children)
+}
+
+// GetTaskTree godoc
+// @Summary Get a task with all its subtasks
+// @Description Get a task of the authenticated user with its subtasks at every depth, nested under children.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.TaskTree "Task tree"
+// @Failure 400 {string} string "Invalid Task ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/tree [get]
+func GetTaskTree(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tree, found := models.GetTaskTree(uint(id), userID)
+	if !found {
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// defaultTagColor is used for tags created without a color.
+const defaultTagColor = "#808080"
+
+var tagColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// tagRequest is the body of CreateTag and UpdateTag.
+type tagRequest struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// validTag normalizes and checks a tag request, answering 400 if it is invalid.
+func validTag(w http.ResponseWriter, req *tagRequest) bool {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Color == "" {
+		req.Color = defaultTagColor
+	}
+	switch {
+	case req.Name == "":
+		http.Error(w, "name is required", http.StatusBadRequest)
+	case len(req.Name) > 50 || strings.Contains(req.Name, ","):
+		http.Error(w, "name must be at most 50 characters and contain no commas", http.StatusBadRequest)
+	case !tagColor.MatchString(req.Color):
+		http.Error(w, "color must be a hex color like #1e90ff", http.StatusBadRequest)
+	default:
+		req.Color = strings.ToLower(req.Color)
+		return true
+	}
+	return false
+}
+
+// writeTagError maps tag errors to responses. It returns true when err is nil.
+func writeTagError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Tag Not Found", http.StatusNotFound)
+	case errors.Is(err, models.ErrTagExists):
+		http.Error(w, "Tag already exists", http.StatusConflict)
+	default:
+		http.Error(w, "Error saving tag", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// ListTags godoc
+// @Summary List tags
+// @Description List the tags of the authenticated user by name.
+// @Tags tags
+// @Produce json
+// @Success 200 {array} models.Tag "Tags"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /tags [get]
+func ListTags(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GetTags(userID))
+}
+
+// CreateTag godoc
+// @Summary Create a tag
+// @Description Create a tag with a name, unique per user, and an optional hex color.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tag body tagRequest true "Name and color"
+// @Success 201 {object} models.Tag "Created tag"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "Tag already exists"
+// @Security BearerAuth
+// @Router /tags [post]
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !validTag(w, &req) {
+		return
+	}
+
+	tag, err := models.AddTag(models.Tag{Name: req.Name, Color: req.Color}, userID)
+	if !writeTagError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// UpdateTag godoc
+// @Summary Update a tag
+// @Description Rename or recolor a tag of the authenticated user.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param tag body tagRequest true "Name and color"
+// @Success 200 {object} models.Tag "Updated tag"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Tag Not Found"
+// @Failure 409 {string} string "Tag already exists"
+// @Security BearerAuth
+// @Router /tags/{id} [put]
+func UpdateTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Tag ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !validTag(w, &req) {
+		return
+	}
+
+	tag, err := models.UpdateTag(uint(id), userID, req.Name, req.Color)
+	if !writeTagError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag godoc
+// @Summary Delete a tag
+// @Description Delete a tag of the authenticated user and remove it from all tasks.
+// @Tags tags
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 200 {object} models.Tag "Deleted tag"
+// @Failure 400 {string} string "Invalid Tag ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Tag Not Found"
+// @Security BearerAuth
+// @Router /tags/{id} [delete]
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Tag ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tag, found := models.DeleteTag(uint(id), userID)
+	if !found {
+		http.Error(w, "Tag Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// attachTagsRequest is the body of AttachTaskTags.
+type attachTagsRequest struct {
+	TagIDs []uint `json:"tag_ids"`
+}
+
+// AttachTaskTags godoc
+// @Summary Tag a task
+// @Description Attach tags of the authenticated user to one of their tasks. Tags that are already attached are kept.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param tags body attachTagsRequest true "Tag IDs"
+// @Success 200 {object} models.Task "Task with its tags"
+// @Failure 400 {string} string "Invalid Task ID or JSON"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task or Tag Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/tags [post]
+func AttachTaskTags(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req attachTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.TagIDs) == 0 {
+		http.Error(w, "tag_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	task, ok := models.AttachTags(uint(id), userID, req.TagIDs)
+	if !ok {
+		http.Error(w, "Task or Tag Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// DetachTaskTag godoc
+// @Summary Untag a task
+// @Description Remove a tag from one of the authenticated user's tasks.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param tagID path int true "Tag ID"
+// @Success 200 {object} models.Task "Task with its remaining tags"
+// @Failure 400 {string} string "Invalid Task or Tag ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task or Tag Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/tags/{tagID} [delete]
+func DetachTaskTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	tagID, err := strconv.Atoi(chi.URLParam(r, "tagID"))
+	if err != nil || tagID <= 0 {
+		http.Error(w, "Invalid Tag ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	task, ok := models.DetachTag(uint(id), uint(tagID), userID)
+	if !ok {
+		http.Error(w, "Task or Tag Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
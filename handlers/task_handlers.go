@@ -2,22 +2,182 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/youssef-abbih/go-todo-list/utils"
 	"github.com/youssef-abbih/go-todo-list/models"
-	
+	"gorm.io/gorm"
 )
 
+// maxReminderMinutes caps how long before the due date a reminder may fire.
+const maxReminderMinutes = 28 * 24 * 60
+
+// validateTaskSchedule checks the dates, reminder and priority of a task and
+// returns an error message, or "" when they are valid.
+func validateTaskSchedule(task models.Task) string {
+	if task.Priority < models.PriorityNone || task.Priority > models.PriorityHigh {
+		return "priority must be between 0 (none) and 3 (high)"
+	}
+	if task.StartAt != nil && task.DueAt != nil && task.StartAt.After(*task.DueAt) {
+		return "start_at must not be after due_at"
+	}
+	if task.ReminderMinutes != nil {
+		if task.DueAt == nil {
+			return "reminder_minutes needs a due_at"
+		}
+		if *task.ReminderMinutes < 0 || *task.ReminderMinutes > maxReminderMinutes {
+			return "reminder_minutes must be between 0 and " + strconv.Itoa(maxReminderMinutes)
+		}
+	}
+	return ""
+}
+
+// validateTaskProject checks that the project of a task is one of the user's
+// projects and returns an error message, or "" when it is valid. Archived
+// projects take no new tasks, but the tasks already in them can be edited;
+// taskID is 0 for new tasks.
+func validateTaskProject(task models.Task, userID, taskID uint) string {
+	if task.ProjectID == nil {
+		return ""
+	}
+	project, ok := models.GetProject(*task.ProjectID, userID)
+	if !ok {
+		return "project_id must be one of your projects"
+	}
+	if project.Archived() {
+		existing, ok := models.GetTaskByID(taskID, userID)
+		if taskID == 0 || !ok || existing.ProjectID == nil || *existing.ProjectID != project.ID {
+			return "Project is archived"
+		}
+	}
+	return ""
+}
+
+// writeTaskError maps the errors of task updates to responses. It returns
+// true when err is nil.
+func writeTaskError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+	case errors.Is(err, models.ErrStatusUnknown):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrStatusTransition), errors.Is(err, models.ErrWIPLimit), errors.Is(err, models.ErrTaskBlocked):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Error saving task", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// dueRange returns the start and end of the calendar period named by due
+// ("today" or "week", weeks starting on Monday) around now, in now's time
+// zone. Days are computed on the calendar, so days with a DST change are
+// 23 or 25 hours long.
+func dueRange(due string, now time.Time) (time.Time, time.Time, bool) {
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch due {
+	case "today":
+		return start, start.AddDate(0, 0, 1), true
+	case "week":
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// parseTaskFilter reads the list filters of GET /tasks. due names a period
+// of its own and cannot be combined with due_after or due_before.
+func parseTaskFilter(r *http.Request) (models.TaskFilter, error) {
+	var filter models.TaskFilter
+	q := r.URL.Query()
+
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return filter, errors.New("Unknown time zone " + tz)
+		}
+	}
+
+	if q.Get("due") != "" && (q.Get("due_after") != "" || q.Get("due_before") != "") {
+		return filter, errors.New("due cannot be combined with due_after or due_before")
+	}
+	switch due := q.Get("due"); due {
+	case "":
+	case "overdue":
+		filter.Overdue = true
+	default:
+		from, before, ok := dueRange(due, time.Now().In(loc))
+		if !ok {
+			return filter, errors.New("due must be overdue, today or week")
+		}
+		filter.DueFrom, filter.DueBefore = &from, &before
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		if !models.ValidTaskSort(sort) {
+			return filter, errors.New("sort must be position, priority, due or created")
+		}
+		filter.Sort = sort
+	}
+	switch order := q.Get("order"); order {
+	case "", "asc", "desc":
+		filter.Order = order
+	default:
+		return filter, errors.New("order must be asc or desc")
+	}
+
+	if tags := q.Get("tags"); tags != "" {
+		for _, name := range strings.Split(tags, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.Tags = append(filter.Tags, name)
+			}
+		}
+	}
+	filter.Status = q.Get("status")
+
+	switch match := q.Get("tag_match"); match {
+	case "", models.TagMatchAny, models.TagMatchAll:
+		filter.TagMatch = match
+	default:
+		return filter, errors.New("tag_match must be any or all")
+	}
+
+	for param, target := range map[string]**time.Time{"due_after": &filter.DueFrom, "due_before": &filter.DueBefore} {
+		if v := q.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, errors.New(param + " must be an RFC 3339 timestamp")
+			}
+			*target = &t
+		}
+	}
+	return filter, nil
+}
+
 // GetTasks godoc
 // @Summary Retrieve all tasks for the authenticated user
-// @Description Get a list of all tasks for the currently authenticated user, based on the JWT token.
+// @Description Get a list of all tasks for the currently authenticated user, based on the JWT token. Filter by due date with due=overdue, today or week (in the time zone tz, default UTC, weeks start on Monday), or with due_after and due_before; due cannot be combined with the other two. tags lists tag names; tasks match if they have any of them, or all with tag_match=all. status keeps the tasks in one workflow status. Tasks are in their manual order unless sort is set; priority and created sort newest and highest first, position and due ascending (tasks without a due date last), and order overrides the direction.
 // @Tags tasks
 // @Produce json
+// @Param due query string false "overdue, today or week"
+// @Param tz query string false "IANA time zone for today and week, e.g. Europe/Berlin"
+// @Param due_after query string false "Due at or after (RFC 3339)"
+// @Param due_before query string false "Due before (RFC 3339)"
+// @Param tags query string false "Comma-separated tag names"
+// @Param tag_match query string false "any (default) or all of the tags"
+// @Param status query string false "Workflow status"
+// @Param sort query string false "position, priority, due or created"
+// @Param order query string false "asc or desc"
 // @Success 200 {array} models.Task "List of tasks"
+// @Failure 400 {string} string "Invalid filter"
 // @Failure 401 {string} string "Unauthorized"
 // @Security BearerAuth
 // @Router /tasks [get]
@@ -34,8 +194,14 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 3. Fetch tasks for this user only
-	tasks := models.GetTasks(userIDUint)
+	tasks := models.FindTasks(userIDUint, filter)
 
 	// 4. Return tasks as JSON
 	w.Header().Set("Content-Type", "application/json")
@@ -48,7 +214,7 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 
 // PostTask godoc
 // @Summary Create a new task
-// @Description Create and store a new task for the authenticated user.
+// @Description Create and store a new task for the authenticated user. start_at and due_at are RFC 3339 timestamps with a UTC offset; reminder_minutes schedules an email that many minutes before due_at. parent_id makes the task a subtask of another task. recurrence is an RRULE (DAILY, WEEKLY with BYDAY, MONTHLY with BYMONTHDAY, INTERVAL, COUNT, UNTIL) expanded from due_at in time_zone. status is a status of the project's workflow; without it the task starts in the first status, or the done one if completed is set.
 // @Tags tasks
 // @Accept json
 // @Produce json
@@ -56,6 +222,7 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 // @Success 201 {object} models.Task "Created task"
 // @Failure 400 {string} string "Invalid input"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "Column is at its work-in-progress limit"
 // @Security BearerAuth
 // @Router /tasks [post]
 func PostTask(w http.ResponseWriter, r *http.Request) {
@@ -64,18 +231,37 @@ func PostTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	createTask(w, r, nil)
+}
+
+// createTask creates a task from the request body, in the given project if
+// projectID is set.
+func createTask(w http.ResponseWriter, r *http.Request, projectID *uint) {
 	var newTask models.Task
 	err := json.NewDecoder(r.Body).Decode(&newTask)
 	if err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if projectID != nil {
+		newTask.ProjectID = projectID
+	}
 
 	if strings.TrimSpace(newTask.Title) == "" || strings.TrimSpace(newTask.Description) == "" {
 		http.Error(w, "Title and description are required", http.StatusBadRequest)
 		return
 	}
 
+	if msg := validateTaskSchedule(newTask); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if msg := validateTaskRecurrence(&newTask); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
 	userIDUint, err := utils.GetUserID(r)
 
 	if err != nil {
@@ -83,7 +269,25 @@ func PostTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	created := models.AddTask(newTask, userIDUint)
+	if msg := validateTaskParent(newTask, userIDUint, 0); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if msg := validateTaskProject(newTask, userIDUint, 0); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if newTask.Status != "" && !models.WorkflowFor(models.DB, newTask.ProjectID).Has(newTask.Status) {
+		http.Error(w, "status is not part of the workflow", http.StatusBadRequest)
+		return
+	}
+
+	created, err := models.AddTask(newTask, userIDUint)
+	if !writeTaskError(w, err) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -135,10 +339,11 @@ func GetTask(w http.ResponseWriter, r *http.Request) {
 
 /// DeleteTask godoc
 // @Summary Delete task by ID
-// @Description Delete a task by ID, if it belongs to the authenticated user.
+// @Description Delete a task by ID with all its subtasks, if it belongs to the authenticated user. Deleted tasks go to the trash, from which they can be restored until they are purged; permanent=true deletes a task, in the trash or not, for good.
 // @Tags tasks
 // @Produce json
 // @Param id path int true "Task ID"
+// @Param permanent query bool false "Delete for good instead of moving to the trash"
 // @Success 200 {object} models.Task "Deleted task"
 // @Failure 400 {string} string "Invalid Task ID"
 // @Failure 401 {string} string "Unauthorized"
@@ -166,7 +371,11 @@ func DeleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deleted, found := models.DeleteTask(idUint, userIDUint)
+	deleteTask := models.DeleteTask
+	if permanent, _ := strconv.ParseBool(r.URL.Query().Get("permanent")); permanent {
+		deleteTask = models.PurgeTask
+	}
+	deleted, found := deleteTask(idUint, userIDUint)
 	if !found {
 		http.Error(w, "Task Not Found", http.StatusNotFound)
 		return
@@ -178,16 +387,18 @@ func DeleteTask(w http.ResponseWriter, r *http.Request) {
 
 // PutTask godoc
 // @Summary Update task by ID
-// @Description Update an existing task by ID, if it belongs to the authenticated user.
+// @Description Update an existing task by ID, if it belongs to the authenticated user. status must be a status of the project's workflow that the task may move to; without a status change, setting completed moves the task to the workflow's done status or back to its first one. Completing a task completes its subtasks and creates the next occurrence of a recurring task; reopening a subtask reopens its ancestors. The update is rejected if a subtask or ancestor cannot follow under its own workflow. A task, or a subtask completed with it, with open blockers cannot be completed unless force=true.
 // @Tags tasks
 // @Accept json
 // @Produce json
 // @Param id path int true "Task ID"
 // @Param task body models.Task true "Updated task data"
+// @Param force query bool false "Complete the task and its subtasks even if they are blocked"
 // @Success 200 {object} models.Task "Updated task"
-// @Failure 400 {string} string "Invalid Task ID or JSON"
+// @Failure 400 {string} string "Invalid Task ID, JSON or status"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Task Not Found"
+// @Failure 409 {string} string "Status change not allowed by the workflow, column full, or task blocked"
 // @Security BearerAuth
 // @Router /tasks/{id} [put]
 func PutTask(w http.ResponseWriter, r *http.Request) {
@@ -198,7 +409,7 @@ func PutTask(w http.ResponseWriter, r *http.Request) {
 
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
-	if err != nil {
+	if err != nil || id <= 0 {
 		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
 		return
 	}
@@ -215,6 +426,16 @@ func PutTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if msg := validateTaskSchedule(updatedTask); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if msg := validateTaskRecurrence(&updatedTask); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
 	idUint := uint(id)
 	userIDUint, err := utils.GetUserID(r)
 
@@ -223,12 +444,83 @@ func PutTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, ok := models.UpdateTask(idUint, userIDUint, updatedTask)
-	if !ok {
-		http.Error(w, "Task Not Found", http.StatusNotFound)
+	if msg := validateTaskParent(updatedTask, userIDUint, idUint); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if msg := validateTaskProject(updatedTask, userIDUint, idUint); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	result, err := models.UpdateTask(idUint, userIDUint, updatedTask, force)
+	if !writeTaskError(w, err) {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
-}
\ No newline at end of file
+}
+// moveTaskRequest names the task to place the moved task next to.
+type moveTaskRequest struct {
+	Before uint `json:"before"`
+	After  uint `json:"after"`
+}
+
+// MoveTask godoc
+// @Summary Reorder a task
+// @Description Move a task directly before or after another task of the user in the manual order. Exactly one of before and after must be set.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param move body moveTaskRequest true "Task to move next to"
+// @Success 200 {object} models.Task "Moved task"
+// @Failure 400 {string} string "Invalid Task ID or JSON"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Security BearerAuth
+// @Router /tasks/{id}/move [post]
+func MoveTask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+
+	var req moveTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if (req.Before == 0) == (req.After == 0) {
+		http.Error(w, "Exactly one of before and after is required", http.StatusBadRequest)
+		return
+	}
+	target := req.Before + req.After
+	if target == uint(id) {
+		http.Error(w, "A task cannot be moved next to itself", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	task, err := models.MoveTask(uint(id), target, userID, req.After != 0)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Error moving task", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/youssef-abbih/go-todo-list/models"
 )
@@ -173,3 +174,34 @@ func TestDeleteTask(t *testing.T) {
 		t.Errorf("expected 400 Bad Request, got %d", res.Code)
 	}
 }
+
+// Test the calendar periods of the due filter around a DST change
+func TestDueRange(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	// 2024-03-31 has 23 hours in Berlin: clocks skip from 02:00 to 03:00.
+	now := time.Date(2024, 3, 31, 15, 0, 0, 0, berlin)
+	from, before, ok := dueRange("today", now)
+	if !ok {
+		t.Fatal("expected today to be a valid period")
+	}
+	if !from.Equal(time.Date(2024, 3, 31, 0, 0, 0, 0, berlin)) || !before.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, berlin)) {
+		t.Errorf("unexpected today range %s - %s", from, before)
+	}
+	if d := before.Sub(from); d != 23*time.Hour {
+		t.Errorf("expected a 23 hour day, got %s", d)
+	}
+
+	// Sunday belongs to the week that started on Monday 2024-03-25.
+	from, before, _ = dueRange("week", now)
+	if !from.Equal(time.Date(2024, 3, 25, 0, 0, 0, 0, berlin)) || !before.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, berlin)) {
+		t.Errorf("unexpected week range %s - %s", from, before)
+	}
+
+	if _, _, ok := dueRange("month", now); ok {
+		t.Errorf("expected an unknown period to be rejected")
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// createTokenRequest is the body expected by CreatePersonalAccessToken.
+type createTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// ListPersonalAccessTokens godoc
+// @Summary List personal access tokens
+// @Description List the active personal access tokens of the authenticated user, with their scopes and last-used timestamps. Token values are never returned.
+// @Tags tokens
+// @Produce json
+// @Success 200 {array} models.PersonalAccessToken "Tokens"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /users/me/tokens [get]
+func ListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	pats := models.GetPersonalAccessTokens(userIDUint)
+	if pats == nil {
+		pats = []models.PersonalAccessToken{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pats)
+}
+
+// CreatePersonalAccessToken godoc
+// @Summary Create a personal access token
+// @Description Mint a named, scoped token for scripts and CI. The token value is only returned in this response. Scopes cannot exceed those of the token used to create it.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Param token body createTokenRequest true "Name, scopes and optional expiry"
+// @Success 201 {object} map[string]interface{} "Created token including its value"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Scope not allowed"
+// @Security BearerAuth
+// @Router /users/me/tokens [post]
+func CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		http.Error(w, "name and scopes are required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, "expires_in_days cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "user not authorized", http.StatusUnauthorized)
+		return
+	}
+	userIDUint, err := claims.UserID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !tokens.ValidScope(scope) {
+			http.Error(w, "Unknown scope "+scope, http.StatusBadRequest)
+			return
+		}
+		if !claims.HasScope(scope) {
+			http.Error(w, "Cannot grant scope "+scope, http.StatusForbidden)
+			return
+		}
+	}
+
+	random, _ := tokens.NewOpaqueToken()
+	value := tokens.PersonalAccessTokenPrefix + random
+	hash := tokens.HashOpaqueToken(value)
+
+	pat := models.PersonalAccessToken{
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    value[:len(tokens.PersonalAccessTokenPrefix)+4],
+		TokenHash: hash,
+		Scopes:    req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	created, err := models.AddPersonalAccessToken(pat, userIDUint)
+	if err != nil {
+		http.Error(w, "Error saving token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         created.ID,
+		"name":       created.Name,
+		"prefix":     created.Prefix,
+		"scopes":     created.Scopes,
+		"expires_at": created.ExpiresAt,
+		"created_at": created.CreatedAt,
+		"token":      value,
+	})
+}
+
+// RevokePersonalAccessToken godoc
+// @Summary Revoke a personal access token
+// @Description Revoke one of the authenticated user's personal access tokens.
+// @Tags tokens
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} models.PersonalAccessToken "Revoked token"
+// @Failure 400 {string} string "Invalid Token ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Token Not Found"
+// @Security BearerAuth
+// @Router /users/me/tokens/{id} [delete]
+func RevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Token ID", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	revoked, found := models.RevokePersonalAccessToken(uint(id), userIDUint)
+	if !found {
+		http.Error(w, "Token Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revoked)
+}
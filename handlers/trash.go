@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// trashRetention is how long deleted tasks stay in the trash.
+func trashRetention() time.Duration {
+	return utils.EnvDuration("TRASH_RETENTION", 30*24*time.Hour)
+}
+
+// StartTrashPurge deletes for good the tasks that have been in the trash
+// longer than TRASH_RETENTION, every interval until ctx is cancelled.
+func StartTrashPurge(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := models.PurgeTrash(time.Now().Add(-trashRetention()))
+				if err != nil {
+					slog.Error("Failed to purge deleted tasks", "error", err)
+				} else if purged > 0 {
+					slog.Info("Purged deleted tasks", "count", purged)
+				}
+			}
+		}
+	}()
+}
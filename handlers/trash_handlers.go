@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// ListTrash godoc
+// @Summary List deleted tasks
+// @Description List the deleted tasks of the authenticated user, most recently deleted first, with the time each one is purged for good.
+// @Tags tasks
+// @Produce json
+// @Success 200 {array} models.TrashedTask "Deleted tasks"
+// @Failure 401 {string} string "Unauthorized"
+// @Security BearerAuth
+// @Router /tasks/trash [get]
+func ListTrash(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GetTrash(userID, trashRetention()))
+}
+
+// RestoreTask godoc
+// @Summary Restore a deleted task
+// @Description Take a deleted task of the authenticated user out of the trash, with the subtasks that were deleted along with it. A subtask can only be restored once its parent is, and tasks only fit back into board columns with room under their work-in-progress limits.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.Task "Restored task"
+// @Failure 400 {string} string "Invalid Task ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Task Not Found"
+// @Failure 409 {string} string "Parent task is deleted, or column is at its work-in-progress limit"
+// @Security BearerAuth
+// @Router /tasks/{id}/restore [post]
+func RestoreTask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	task, err := models.RestoreTask(uint(id), userID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Task Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrParentDeleted), errors.Is(err, models.ErrWIPLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Error restoring task", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userResponse is the public representation of a user; it never exposes the password hash.
+func userResponse(user models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                user.ID,
+		"email":             user.Email,
+		"email_verified":    user.EmailVerified,
+		"email_verified_at": user.EmailVerifiedAt,
+		"totp_enabled":      user.TOTPEnabled,
+		"created_at":        user.CreatedAt,
+		"updated_at":        user.UpdatedAt,
+	}
+}
+
+// GetCurrentUser godoc
+// @Summary Get the authenticated user
+// @Description Return the account of the user identified by the JWT token.
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Current user"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /users/me [get]
+func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResponse(user))
+}
+
+// updateUserRequest holds the fields a user may change on their own account.
+type updateUserRequest struct {
+	Email *string `json:"email"`
+}
+
+// PatchCurrentUser godoc
+// @Summary Update the authenticated user
+// @Description Partially update the account of the authenticated user. Only the email can be changed here; a new address must be verified again.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body updateUserRequest true "Fields to update"
+// @Success 200 {object} map[string]interface{} "Updated user"
+// @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User Not Found"
+// @Failure 409 {string} string "Email already in use"
+// @Security BearerAuth
+// @Router /users/me [patch]
+func PatchCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if email == "" {
+			http.Error(w, "email cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if existing, found := models.GetUserByEmail(email); found && existing.ID != user.ID {
+			http.Error(w, "Email already in use", http.StatusConflict)
+			return
+		}
+		if email != user.Email {
+			// The new address has to be verified again
+			user.Email = email
+			user.EmailVerified = false
+			user.EmailVerifiedAt = nil
+		}
+	}
+
+	updated, ok := models.UpdateUser(user.ID, user)
+	if !ok {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	if req.Email != nil && !updated.EmailVerified {
+		if err := sendVerificationEmail(r, updated); err != nil {
+			slog.Error("Failed to send verification email", "user_id", updated.ID, "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResponse(updated))
+}
+
+// changePasswordRequest is the body expected by ChangePassword.
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword godoc
+// @Summary Change the authenticated user's password
+// @Description Replace the password after checking the current one. All existing sessions of the user are revoked.
+// @Tags users
+// @Accept json
+// @Param passwords body changePasswordRequest true "Current and new password"
+// @Success 204 "Password changed"
+// @Failure 400 {string} string "Invalid input or password policy violations"
+// @Failure 401 {string} string "Unauthorized or wrong current password"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /users/me/password [post]
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		http.Error(w, "Invalid current password", http.StatusUnauthorized)
+		return
+	}
+
+	if !acceptablePassword(w, req.NewPassword, user.Email) {
+		return
+	}
+
+	user.Password, err = models.HashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Error while hashing the password", http.StatusInternalServerError)
+		return
+	}
+
+	if _, ok := models.UpdateUser(user.ID, user); !ok {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	// Sessions started with the old password must log in again
+	if err := revokeAllSessions(user.ID); err != nil {
+		http.Error(w, "Error revoking tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteCurrentUser godoc
+// @Summary Delete the authenticated user
+// @Description Delete the account of the authenticated user together with all of their tasks.
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Deleted user"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User Not Found"
+// @Security BearerAuth
+// @Router /users/me [delete]
+func DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	deleted, found := models.DeleteUser(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeAllSessions(deleted.ID); err != nil {
+		http.Error(w, "Error revoking tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResponse(deleted))
+}
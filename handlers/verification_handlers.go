@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/mailer"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// sendVerificationEmail creates a verification token for user and emails it
+// to the user's current address.
+func sendVerificationEmail(r *http.Request, user models.User) error {
+	token, hash := tokens.NewOpaqueToken()
+	ttl := utils.EnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	if _, err := models.AddOneTimeToken(user.ID, models.PurposeEmailVerification, hash, time.Now().Add(ttl)); err != nil {
+		return err
+	}
+
+	link := utils.Env("EMAIL_VERIFICATION_URL", "http://localhost:8080/users/verify") + "?token=" + url.QueryEscape(token)
+	return mailer.Default().Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Please confirm that this is your email address for your Todo List account.\n\n" +
+			"Open this link within " + ttl.String() + ":\n" + link + "\n\n" +
+			"If you didn't create an account, you can ignore this email.\n",
+	})
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirm the email address of an account with the token from the verification email.
+// @Tags users
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} map[string]interface{} "Verified user"
+// @Failure 400 {string} string "Invalid or expired token"
+// @Router /users/verify [get]
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	verification, err := models.ConsumeOneTimeToken(models.PurposeEmailVerification, tokens.HashOpaqueToken(token))
+	if errors.Is(err, models.ErrOneTimeTokenInvalid) {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error checking verification token", http.StatusInternalServerError)
+		return
+	}
+
+	user, found := models.MarkEmailVerified(verification.UserID)
+	if !found {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResponse(user))
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description Send a new verification email to the authenticated user. Earlier verification links stop working.
+// @Tags users
+// @Success 202 "Verification email sent"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {string} string "Email already verified"
+// @Security BearerAuth
+// @Router /users/verify/resend [post]
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userIDUint, err := utils.GetUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, found := models.GetUserByID(userIDUint)
+	if !found {
+		http.Error(w, "User Not Found", http.StatusNotFound)
+		return
+	}
+
+	if user.EmailVerified {
+		http.Error(w, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	if err := sendVerificationEmail(r, user); err != nil {
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,173 @@
+// Package mailer sends the emails of the API, such as password reset and
+// verification links, through a pluggable Mailer.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends messages through an SMTP server.
+type SMTPMailer struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// Send implements Mailer.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := m.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// LogMailer writes messages to the structured log instead of sending them.
+type LogMailer struct{}
+
+// Send implements Mailer.
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.Info("Email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer writes every message as a file in Dir, which tests can read back.
+type FileMailer struct {
+	Dir string
+
+	mu sync.Mutex
+	n  int
+}
+
+// Send implements Mailer.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	m.n++
+	name := fmt.Sprintf("%d-%04d.eml", time.Now().UnixNano(), m.n)
+	m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.Dir, name), format("", msg), 0644)
+}
+
+// Messages returns the messages written so far, oldest first.
+func (m *FileMailer) Messages() ([]Message, error) {
+	files, err := filepath.Glob(filepath.Join(m.Dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	var msgs []Message
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, parse(string(data)))
+	}
+	return msgs, nil
+}
+
+// headerValue strips line breaks so user input cannot inject headers.
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", headerValue.Replace(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue.Replace(msg.Subject))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+// parse reads back a message rendered by format.
+func parse(data string) Message {
+	var msg Message
+	headers, body, _ := strings.Cut(data, "\r\n\r\n")
+	msg.Body = body
+	for _, line := range strings.Split(headers, "\r\n") {
+		key, value, _ := strings.Cut(line, ": ")
+		switch key {
+		case "To":
+			msg.To = value
+		case "Subject":
+			msg.Subject = value
+		}
+	}
+	return msg
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultMailer Mailer
+)
+
+// Default returns the process-wide Mailer selected by the MAILER environment
+// variable: "smtp", "file" or "log" (the default).
+func Default() Mailer {
+	defaultOnce.Do(func() {
+		if defaultMailer != nil {
+			return
+		}
+		_ = godotenv.Load()
+		switch os.Getenv("MAILER") {
+		case "smtp":
+			defaultMailer = &SMTPMailer{
+				Addr:     os.Getenv("SMTP_ADDR"),
+				From:     os.Getenv("SMTP_FROM"),
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+			}
+		case "file":
+			dir := os.Getenv("MAILER_DIR")
+			if dir == "" {
+				dir = "mail"
+			}
+			defaultMailer = &FileMailer{Dir: dir}
+		case "", "log":
+			defaultMailer = LogMailer{}
+		default:
+			log.Fatalf("Unknown MAILER: %s", os.Getenv("MAILER"))
+		}
+	})
+	return defaultMailer
+}
+
+// SetDefault replaces the process-wide Mailer, e.g. in tests.
+func SetDefault(m Mailer) {
+	defaultOnce.Do(func() {})
+	defaultMailer = m
+}
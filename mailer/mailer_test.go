@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	m := &FileMailer{Dir: t.TempDir()}
+
+	sent := []Message{
+		{To: "leon@gmail.com", Subject: "First", Body: "Hello\nLeon"},
+		{To: "youssef@hotmail.com", Subject: "Second", Body: "Hi"},
+	}
+	for _, msg := range sent {
+		if err := m.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send returned error: %v", err)
+		}
+	}
+
+	got, err := m.Messages()
+	if err != nil {
+		t.Fatalf("Messages returned error: %v", err)
+	}
+	if len(got) != len(sent) {
+		t.Fatalf("expected %d messages, got %d", len(sent), len(got))
+	}
+	for i := range sent {
+		if got[i] != sent[i] {
+			t.Errorf("message %d: expected %+v, got %+v", i, sent[i], got[i])
+		}
+	}
+}
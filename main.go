@@ -4,6 +4,9 @@
 // @host localhost:8080
 // @BasePath /
 // @schemes http
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 
 package main
 
@@ -15,39 +18,39 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
-	"github.com/swaggo/http-swagger"
-	_ "github.com/youssef-abbih/go-todo-list/docs"
+	_ "time/tzdata"
 	"github.com/youssef-abbih/go-todo-list/handlers"
 	"github.com/youssef-abbih/go-todo-list/models"
-	"github.com/youssef-abbih/go-todo-list/middleware"
-	"github.com/go-chi/chi/v5"
+	"github.com/youssef-abbih/go-todo-list/routes"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+	"github.com/youssef-abbih/go-todo-list/utils"
 )
 
 func main() {
 	// Initialize DB
 	models.InitDB()
 
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Garbage-collect expired token revocations and sync them across instances
+	models.StartRevocationSweeper(jobsCtx, utils.EnvDuration("REVOCATION_SWEEP_INTERVAL", time.Minute))
+
+	// Store the last-seen times of sessions noted by AuthMiddleware in batches
+	models.StartSessionActivityRecorder(jobsCtx, utils.EnvDuration("SESSION_ACTIVITY_INTERVAL", 30*time.Second))
+
+	// Email task reminders when they fall due
+	handlers.StartReminders(jobsCtx, utils.EnvDuration("REMINDER_INTERVAL", time.Minute))
+
+	// Delete tasks for good once they have been in the trash for TRASH_RETENTION
+	handlers.StartTrashPurge(jobsCtx, utils.EnvDuration("TRASH_PURGE_INTERVAL", time.Hour))
+
+	// Pick up signing keys added by `go run ./cmd/keys rotate`
+	tokens.WatchKeys(jobsCtx, 30*time.Second)
+
 	// Set up router
-	r := chi.NewRouter()
-
-	// Global middleware
-	r.Use(middleware.SecureHeadersMiddleware)   // Security headers
-	r.Use(middleware.LogRequestMiddleware)      // Request logging
-
-	// Public routes
-	r.Get("/", handlers.DefaultResponse)
-	r.Get("/health", handlers.HealthCheck)
-	r.Get("/swagger/*", httpSwagger.WrapHandler)
-
-	// Protected /tasks routes
-	r.Route("/tasks", func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware) // Scoped only to /tasks/*
-		r.Get("/", handlers.GetTasks)
-		r.Post("/", handlers.PostTask)
-		r.Get("/{id}", handlers.GetTask)
-		r.Put("/{id}", handlers.PutTask)
-		r.Delete("/{id}", handlers.DeleteTask)
-	})
+	r := routes.NewRouter()
 
 	// Server setup
 	port := ":8080"
@@ -64,6 +67,7 @@ func main() {
 		<-sigint
 
 		log.Println("Shutting down server...")
+		stopJobs()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -1,22 +1,16 @@
 package middleware
 
 import (
-    "fmt"
     "net/http"
+    "strconv"
     "strings"
-    "context"
-    "github.com/golang-jwt/jwt/v5"
-)
-
-// Define a key type to use when storing values in context
-type contextKey string
 
-const UserContextKey = contextKey("userID")
-
-// Secret key used for signing the JWTs (you should store this securely!)
-var jwtSecret = []byte("your-secret-key")
+    "github.com/youssef-abbih/go-todo-list/models"
+    "github.com/youssef-abbih/go-todo-list/tokens"
+    "github.com/youssef-abbih/go-todo-list/utils"
+)
 
-// AuthMiddleware verifies the JWT in the Authorization header
+// AuthMiddleware verifies the JWT or personal access token in the Authorization header
 func AuthMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -36,32 +30,105 @@ func AuthMiddleware(next http.Handler) http.Handler {
         // 3. Extract the token string by removing "Bearer " prefix
         tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-        // 4. Parse and validate the token
-        token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-            // Ensure the signing method is what we expect
-            if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-                return nil, fmt.Errorf("unexpected signing method")
+        // 4. Personal access tokens are looked up in the database instead of parsed
+        if strings.HasPrefix(tokenStr, tokens.PersonalAccessTokenPrefix) {
+            pat, found := models.GetPersonalAccessTokenByHash(tokens.HashOpaqueToken(tokenStr))
+            if !found {
+                http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+                return
             }
-            return jwtSecret, nil
-        })
+            if owner, found := models.GetUserByID(pat.UserID); !found || owner.DisabledAt != nil {
+                http.Error(w, "Account disabled", http.StatusUnauthorized)
+                return
+            }
+            models.TouchPersonalAccessToken(pat.ID)
+
+            claims := &tokens.Claims{Scopes: pat.Scopes, PersonalAccessTokenID: pat.ID}
+            claims.Subject = strconv.FormatUint(uint64(pat.UserID), 10)
+            next.ServeHTTP(w, r.WithContext(tokens.NewContext(r.Context(), claims)))
+            return
+        }
 
-        if err != nil || !token.Valid {
+        // 5. Parse and validate the JWT with the shared token service
+        claims, err := tokens.Default().Parse(tokenStr)
+        if err != nil {
             http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
             return
         }
 
-        // 5. Extract user ID (or other claims) if needed
-        if claims, ok := token.Claims.(jwt.MapClaims); ok {
-            userID := claims["user_id"]
+        // 6. Reject tokens revoked by logout before their expiry
+        userID, _ := claims.UserID()
+        if models.IsTokenRevoked(claims.ID, userID, claims.IssuedAt.Time) {
+            http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+            return
+        }
+
+        // 7. Tokens of an OAuth client or a login session die with it; note
+        // the session's activity
+        if claims.ClientID != "" && models.IsClientRevoked(claims.ClientID, userID, claims.IssuedAt.Time) {
+            http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+            return
+        }
+        if claims.SessionID != "" {
+            if models.IsSessionRevoked(claims.SessionID) {
+                http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+                return
+            }
+            models.TouchSession(claims.SessionID)
+        }
 
-            // 6. Save the user ID in the request context so handlers can use it
-            ctx := context.WithValue(r.Context(), UserContextKey, userID)
+        // 8. Save the typed claims in the request context so handlers can use them
+        ctx := tokens.NewContext(r.Context(), claims)
 
-            // 7. Call the next handler with the new context
-            next.ServeHTTP(w, r.WithContext(ctx))
-        } else {
-            http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+        // 9. Call the next handler with the new context
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+// RequireScope rejects requests whose token was not granted the given scope.
+// It must run after AuthMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            claims, ok := tokens.FromContext(r.Context())
+            if !ok {
+                http.Error(w, "user not authorized", http.StatusUnauthorized)
+                return
+            }
+            if !claims.HasScope(scope) {
+                http.Error(w, "Token is missing the "+scope+" scope", http.StatusForbidden)
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// RequireVerifiedEmail rejects requests of users who have not verified their
+// email address yet, when REQUIRE_EMAIL_VERIFICATION is enabled. It must run
+// after AuthMiddleware.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !utils.EnvBool("REQUIRE_EMAIL_VERIFICATION", false) {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        userID, err := utils.GetUserID(r)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusUnauthorized)
+            return
+        }
+
+        user, found := models.GetUserByID(userID)
+        if !found {
+            http.Error(w, "User Not Found", http.StatusUnauthorized)
+            return
+        }
+        if !user.EmailVerified {
+            http.Error(w, "Email address not verified", http.StatusForbidden)
             return
         }
+        next.ServeHTTP(w, r)
     })
-}
\ No newline at end of file
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+)
+
+// RequirePermission rejects requests of users whose role does not grant the
+// given permission. Tokens restricted to scopes, such as personal access
+// tokens, never carry role permissions. It must run after AuthMiddleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := tokens.FromContext(r.Context())
+			if !ok {
+				http.Error(w, "user not authorized", http.StatusUnauthorized)
+				return
+			}
+			if claims.Scopes != nil {
+				http.Error(w, "Scoped tokens cannot use role permissions", http.StatusForbidden)
+				return
+			}
+
+			userID, err := claims.UserID()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if !models.UserHasPermission(userID, permission) {
+				http.Error(w, "Missing the "+permission+" permission", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects tokens restricted to scopes, such as personal access
+// tokens and tokens issued to OAuth clients, for endpoints only the user may
+// use from a login session. It must run after AuthMiddleware.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := tokens.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "user not authorized", http.StatusUnauthorized)
+			return
+		}
+		if claims.Scopes != nil {
+			http.Error(w, "This endpoint requires a login session", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrWIPLimit is returned when a task would move into a board column that
+	// already holds as many tasks as its work-in-progress limit.
+	ErrWIPLimit = errors.New("column is at its work-in-progress limit")
+	// ErrMoveTarget is returned when the task to place a moved task next to is
+	// not in the target column.
+	ErrMoveTarget = errors.New("the task to move next to must be in the target column")
+)
+
+// Board is a project's tasks in one column per workflow status.
+type Board struct {
+	Project Project       `json:"project"`
+	Columns []BoardColumn `json:"columns"`
+}
+
+// BoardColumn holds the tasks in one status, in the order of the board's
+// filter. Count is the number of tasks in the status regardless of the
+// filter, and WIPLimit is how many it may hold (0 for no limit).
+type BoardColumn struct {
+	Status   string `json:"status"`
+	Done     bool   `json:"done"`
+	WIPLimit int    `json:"wip_limit"`
+	Count    int64  `json:"count"`
+	Tasks    []Task `json:"tasks"`
+}
+
+// BoardMove moves a task to a column of a board, directly before or after
+// another task of that column, or to its end when both are zero.
+type BoardMove struct {
+	TaskID uint   `json:"task_id"`
+	Status string `json:"status"`
+	Before uint   `json:"before"`
+	After  uint   `json:"after"`
+}
+
+// GetBoard returns the board of one of the user's projects. The tasks of
+// each column are those FindTasks returns for filter.
+func GetBoard(projectID, userID uint, filter TaskFilter) (Board, bool) {
+	project, ok := GetProject(projectID, userID)
+	if !ok {
+		return Board{}, false
+	}
+	wf := WorkflowFor(DB, &projectID)
+
+	filter.ProjectID = &projectID
+	byStatus := map[string][]Task{}
+	for _, t := range FindTasks(userID, filter) {
+		byStatus[t.Status] = append(byStatus[t.Status], t)
+	}
+
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+	DB.Model(&Task{}).Select("status, COUNT(*) AS count").
+		Where("project_id = ?", projectID).Group("status").Scan(&counts)
+	countOf := map[string]int64{}
+	for _, c := range counts {
+		countOf[c.Status] = c.Count
+	}
+
+	board := Board{Project: project}
+	for _, status := range wf.Statuses {
+		tasks := byStatus[status]
+		if tasks == nil {
+			tasks = []Task{}
+		}
+		board.Columns = append(board.Columns, BoardColumn{
+			Status:   status,
+			Done:     wf.IsDone(status),
+			WIPLimit: wf.Limits[status],
+			Count:    countOf[status],
+			Tasks:    tasks,
+		})
+	}
+	return board, true
+}
+
+// MoveOnBoard moves a task of one of the user's projects to another column
+// and position in one transaction. The status change follows the same rules
+// as UpdateTask, including the workflow's transitions, blockers (unless
+// force is set) and the completion of subtasks. It returns gorm.ErrRecordNotFound if the task is not in the
+// project, ErrMoveTarget for a neighbour outside the column, and the errors
+// of UpdateTask for a rejected status.
+func MoveOnBoard(projectID, userID uint, move BoardMove, force bool) (Task, error) {
+	var moved Task
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
+		var existing Task
+		if err := tx.Preload("Tags", orderTags).
+			Where("id = ? AND user_id = ? AND project_id = ?", move.TaskID, userID, projectID).
+			First(&existing).Error; err != nil {
+			return err
+		}
+
+		wf := WorkflowFor(tx, &projectID)
+		moved = existing
+		moved.Status = move.Status
+		if err := resolveStatus(existing, &moved, wf); err != nil {
+			return err
+		}
+		if err := checkBlockers(tx, existing, moved, force); err != nil {
+			return err
+		}
+		if moved.Status != existing.Status {
+			if err := checkWIPLimit(tx, wf, projectID, moved.Status, moved.ID); err != nil {
+				return err
+			}
+		}
+
+		moved.Position = nextPosition(tx, userID)
+		if target := move.Before + move.After; target != 0 {
+			var neighbour Task
+			if err := tx.Where("id = ? AND project_id = ? AND status = ?", target, projectID, moved.Status).
+				First(&neighbour).Error; err != nil || neighbour.ID == moved.ID {
+				return ErrMoveTarget
+			}
+			position, err := positionNextTo(tx, moved.ID, target, userID, move.After != 0)
+			if err == errPositionsCrowded {
+				if err := renumberTasks(tx, userID); err != nil {
+					return err
+				}
+				position, err = positionNextTo(tx, moved.ID, target, userID, move.After != 0)
+			}
+			if err != nil {
+				return err
+			}
+			moved.Position = position
+		}
+
+		if err := tx.Model(&moved).Select("status", "completed", "completed_at", "position", "updated_at").
+			Updates(&moved).Error; err != nil {
+			return err
+		}
+		if moved.Completed == existing.Completed {
+			return nil
+		}
+		if err := cascadeCompletion(tx, moved, force); err != nil {
+			return err
+		}
+		if moved.Completed {
+			return createNextOccurrence(tx, &moved)
+		}
+		return nil
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return withComputed(moved), nil
+}
+
+// boardColumn is a column of a project board; project is 0 for tasks
+// without a project.
+type boardColumn struct {
+	project uint
+	status  string
+}
+
+// checkColumnLimits checks the work-in-progress limits of the columns the
+// given tasks join at once, see checkWIPLimit.
+func checkColumnLimits(tx *gorm.DB, workflows map[uint]Workflow, joining map[boardColumn][]uint) error {
+	for col, ids := range joining {
+		if col.project == 0 {
+			continue
+		}
+		if err := checkWIPLimit(tx, workflows[col.project], col.project, col.status, ids...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWIPLimit returns ErrWIPLimit if the tasks with the given IDs cannot
+// join the other tasks of the project in status without exceeding the
+// status's work-in-progress limit. A task that is yet to be created is
+// passed with ID 0.
+func checkWIPLimit(tx *gorm.DB, wf Workflow, projectID uint, status string, taskIDs ...uint) error {
+	limit := wf.Limits[status]
+	if limit == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&Task{}).
+		Where("project_id = ? AND status = ? AND id NOT IN ?", projectID, status, taskIDs).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count+int64(len(taskIDs)) > int64(limit) {
+		return fmt.Errorf("%w: %s holds at most %d tasks", ErrWIPLimit, status, limit)
+	}
+	return nil
+}
+
+// lockUserTasks serializes changes to the order and columns of a user's
+// tasks until the end of the transaction, so that concurrent moves never
+// pick the same position or both take the last place in a column.
+func lockUserTasks(tx *gorm.DB, userID uint) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").First(&User{}, userID).Error
+}
@@ -0,0 +1,254 @@
+package models
+
+import (
+	"container/heap"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrBlockerInvalid is returned when a blocker is not another task of the
+	// same user.
+	ErrBlockerInvalid = errors.New("blocker must be another of your tasks")
+	// ErrDependencyCycle is returned when a task would end up waiting for
+	// itself through its blockers.
+	ErrDependencyCycle = errors.New("the dependency would create a cycle")
+	// ErrTaskBlocked is returned when a task is completed while some of its
+	// blockers are still open.
+	ErrTaskBlocked = errors.New("task is blocked by open tasks")
+)
+
+// TaskDependency records that a task cannot be done before its blocker.
+// Both are tasks of the same user; the dependency goes away with either.
+type TaskDependency struct {
+	TaskID    uint      `json:"task_id" gorm:"primaryKey"`
+	BlockerID uint      `json:"blocker_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+	Task      Task      `json:"-" gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE"`
+	Blocker   Task      `json:"-" gorm:"foreignKey:BlockerID;constraint:OnDelete:CASCADE"`
+}
+
+// GetBlockers returns the tasks that block one of the user's tasks, in their
+// manual order. It returns false if the task does not exist.
+func GetBlockers(id, userID uint) ([]Task, bool) {
+	if _, ok := GetTaskByID(id, userID); !ok {
+		return nil, false
+	}
+	var blockers []Task
+	DB.Preload("Tags", orderTags).
+		Where("id IN (?)", DB.Model(&TaskDependency{}).Select("blocker_id").Where("task_id = ?", id)).
+		Order("position").Order("id").Find(&blockers)
+	fillComputed(blockers)
+	return blockers, true
+}
+
+// AddBlocker makes blockerID block one of the user's tasks and returns the
+// task. Adding an existing dependency changes nothing. It returns
+// gorm.ErrRecordNotFound if the task does not exist, ErrBlockerInvalid if
+// the blocker is not another task of the user, and ErrDependencyCycle if the
+// blocker already waits for the task.
+func AddBlocker(id, blockerID, userID uint) (Task, error) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// Serialize dependency changes of the user, so that two concurrent
+		// inserts cannot close a cycle together
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&Task{}).Error; err != nil {
+			return err
+		}
+		if blockerID == id || tx.Where("id = ? AND user_id = ?", blockerID, userID).First(&Task{}).Error != nil {
+			return ErrBlockerInvalid
+		}
+
+		for _, waitsFor := range blockerIDs(tx, blockerID) {
+			if waitsFor == id {
+				return ErrDependencyCycle
+			}
+		}
+		return tx.Where(TaskDependency{TaskID: id, BlockerID: blockerID}).
+			FirstOrCreate(&TaskDependency{}).Error
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	task, _ := GetTaskByID(id, userID)
+	return task, nil
+}
+
+// RemoveBlocker removes a blocker from one of the user's tasks and returns
+// the task. It returns false if the task or the dependency does not exist.
+func RemoveBlocker(id, blockerID, userID uint) (Task, bool) {
+	if _, ok := GetTaskByID(id, userID); !ok {
+		return Task{}, false
+	}
+	result := DB.Where("task_id = ? AND blocker_id = ?", id, blockerID).Delete(&TaskDependency{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return Task{}, false
+	}
+	return GetTaskByID(id, userID)
+}
+
+// blockerIDs returns the IDs of the tasks a task waits for, directly or
+// through other blockers. Deleted tasks are included, so that restoring them
+// cannot create a cycle.
+func blockerIDs(db *gorm.DB, id uint) []uint {
+	var ids []uint
+	db.Raw(`WITH RECURSIVE up(id) AS (
+			SELECT blocker_id FROM task_dependencies WHERE task_id = ?
+			UNION
+			SELECT d.blocker_id FROM task_dependencies d JOIN up ON d.task_id = up.id
+		)
+		SELECT id FROM up`, id).Scan(&ids)
+	return ids
+}
+
+// openBlockers counts the open tasks that block a task.
+func openBlockers(db *gorm.DB, id uint) int64 {
+	var count int64
+	db.Model(&TaskDependency{}).
+		Joins("JOIN tasks ON tasks.id = task_dependencies.blocker_id").
+		Where("task_dependencies.task_id = ? AND tasks.deleted_at IS NULL AND NOT tasks.completed", id).
+		Count(&count)
+	return count
+}
+
+// blockedIDs returns the IDs of the given tasks that wait for open blockers
+// other than the tasks in except.
+func blockedIDs(db *gorm.DB, ids, except []uint) []uint {
+	var blocked []uint
+	db.Model(&TaskDependency{}).
+		Joins("JOIN tasks ON tasks.id = task_dependencies.blocker_id").
+		Where("task_dependencies.task_id IN ? AND task_dependencies.blocker_id NOT IN ?", ids, except).
+		Where("tasks.deleted_at IS NULL AND NOT tasks.completed").
+		Distinct().Order("task_dependencies.task_id").Pluck("task_dependencies.task_id", &blocked)
+	return blocked
+}
+
+// checkBlockers returns ErrTaskBlocked if an update completes a task whose
+// blockers are not all done, unless force is set.
+func checkBlockers(db *gorm.DB, existing, updated Task, force bool) error {
+	if force || existing.Completed || !updated.Completed {
+		return nil
+	}
+	if openBlockers(db, existing.ID) > 0 {
+		return ErrTaskBlocked
+	}
+	return nil
+}
+
+// fillBlocked sets the blockers of tasks with one query. A task is blocked
+// while any of its blockers is open; deleted blockers are left out.
+func fillBlocked(tasks []Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	ids := make([]uint, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+
+	var rows []struct {
+		TaskID    uint
+		BlockerID uint
+		Completed bool
+	}
+	DB.Model(&TaskDependency{}).
+		Select("task_dependencies.task_id, task_dependencies.blocker_id, tasks.completed").
+		Joins("JOIN tasks ON tasks.id = task_dependencies.blocker_id").
+		Where("task_dependencies.task_id IN ? AND tasks.deleted_at IS NULL", ids).
+		Order("task_dependencies.blocker_id").Scan(&rows)
+
+	byID := make(map[uint]*Task, len(tasks))
+	for i := range tasks {
+		tasks[i].BlockedBy = []uint{}
+		byID[tasks[i].ID] = &tasks[i]
+	}
+	for _, r := range rows {
+		t := byID[r.TaskID]
+		t.BlockedBy = append(t.BlockedBy, r.BlockerID)
+		t.Blocked = t.Blocked || !r.Completed
+	}
+}
+
+// NextTasks returns the open tasks of a user in an order they can be done
+// in: every task comes after its open blockers. Among the tasks that are
+// free to go next, higher priorities come first, then the manual order.
+func NextTasks(userID uint) []Task {
+	var tasks []Task
+	DB.Preload("Tags", orderTags).
+		Where("user_id = ? AND completed = ?", userID, false).
+		Order("position").Order("id").Find(&tasks)
+	fillComputed(tasks)
+
+	index := make(map[uint]int, len(tasks))
+	for i, t := range tasks {
+		index[t.ID] = i
+	}
+	waiting := make([]int, len(tasks))    // open blockers of each task
+	unblocks := make([][]int, len(tasks)) // tasks each task blocks
+	for i, t := range tasks {
+		for _, b := range t.BlockedBy {
+			if j, open := index[b]; open {
+				waiting[i]++
+				unblocks[j] = append(unblocks[j], i)
+			}
+		}
+	}
+
+	ready := &taskQueue{tasks: tasks}
+	for i := range tasks {
+		if waiting[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+	ordered := make([]Task, 0, len(tasks))
+	done := make([]bool, len(tasks))
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int)
+		ordered = append(ordered, tasks[i])
+		done[i] = true
+		for _, j := range unblocks[i] {
+			if waiting[j]--; waiting[j] == 0 {
+				heap.Push(ready, j)
+			}
+		}
+	}
+	// Cycles are refused by AddBlocker; should one exist anyway, its tasks
+	// come last rather than go missing
+	for i, t := range tasks {
+		if !done[i] {
+			ordered = append(ordered, t)
+		}
+	}
+	return ordered
+}
+
+// taskQueue is a heap of indexes into tasks, highest priority first and then
+// in manual order.
+type taskQueue struct {
+	tasks []Task
+	items []int
+}
+
+func (q *taskQueue) Len() int { return len(q.items) }
+
+func (q *taskQueue) Less(i, j int) bool {
+	a, b := q.tasks[q.items[i]], q.tasks[q.items[j]]
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return q.items[i] < q.items[j] // tasks are loaded in manual order
+}
+
+func (q *taskQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *taskQueue) Push(x any) { q.items = append(q.items, x.(int)) }
+
+func (q *taskQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
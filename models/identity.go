@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Identity links an account at an external OpenID Connect provider to a user.
+// The provider's subject identifier is stable; the email is informational.
+type Identity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	User      User      `json:"-" gorm:"foreignKey:UserID"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_identity_subject"`
+	Subject   string    `json:"subject" gorm:"uniqueIndex:idx_identity_subject"`
+	Email     string    `json:"email"`
+}
+
+// OIDCLoginState remembers an authorization request sent to a provider until
+// the provider redirects back. Only the hash of the state parameter is stored.
+// LinkUserID is set when a signed-in user links a new identity.
+type OIDCLoginState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time `json:"created_at"`
+	StateHash    string    `json:"-" gorm:"uniqueIndex"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	LinkUserID   uint      `json:"link_user_id"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+}
+
+// ErrIdentityLinked is returned when an identity already belongs to another user.
+var ErrIdentityLinked = errors.New("identity is linked to another user")
+
+// AddOIDCLoginState stores a pending authorization request and drops expired ones.
+func AddOIDCLoginState(state OIDCLoginState) error {
+	state.CreatedAt = time.Now()
+	DB.Where("expires_at < ?", state.CreatedAt).Delete(&OIDCLoginState{})
+	return DB.Create(&state).Error
+}
+
+// ConsumeOIDCLoginState returns and deletes the pending request with the given
+// state hash, so that every state is used at most once.
+func ConsumeOIDCLoginState(stateHash string) (OIDCLoginState, bool) {
+	var state OIDCLoginState
+	result := DB.Clauses(clause.Returning{}).Where("state_hash = ?", stateHash).Delete(&state)
+	if result.Error != nil || result.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		return OIDCLoginState{}, false
+	}
+	return state, true
+}
+
+// GetIdentity looks up the identity of a provider subject.
+func GetIdentity(provider, subject string) (Identity, bool) {
+	var identity Identity
+	result := DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity)
+	if result.Error != nil {
+		return Identity{}, false
+	}
+	return identity, true
+}
+
+// GetIdentities lists the identities linked to a user.
+func GetIdentities(userID uint) []Identity {
+	var identities []Identity
+	DB.Where("user_id = ?", userID).Order("id").Find(&identities)
+	return identities
+}
+
+// LinkIdentity links a provider subject to a user. Linking an identity the
+// user already has is a no-op.
+func LinkIdentity(userID uint, provider, subject, email string) (Identity, error) {
+	if existing, found := GetIdentity(provider, subject); found {
+		if existing.UserID != userID {
+			return Identity{}, ErrIdentityLinked
+		}
+		return existing, nil
+	}
+
+	identity := Identity{
+		CreatedAt: time.Now(),
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+	}
+	if err := DB.Create(&identity).Error; err != nil {
+		return Identity{}, err
+	}
+	return identity, nil
+}
+
+// UnlinkIdentity removes one of the user's identities.
+func UnlinkIdentity(id, userID uint) (Identity, bool) {
+	var identity Identity
+	if result := DB.Where("id = ? AND user_id = ?", id, userID).First(&identity); result.Error != nil {
+		return Identity{}, false
+	}
+	DB.Delete(&identity)
+	return identity, true
+}
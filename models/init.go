@@ -55,9 +55,63 @@ func InitDB() {
 		log.Fatalf("Failed to migrate User: %v", err)
 	}
 
-	if err := db.AutoMigrate(&Task{}); err != nil {
+	if err := db.AutoMigrate(&Tag{}, &Project{}, &Task{}); err != nil {
 		log.Fatalf("Failed to migrate Task: %v", err)
 	}
+	if err := db.AutoMigrate(&TaskDependency{}); err != nil {
+		log.Fatalf("Failed to migrate TaskDependency: %v", err)
+	}
+	if err := backfillTaskStatuses(db); err != nil {
+		log.Fatalf("Failed to backfill task statuses: %v", err)
+	}
+
+	if err := db.AutoMigrate(&RefreshToken{}); err != nil {
+		log.Fatalf("Failed to migrate RefreshToken: %v", err)
+	}
+
+	if err := db.AutoMigrate(&TokenRevocation{}); err != nil {
+		log.Fatalf("Failed to migrate TokenRevocation: %v", err)
+	}
+
+	if err := db.AutoMigrate(&PersonalAccessToken{}); err != nil {
+		log.Fatalf("Failed to migrate PersonalAccessToken: %v", err)
+	}
+
+	if err := db.AutoMigrate(&OneTimeToken{}); err != nil {
+		log.Fatalf("Failed to migrate OneTimeToken: %v", err)
+	}
+
+	if err := db.AutoMigrate(&RecoveryCode{}); err != nil {
+		log.Fatalf("Failed to migrate RecoveryCode: %v", err)
+	}
+
+	if err := db.AutoMigrate(&LoginThrottle{}); err != nil {
+		log.Fatalf("Failed to migrate LoginThrottle: %v", err)
+	}
+
+	if err := db.AutoMigrate(&Role{}); err != nil {
+		log.Fatalf("Failed to migrate Role: %v", err)
+	}
+
+	if err := db.AutoMigrate(&Identity{}, &OIDCLoginState{}); err != nil {
+		log.Fatalf("Failed to migrate Identity: %v", err)
+	}
+
+	if err := db.AutoMigrate(&Session{}); err != nil {
+		log.Fatalf("Failed to migrate Session: %v", err)
+	}
+
+	if err := db.AutoMigrate(&OAuthClient{}, &OAuthConsent{}, &OAuthAuthorizationCode{}); err != nil {
+		log.Fatalf("Failed to migrate OAuthClient: %v", err)
+	}
+
+	if err := EnsureDefaultRoles(); err != nil {
+		log.Fatalf("Failed to create default roles: %v", err)
+	}
+
+	if err := LoadRevocations(); err != nil {
+		log.Fatalf("Failed to load token revocations: %v", err)
+	}
 	
 }
 
@@ -72,8 +126,21 @@ func SeedTestData(db *gorm.DB){
 			log.Fatalf("Failed to reset user table: %v", err)
 		}
 
-		user1 := User{Email: "leon@gmail.com"}
-		user2 := User{Email: "youssef@hotmail.com"}
+		if err := db.Exec("TRUNCATE TABLE token_revocations RESTART IDENTITY;").Error; err != nil {
+			log.Fatalf("Failed to reset token revocation table: %v", err)
+		}
+		revocations = newRevocationCache()
+
+		if err := db.Exec("TRUNCATE TABLE login_throttles RESTART IDENTITY;").Error; err != nil {
+			log.Fatalf("Failed to reset login throttle table: %v", err)
+		}
+
+		if err := db.Exec("DELETE FROM roles WHERE name NOT IN (?, ?);", RoleUser, RoleAdmin).Error; err != nil {
+			log.Fatalf("Failed to reset custom roles: %v", err)
+		}
+
+		user1 := User{Email: "leon@gmail.com", EmailVerified: true}
+		user2 := User{Email: "youssef@hotmail.com", EmailVerified: true}
 		
 		var err error
 		user1.Password, err = HashPassword("leon123")
@@ -93,8 +160,8 @@ func SeedTestData(db *gorm.DB){
 
 		// Seed default tasks
 		if err := db.Create(&[]Task{
-			{Title: "Learn Go", Description: "Study Go basics", Completed: false, UserID: 1},
-			{Title: "Build API", Description: "Create a REST API", Completed: false, UserID: 2},
+			{Title: "Learn Go", Description: "Study Go basics", Completed: false, Status: StatusTodo, UserID: 1},
+			{Title: "Build API", Description: "Create a REST API", Completed: false, Status: StatusTodo, UserID: 2},
 		}).Error; err != nil{
 			log.Fatalf("Failed to seed tasks: %v", err)
 		}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginThrottle counts failed login attempts for one account or one client
+// IP address. Key is "account:<email>" or "ip:<address>", or
+// "reset:account:<email>" and "reset:ip:<address>" for password reset
+// requests, which are throttled the same way.
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Key           string     `json:"key" gorm:"uniqueIndex"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"` // progressive delay
+	LockedUntil   *time.Time `json:"locked_until"`    // temporary lockout
+}
+
+// AccountThrottleKey returns the throttle key of an email address.
+func AccountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPThrottleKey returns the throttle key of a client IP address.
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// ResetAccountThrottleKey returns the throttle key of password reset
+// requests for an email address.
+func ResetAccountThrottleKey(email string) string {
+	return "reset:" + AccountThrottleKey(email)
+}
+
+// ResetIPThrottleKey returns the throttle key of password reset requests
+// from a client IP address.
+func ResetIPThrottleKey(ip string) string {
+	return "reset:" + IPThrottleKey(ip)
+}
+
+// LoginPolicy decides how failed attempts are throttled. After DelayAfter
+// failures each further attempt has to wait BaseDelay, doubling up to
+// MaxDelay. Reaching MaxFailures locks the key for LockoutDuration. Failures
+// are forgotten once none happened for Window.
+type LoginPolicy struct {
+	MaxFailures     int
+	LockoutDuration time.Duration
+	DelayAfter      int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	Window          time.Duration
+}
+
+// delay is the wait imposed after the given number of failures.
+func (p LoginPolicy) delay(failures int) time.Duration {
+	if p.BaseDelay <= 0 || failures < p.DelayAfter {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.DelayAfter; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// fail records one failure at now and reports whether it triggered a lockout.
+func (p LoginPolicy) fail(t *LoginThrottle, now time.Time) bool {
+	if p.Window > 0 && now.Sub(t.LastFailureAt) > p.Window {
+		t.Failures = 0
+	}
+	if t.LockedUntil != nil && !now.Before(*t.LockedUntil) {
+		// Start over after a lockout has run out
+		t.Failures, t.LockedUntil = 0, nil
+	}
+	t.Failures++
+	t.LastFailureAt = now
+	t.NextAttemptAt = nil
+	if d := p.delay(t.Failures); d > 0 {
+		next := now.Add(d)
+		t.NextAttemptAt = &next
+	}
+	if p.MaxFailures > 0 && t.Failures >= p.MaxFailures && t.LockedUntil == nil {
+		until := now.Add(p.LockoutDuration)
+		t.LockedUntil = &until
+		return true
+	}
+	return false
+}
+
+// RetryAt is the earliest time the next attempt is allowed, or the zero time.
+func (t LoginThrottle) RetryAt() time.Time {
+	var at time.Time
+	if t.NextAttemptAt != nil {
+		at = *t.NextAttemptAt
+	}
+	if t.LockedUntil != nil && t.LockedUntil.After(at) {
+		at = *t.LockedUntil
+	}
+	return at
+}
+
+// Locked reports whether the key is locked out at now.
+func (t LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
+
+// LoginRetryAt returns the earliest time a login attempt for any of the keys
+// is allowed again. A zero time or one in the past means no throttling.
+func LoginRetryAt(keys ...string) time.Time {
+	var throttles []LoginThrottle
+	DB.Where("key IN ?", keys).Find(&throttles)
+
+	var at time.Time
+	for _, t := range throttles {
+		if retry := t.RetryAt(); retry.After(at) {
+			at = retry
+		}
+	}
+	return at
+}
+
+// RecordLoginFailure counts a failed attempt for key under the policy. It
+// reports whether this failure locked the key out.
+func RecordLoginFailure(key string, policy LoginPolicy) (LoginThrottle, bool, error) {
+	var throttle LoginThrottle
+	locked := false
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&LoginThrottle{Key: key}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+		locked = policy.fail(&throttle, time.Now())
+		return tx.Save(&throttle).Error
+	})
+	if err != nil {
+		return LoginThrottle{}, false, err
+	}
+	return throttle, locked, nil
+}
+
+// ResetLoginFailures forgets the failures of a key, e.g. after a successful
+// login or when an administrator unlocks an account. It reports whether
+// there was anything to reset.
+func ResetLoginFailures(key string) bool {
+	result := DB.Where("key = ?", key).Delete(&LoginThrottle{})
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// GetLockedLogins lists the keys that are currently locked out.
+func GetLockedLogins() []LoginThrottle {
+	var throttles []LoginThrottle
+	DB.Where("locked_until > ?", time.Now()).Order("locked_until").Find(&throttles)
+	return throttles
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginPolicy(t *testing.T) {
+	policy := LoginPolicy{
+		MaxFailures:     5,
+		LockoutDuration: 15 * time.Minute,
+		DelayAfter:      2,
+		BaseDelay:       time.Second,
+		MaxDelay:        4 * time.Second,
+		Window:          time.Hour,
+	}
+	now := time.Now()
+	var throttle LoginThrottle
+
+	// Progressive delays: none, 1s, 2s, 4s, capped at 4s
+	for i, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second} {
+		if policy.fail(&throttle, now) {
+			t.Fatalf("failure %d: unexpected lockout", i+1)
+		}
+		var got time.Duration
+		if retryAt := throttle.RetryAt(); !retryAt.IsZero() {
+			got = retryAt.Sub(now)
+		}
+		if got != want {
+			t.Errorf("failure %d: expected delay %s, got %s", i+1, want, got)
+		}
+	}
+
+	if !policy.fail(&throttle, now) {
+		t.Fatalf("expected the fifth failure to lock the key")
+	}
+	if !throttle.Locked(now.Add(14*time.Minute)) || throttle.Locked(now.Add(16*time.Minute)) {
+		t.Errorf("expected a 15 minute lockout, locked until %s", throttle.LockedUntil)
+	}
+	if policy.fail(&throttle, now.Add(time.Minute)) {
+		t.Errorf("a failure during a lockout must not trigger another one")
+	}
+
+	// Once the lockout has run out, counting starts over
+	if policy.fail(&throttle, now.Add(20*time.Minute)) || throttle.Failures != 1 || throttle.Locked(now.Add(20*time.Minute)) {
+		t.Errorf("expected counting to restart after the lockout, got %d failures", throttle.Failures)
+	}
+
+	// Failures older than the window are forgotten
+	policy.fail(&throttle, now.Add(3*time.Hour))
+	if throttle.Failures != 1 {
+		t.Errorf("expected failures outside the window to be forgotten, got %d", throttle.Failures)
+	}
+}
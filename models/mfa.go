@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	User      User       `json:"-" gorm:"foreignKey:UserID"`
+	CodeHash  string     `json:"-" gorm:"index"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// SetPendingTOTPSecret stores a TOTP secret that is not enabled until confirmed.
+func SetPendingTOTPSecret(userID uint, secret string) bool {
+	result := DB.Model(&User{}).Where("id = ? AND totp_enabled = ?", userID, false).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0})
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// EnableTOTP turns on two-factor authentication and replaces the user's
+// recovery codes with the given hashes.
+func EnableTOTP(userID uint, step int64, codeHashes []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// DisableTOTP turns off two-factor authentication and drops the recovery codes.
+func DisableTOTP(userID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// UseTOTPStep records that the code of the given step was used. It returns
+// false if a code of this or a later step was already used, which rejects
+// replays of an intercepted code.
+func UseTOTPStep(userID uint, step int64) bool {
+	result := DB.Model(&User{}).Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// UseRecoveryCode consumes one of the user's unused recovery codes.
+func UseRecoveryCode(userID uint, codeHash string) bool {
+	result := DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// ReplaceRecoveryCodes invalidates the user's recovery codes and stores new ones.
+func ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	codes := make([]RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = RecoveryCode{CreatedAt: now, UserID: userID, CodeHash: hash}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OAuth grant types a client can be registered for.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthClient is a third-party application registered by a user. Public
+// clients (Confidential false) have no secret and must use PKCE; only
+// confidential clients may use the client credentials grant, which acts on
+// behalf of the owner.
+type OAuthClient struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ClientID     string     `json:"client_id" gorm:"uniqueIndex"`
+	SecretHash   string     `json:"-"`
+	Name         string     `json:"name"`
+	Confidential bool       `json:"confidential"`
+	RedirectURIs []string   `json:"redirect_uris" gorm:"serializer:json"`
+	Scopes       []string   `json:"scopes" gorm:"serializer:json"`
+	GrantTypes   []string   `json:"grant_types" gorm:"serializer:json"`
+	OwnerID      uint       `json:"owner_id" gorm:"index"`
+	Owner        User       `json:"-" gorm:"foreignKey:OwnerID"`
+	RevokedAt    *time.Time `json:"-"`
+}
+
+// AllowsGrant reports whether the client is registered for the grant type.
+func (c OAuthClient) AllowsGrant(grant string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRedirectURI reports whether uri exactly matches a registered redirect URI.
+func (c OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthConsent records the scopes a user allowed a client to use.
+type OAuthConsent struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	UserID    uint        `json:"user_id" gorm:"uniqueIndex:idx_consent_user_client"`
+	User      User        `json:"-" gorm:"foreignKey:UserID"`
+	ClientID  uint        `json:"-" gorm:"uniqueIndex:idx_consent_user_client"`
+	Client    OAuthClient `json:"client" gorm:"foreignKey:ClientID"`
+	Scopes    []string    `json:"scopes" gorm:"serializer:json"`
+}
+
+// Covers reports whether the consent includes every one of scopes.
+func (c OAuthConsent) Covers(scopes []string) bool {
+	for _, s := range scopes {
+		found := false
+		for _, granted := range c.Scopes {
+			if s == granted {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// OAuthAuthorizationCode is a single-use code handed to a client's redirect
+// URI. Only its hash is stored. FamilyID is the refresh token family the code
+// is exchanged into, so that a replayed code can revoke what it minted.
+type OAuthAuthorizationCode struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CodeHash      string     `json:"-" gorm:"uniqueIndex"`
+	ClientID      uint       `json:"client_id" gorm:"index"`
+	UserID        uint       `json:"user_id" gorm:"index"`
+	RedirectURI   string     `json:"redirect_uri"`
+	Scopes        []string   `json:"scopes" gorm:"serializer:json"`
+	CodeChallenge string     `json:"-"`
+	FamilyID      string     `json:"-"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at"`
+}
+
+var (
+	// ErrAuthorizationCodeInvalid is returned for unknown or expired codes.
+	ErrAuthorizationCodeInvalid = errors.New("invalid or expired authorization code")
+	// ErrAuthorizationCodeReused is returned when a code is redeemed twice.
+	// The tokens minted by the first redemption have been revoked.
+	ErrAuthorizationCodeReused = errors.New("authorization code reuse detected")
+)
+
+// AddOAuthClient registers a client.
+func AddOAuthClient(client OAuthClient) (OAuthClient, error) {
+	client.CreatedAt = time.Now()
+	if err := DB.Create(&client).Error; err != nil {
+		return OAuthClient{}, err
+	}
+	return client, nil
+}
+
+// GetOAuthClient looks up an active client by its client_id.
+func GetOAuthClient(clientID string) (OAuthClient, bool) {
+	var client OAuthClient
+	result := DB.Where("client_id = ? AND revoked_at IS NULL", clientID).First(&client)
+	if result.Error != nil {
+		return OAuthClient{}, false
+	}
+	return client, true
+}
+
+// GetOAuthClients lists the active clients registered by a user.
+func GetOAuthClients(ownerID uint) []OAuthClient {
+	var clients []OAuthClient
+	DB.Where("owner_id = ? AND revoked_at IS NULL", ownerID).Order("id").Find(&clients)
+	return clients
+}
+
+// RevokeOAuthClient deletes a user's client, its consents and its refresh
+// tokens, and revokes the access tokens issued to it. until must be at least
+// the expiry of the longest-lived access token the client may still hold.
+func RevokeOAuthClient(id, ownerID uint, until time.Time) (OAuthClient, bool) {
+	var client OAuthClient
+	result := DB.Where("id = ? AND owner_id = ? AND revoked_at IS NULL", id, ownerID).First(&client)
+	if result.Error != nil {
+		return OAuthClient{}, false
+	}
+
+	now := time.Now()
+	DB.Model(&client).Update("revoked_at", now)
+	DB.Where("client_id = ?", client.ID).Delete(&OAuthConsent{})
+	RevokeClientRefreshTokens(client.ID, 0)
+	if err := addRevocation(TokenRevocation{JTI: client.ClientID, UserID: ownerID, ExpiresAt: until}); err != nil {
+		return OAuthClient{}, false
+	}
+	return client, true
+}
+
+// IsClientRevoked reports whether an access token issued to the OAuth client
+// with the given client_id for the user at issuedAt has been revoked along
+// with the client, a withdrawn consent or a replayed code. Client IDs are
+// random like jtis and share the revocation cache with them.
+func IsClientRevoked(clientID string, userID uint, issuedAt time.Time) bool {
+	return revocations.clientRevoked(clientID, userID, issuedAt)
+}
+
+// GetOAuthConsent returns the consent a user gave a client.
+func GetOAuthConsent(userID, clientID uint) (OAuthConsent, bool) {
+	var consent OAuthConsent
+	result := DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent)
+	if result.Error != nil {
+		return OAuthConsent{}, false
+	}
+	return consent, true
+}
+
+// GetOAuthConsents lists the consents of a user with their clients.
+func GetOAuthConsents(userID uint) []OAuthConsent {
+	var consents []OAuthConsent
+	DB.Preload("Client").Where("user_id = ?", userID).Order("id").Find(&consents)
+	return consents
+}
+
+// GrantOAuthConsent adds scopes to the consent a user gave a client.
+func GrantOAuthConsent(userID, clientID uint, scopes []string) (OAuthConsent, error) {
+	consent, found := GetOAuthConsent(userID, clientID)
+	if !found {
+		consent = OAuthConsent{UserID: userID, ClientID: clientID, Scopes: []string{}}
+	}
+	for _, s := range scopes {
+		if !consent.Covers([]string{s}) {
+			consent.Scopes = append(consent.Scopes, s)
+		}
+	}
+	if err := DB.Save(&consent).Error; err != nil {
+		return OAuthConsent{}, err
+	}
+	return consent, nil
+}
+
+// RevokeOAuthConsent withdraws a consent and revokes the refresh and access
+// tokens the client holds for the user. until must be at least the expiry of
+// the longest-lived access token the client may still hold.
+func RevokeOAuthConsent(id, userID uint, until time.Time) (OAuthConsent, bool) {
+	var consent OAuthConsent
+	result := DB.Preload("Client").Where("id = ? AND user_id = ?", id, userID).First(&consent)
+	if result.Error != nil {
+		return OAuthConsent{}, false
+	}
+	DB.Delete(&consent)
+	RevokeClientRefreshTokens(consent.ClientID, userID)
+	if err := RevokeClientTokens(consent.Client.ClientID, userID, until); err != nil {
+		return OAuthConsent{}, false
+	}
+	return consent, true
+}
+
+// AddOAuthAuthorizationCode stores a new authorization code.
+func AddOAuthAuthorizationCode(code OAuthAuthorizationCode) error {
+	code.CreatedAt = time.Now()
+	return DB.Create(&code).Error
+}
+
+// ConsumeOAuthAuthorizationCode marks the code with the given hash as used and
+// returns it. Redeeming a code twice revokes the tokens of its first
+// redemption: the refresh tokens of its family and every access token the
+// client holds for the user, which are revoked until the given time.
+func ConsumeOAuthAuthorizationCode(codeHash string, until time.Time) (OAuthAuthorizationCode, error) {
+	var code OAuthAuthorizationCode
+	reused := false
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code_hash = ?", codeHash).First(&code)
+		if result.Error != nil {
+			return ErrAuthorizationCodeInvalid
+		}
+		if code.UsedAt != nil {
+			reused = true
+			return revokeRefreshTokens(tx.Where("family_id = ?", code.FamilyID))
+		}
+		now := time.Now()
+		if now.After(code.ExpiresAt) {
+			return ErrAuthorizationCodeInvalid
+		}
+		return tx.Model(&code).Update("used_at", now).Error
+	})
+	if err != nil {
+		return OAuthAuthorizationCode{}, err
+	}
+	if reused {
+		var client OAuthClient
+		if err := DB.Select("client_id").First(&client, code.ClientID).Error; err != nil {
+			return OAuthAuthorizationCode{}, err
+		}
+		if err := RevokeClientTokens(client.ClientID, code.UserID, until); err != nil {
+			return OAuthAuthorizationCode{}, err
+		}
+		return OAuthAuthorizationCode{}, ErrAuthorizationCodeReused
+	}
+	return code, nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Purposes of one-time tokens.
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+)
+
+// OneTimeToken is a single-use, time-limited token sent to a user by email,
+// for example to reset a password. Only the hash of the token is stored.
+type OneTimeToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	User      User       `json:"-" gorm:"foreignKey:UserID"`
+	Purpose   string     `json:"purpose" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// ErrOneTimeTokenInvalid is returned for unknown, used or expired one-time tokens.
+var ErrOneTimeTokenInvalid = errors.New("invalid or expired token")
+
+// AddOneTimeToken stores a new one-time token. Earlier unused tokens of the
+// same user and purpose are invalidated, so only the latest email works.
+func AddOneTimeToken(userID uint, purpose, tokenHash string, expiresAt time.Time) (OneTimeToken, error) {
+	token := OneTimeToken{
+		CreatedAt: time.Now(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&OneTimeToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", token.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Create(&token).Error
+	})
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	return token, nil
+}
+
+// GetOneTimeToken returns the unused, unexpired token with the given purpose
+// and hash without consuming it.
+func GetOneTimeToken(purpose, tokenHash string) (OneTimeToken, error) {
+	var token OneTimeToken
+	result := DB.Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		purpose, tokenHash, time.Now()).First(&token)
+	if result.Error != nil {
+		return OneTimeToken{}, ErrOneTimeTokenInvalid
+	}
+	return token, nil
+}
+
+// ConsumeOneTimeToken marks the token with the given purpose and hash as used
+// and returns it. Each token can be consumed once, before it expires.
+func ConsumeOneTimeToken(purpose, tokenHash string) (OneTimeToken, error) {
+	var token OneTimeToken
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = consumeOneTimeToken(tx, purpose, tokenHash)
+		return err
+	})
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	return token, nil
+}
+
+// consumeOneTimeToken marks a token as used within tx, so that it stays
+// usable if the rest of the transaction fails.
+func consumeOneTimeToken(tx *gorm.DB, purpose, tokenHash string) (OneTimeToken, error) {
+	var token OneTimeToken
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("purpose = ? AND token_hash = ?", purpose, tokenHash).First(&token)
+	if result.Error != nil {
+		return OneTimeToken{}, ErrOneTimeTokenInvalid
+	}
+
+	now := time.Now()
+	if token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return OneTimeToken{}, ErrOneTimeTokenInvalid
+	}
+
+	token.UsedAt = &now
+	if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+		return OneTimeToken{}, err
+	}
+	return token, nil
+}
+
+// ResetPassword consumes a password reset token and sets the password hash
+// of its user in one transaction, and returns the user.
+func ResetPassword(tokenHash, passwordHash string) (User, error) {
+	var user User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		reset, err := consumeOneTimeToken(tx, PurposePasswordReset, tokenHash)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return ErrOneTimeTokenInvalid
+		}
+		return tx.Model(&user).Update("password", passwordHash).Error
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+)
+
+// PersonalAccessToken is a long-lived, named and scoped token for scripts and
+// CI. Only the hash of the token is stored; Prefix keeps the first characters
+// so users can recognise their tokens in listings.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"-" gorm:"index"`
+	User       User       `json:"-" gorm:"foreignKey:UserID"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// lastUsedResolution limits how often LastUsedAt is written for a busy token.
+const lastUsedResolution = time.Minute
+
+// Active reports whether the token is neither revoked nor expired.
+func (t PersonalAccessToken) Active() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
+
+// AddPersonalAccessToken stores a new personal access token for the user.
+func AddPersonalAccessToken(token PersonalAccessToken, userID uint) (PersonalAccessToken, error) {
+	token.UserID = userID
+	token.CreatedAt = time.Now()
+	if err := DB.Create(&token).Error; err != nil {
+		return PersonalAccessToken{}, err
+	}
+	return token, nil
+}
+
+// GetPersonalAccessTokens lists the user's tokens that have not been revoked.
+func GetPersonalAccessTokens(userID uint) []PersonalAccessToken {
+	var tokens []PersonalAccessToken
+	DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("id").Find(&tokens)
+	return tokens
+}
+
+// GetPersonalAccessTokenByHash looks up an active token by the hash of its value.
+func GetPersonalAccessTokenByHash(tokenHash string) (PersonalAccessToken, bool) {
+	var token PersonalAccessToken
+	result := DB.Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil || !token.Active() {
+		return PersonalAccessToken{}, false
+	}
+	return token, true
+}
+
+// TouchPersonalAccessToken records that the token was just used.
+func TouchPersonalAccessToken(id uint) {
+	now := time.Now()
+	DB.Model(&PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-lastUsedResolution)).
+		Update("last_used_at", now)
+}
+
+// RevokePersonalAccessToken revokes one of the user's tokens.
+func RevokePersonalAccessToken(id, userID uint) (PersonalAccessToken, bool) {
+	var token PersonalAccessToken
+	result := DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).First(&token)
+	if result.Error != nil {
+		return PersonalAccessToken{}, false
+	}
+
+	now := time.Now()
+	token.RevokedAt = &now
+	DB.Model(&token).Update("revoked_at", now)
+	return token, true
+}
+
+// RevokeUserPersonalAccessTokens revokes every personal access token of a user.
+func RevokeUserPersonalAccessTokens(userID uint) error {
+	return DB.Model(&PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Project groups tasks of a user. Tasks without a project are in no list.
+// Archived projects keep their tasks but take no new ones.
+type Project struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	UserID      uint       `json:"-" gorm:"index"`
+	User        User       `json:"-" gorm:"foreignKey:UserID"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ArchivedAt  *time.Time `json:"archived_at"`
+
+	// Workflow holds the statuses of the project's tasks; nil uses
+	// DefaultWorkflow. It is changed with SetProjectWorkflow.
+	Workflow *Workflow `json:"workflow" gorm:"serializer:json"`
+
+	// Counts of the project's tasks, filled in when projects are read
+	OpenTasks      int64 `json:"open_tasks" gorm:"-"`
+	CompletedTasks int64 `json:"completed_tasks" gorm:"-"`
+}
+
+// Archived reports whether the project is archived.
+func (p Project) Archived() bool {
+	return p.ArchivedAt != nil
+}
+
+// GetProjects lists the projects of a user by name with their task counts.
+// Archived projects are included only if includeArchived is set.
+func GetProjects(userID uint, includeArchived bool) []Project {
+	query := DB.Where("user_id = ?", userID)
+	if !includeArchived {
+		query = query.Where("archived_at IS NULL")
+	}
+	var projects []Project
+	query.Order("name").Order("id").Find(&projects)
+	countProjectTasks(userID, projects)
+	return projects
+}
+
+// GetProject returns one of the user's projects with its task counts.
+func GetProject(id, userID uint) (Project, bool) {
+	var project Project
+	if err := DB.Where("id = ? AND user_id = ?", id, userID).First(&project).Error; err != nil {
+		return Project{}, false
+	}
+	projects := []Project{project}
+	countProjectTasks(userID, projects)
+	return projects[0], true
+}
+
+// countProjectTasks fills in the task counts of the user's projects with a
+// single query.
+func countProjectTasks(userID uint, projects []Project) {
+	if len(projects) == 0 {
+		return
+	}
+	ids := make([]uint, len(projects))
+	for i, p := range projects {
+		ids[i] = p.ID
+	}
+
+	var counts []struct {
+		ProjectID uint
+		Open      int64
+		Completed int64
+	}
+	DB.Model(&Task{}).
+		Select("project_id, COUNT(*) FILTER (WHERE NOT completed) AS open, COUNT(*) FILTER (WHERE completed) AS completed").
+		Where("user_id = ? AND project_id IN ?", userID, ids).
+		Group("project_id").Scan(&counts)
+
+	byProject := make(map[uint]int, len(projects))
+	for i, p := range projects {
+		byProject[p.ID] = i
+	}
+	for _, c := range counts {
+		projects[byProject[c.ProjectID]].OpenTasks = c.Open
+		projects[byProject[c.ProjectID]].CompletedTasks = c.Completed
+	}
+}
+
+// AddProject creates a project for the user.
+func AddProject(project Project, userID uint) (Project, error) {
+	project.ID = 0
+	project.UserID = userID
+	project.ArchivedAt = nil
+	project.Workflow = nil
+	if err := DB.Create(&project).Error; err != nil {
+		return Project{}, err
+	}
+	return project, nil
+}
+
+// UpdateProject renames one of the user's projects or changes its description.
+func UpdateProject(id, userID uint, name, description string) (Project, bool) {
+	project, ok := GetProject(id, userID)
+	if !ok {
+		return Project{}, false
+	}
+	project.Name = name
+	project.Description = description
+	if err := DB.Select("name", "description", "updated_at").Save(&project).Error; err != nil {
+		return Project{}, false
+	}
+	return project, true
+}
+
+// ArchiveProject archives one of the user's projects, or restores it when
+// archived is false. Archiving an archived project keeps its archive time.
+func ArchiveProject(id, userID uint, archived bool) (Project, bool) {
+	project, ok := GetProject(id, userID)
+	if !ok {
+		return Project{}, false
+	}
+	if archived == project.Archived() {
+		return project, true
+	}
+
+	project.ArchivedAt = nil
+	if archived {
+		now := time.Now()
+		project.ArchivedAt = &now
+	}
+	if err := DB.Model(&project).Update("archived_at", project.ArchivedAt).Error; err != nil {
+		return Project{}, false
+	}
+	return project, true
+}
+
+// DeleteProject deletes one of the user's projects. Its tasks, including
+// those in the trash, are kept without a project and so take on the
+// default workflow: a status the default workflow lacks becomes its done
+// status for completed tasks and its initial status for the others, and
+// tasks are completed or reopened to match their new status.
+func DeleteProject(id, userID uint) (Project, bool) {
+	project, ok := GetProject(id, userID)
+	if !ok {
+		return Project{}, false
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// A session, so that each query below starts from scratch
+		tasks := tx.Unscoped().Session(&gorm.Session{})
+		if err := tasks.Model(&Task{}).
+			Where("project_id = ? AND status NOT IN ?", id, DefaultWorkflow.Statuses).
+			Updates(map[string]interface{}{
+				"status":     gorm.Expr("CASE WHEN completed THEN ? ELSE ? END", DefaultWorkflow.DoneStatus(), DefaultWorkflow.Initial()),
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+		if err := syncCompletion(tasks, id, DefaultWorkflow); err != nil {
+			return err
+		}
+		return tx.Delete(&project).Error
+	})
+	if err != nil {
+		return Project{}, false
+	}
+	return project, true
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/youssef-abbih/go-todo-list/rrule"
+)
+
+// UpcomingOccurrences returns up to n due dates of the occurrences that
+// follow the task, in its time zone. It returns nil for tasks that do not
+// repeat.
+func (t Task) UpcomingOccurrences(n int) []time.Time {
+	if t.Recurrence == "" || t.DueAt == nil {
+		return nil
+	}
+	rule, err := rrule.Parse(t.Recurrence)
+	if err != nil {
+		return nil
+	}
+	loc := time.UTC
+	if t.TimeZone != "" {
+		if loc, err = time.LoadLocation(t.TimeZone); err != nil {
+			return nil
+		}
+	}
+	return rule.After(t.DueAt.In(loc), max(t.Occurrence, 1), n)
+}
+
+// createNextOccurrence creates the task that follows a completed recurring
+// task, once: the same task with the next due date, its start date and
+// reminder moved along, the same tags, and the first status of its
+// workflow. Subtasks are not copied. It returns ErrWIPLimit if that column
+// of the project board is full.
+func createNextOccurrence(tx *gorm.DB, task *Task) error {
+	if task.NextOccurrenceID != nil {
+		return nil
+	}
+	due := task.UpcomingOccurrences(1)
+	if len(due) == 0 {
+		return nil
+	}
+
+	next := Task{
+		Title:           task.Title,
+		Description:     task.Description,
+		UserID:          task.UserID,
+		Status:          WorkflowFor(tx, task.ProjectID).Initial(),
+		DueAt:           &due[0],
+		ReminderMinutes: task.ReminderMinutes,
+		Priority:        task.Priority,
+		Position:        nextPosition(tx, task.UserID),
+		ProjectID:       task.ProjectID,
+		ParentID:        task.ParentID,
+		Recurrence:      task.Recurrence,
+		TimeZone:        task.TimeZone,
+		Occurrence:      max(task.Occurrence, 1) + 1,
+	}
+	if task.StartAt != nil {
+		start := task.StartAt.Add(due[0].Sub(*task.DueAt))
+		next.StartAt = &start
+	}
+	next.scheduleReminder()
+	if next.ProjectID != nil {
+		wf := WorkflowFor(tx, next.ProjectID)
+		if err := checkWIPLimit(tx, wf, *next.ProjectID, next.Status, next.ID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Omit(clause.Associations).Create(&next).Error; err != nil {
+		return err
+	}
+	if len(task.Tags) > 0 {
+		if err := tx.Model(&next).Association("Tags").Append(task.Tags); err != nil {
+			return err
+		}
+	}
+
+	task.NextOccurrenceID = &next.ID
+	return tx.Model(task).UpdateColumn("next_occurrence_id", next.ID).Error
+}
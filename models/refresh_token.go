@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RefreshToken is a persisted, single-use refresh token. Only the hash of the
+// token is stored. Every rotation creates a new row in the same family, so a
+// family traces one login session from its first token to its latest one.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	User      User       `json:"-" gorm:"foreignKey:UserID"`
+	FamilyID  string     `json:"-" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+
+	// ClientID and Scopes are set for tokens issued to an OAuth client; the
+	// access tokens they refresh carry the same restrictions.
+	ClientID uint     `json:"-" gorm:"index"`
+	Scopes   []string `json:"-" gorm:"serializer:json"`
+}
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown, expired or revoked refresh tokens.
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is
+	// presented again. The whole family has been revoked when it is returned.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// AddRefreshToken stores the hash of a new refresh token in the given family.
+func AddRefreshToken(userID uint, familyID, tokenHash string, expiresAt time.Time) (RefreshToken, error) {
+	token := RefreshToken{
+		CreatedAt: time.Now(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+	if err := DB.Create(&token).Error; err != nil {
+		return RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// AddClientRefreshToken stores the hash of a new refresh token issued to an
+// OAuth client, restricted to scopes.
+func AddClientRefreshToken(userID, clientID uint, scopes []string, familyID, tokenHash string, expiresAt time.Time) (RefreshToken, error) {
+	token := RefreshToken{
+		CreatedAt: time.Now(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+		ClientID:  clientID,
+		Scopes:    scopes,
+	}
+	if err := DB.Create(&token).Error; err != nil {
+		return RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken consumes the refresh token identified by oldHash and
+// stores newHash as its successor in the same family. Presenting a token that
+// was already rotated revokes every token of its family and returns it along
+// with ErrRefreshTokenReused, so that the caller can revoke what else was
+// issued to the family. clientID must match the OAuth client the token was
+// issued to, or be 0 for login sessions.
+func RotateRefreshToken(oldHash, newHash string, expiresAt time.Time, clientID uint) (RefreshToken, error) {
+	var rotated, reusedToken RefreshToken
+	reused := false
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var current RefreshToken
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", oldHash).First(&current)
+		if result.Error != nil || current.ClientID != clientID {
+			return ErrRefreshTokenInvalid
+		}
+
+		if current.UsedAt != nil {
+			// Commit the family revocation, report the reuse afterwards
+			reused, reusedToken = true, current
+			return revokeRefreshTokens(tx.Where("family_id = ?", current.FamilyID))
+		}
+		now := time.Now()
+		if current.RevokedAt != nil || now.After(current.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		rotated = RefreshToken{
+			CreatedAt: now,
+			UserID:    current.UserID,
+			FamilyID:  current.FamilyID,
+			TokenHash: newHash,
+			ExpiresAt: expiresAt,
+			ClientID:  current.ClientID,
+			Scopes:    current.Scopes,
+		}
+		return tx.Create(&rotated).Error
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if reused {
+		return reusedToken, ErrRefreshTokenReused
+	}
+	return rotated, nil
+}
+
+// GetRefreshTokenByHash looks up a refresh token by the hash of its value.
+func GetRefreshTokenByHash(tokenHash string) (RefreshToken, bool) {
+	var token RefreshToken
+	result := DB.Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		return RefreshToken{}, false
+	}
+	return token, true
+}
+
+// RevokeRefreshTokenFamily revokes every token of a refresh token family.
+func RevokeRefreshTokenFamily(familyID string) error {
+	return revokeRefreshTokens(DB.Where("family_id = ?", familyID))
+}
+
+// RevokeClientRefreshTokens revokes the refresh tokens of an OAuth client,
+// optionally only those of one user (userID 0 means all users).
+func RevokeClientRefreshTokens(clientID, userID uint) error {
+	scope := DB.Where("client_id = ?", clientID)
+	if userID != 0 {
+		scope = scope.Where("user_id = ?", userID)
+	}
+	return revokeRefreshTokens(scope)
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of a user.
+func RevokeUserRefreshTokens(userID uint) error {
+	return revokeRefreshTokens(DB.Where("user_id = ?", userID))
+}
+
+func revokeRefreshTokens(scope *gorm.DB) error {
+	return scope.Model(&RefreshToken{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
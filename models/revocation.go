@@ -0,0 +1,231 @@
+package models
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// TokenRevocation marks access tokens as revoked before their exp. A row with
+// a JTI revokes that single token, every token of a login session when it
+// holds the session's sid (see RevokeSession), or every token of an OAuth
+// client when it holds the client_id (see RevokeOAuthClient). A row with only
+// a ClientID revokes the tokens that client holds for the user, issued before
+// CreatedAt; a row with neither revokes every token of the user issued before
+// CreatedAt ("log out all sessions"). Rows are garbage-collected once
+// ExpiresAt has passed, because by then every token they cover has expired
+// on its own.
+type TokenRevocation struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	JTI       string    `json:"jti" gorm:"index"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ClientID  string    `json:"client_id"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// userRevocation is the cached form of a user-wide revocation, or of one
+// limited to a client.
+type userRevocation struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+// clientGrant identifies the tokens an OAuth client holds for a user.
+type clientGrant struct {
+	clientID string
+	userID   uint
+}
+
+// revocationCache is the in-process copy of the token_revocations table that
+// AuthMiddleware consults on every request without touching the database.
+type revocationCache struct {
+	mu      sync.RWMutex
+	tokens  map[string]time.Time
+	users   map[uint]userRevocation
+	clients map[clientGrant]userRevocation
+	synced  time.Time
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{
+		tokens:  map[string]time.Time{},
+		users:   map[uint]userRevocation{},
+		clients: map[clientGrant]userRevocation{},
+	}
+}
+
+func (c *revocationCache) add(rev TokenRevocation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rev.JTI != "" {
+		c.tokens[rev.JTI] = rev.ExpiresAt
+		return
+	}
+	// Tokens carry iat in microseconds, as the database stores CreatedAt
+	before := rev.CreatedAt.Truncate(time.Microsecond)
+	if rev.ClientID != "" {
+		key := clientGrant{rev.ClientID, rev.UserID}
+		if existing, ok := c.clients[key]; !ok || before.After(existing.before) {
+			c.clients[key] = userRevocation{before: before, expiresAt: rev.ExpiresAt}
+		}
+		return
+	}
+	if existing, ok := c.users[rev.UserID]; !ok || before.After(existing.before) {
+		c.users[rev.UserID] = userRevocation{before: before, expiresAt: rev.ExpiresAt}
+	}
+}
+
+func (c *revocationCache) revoked(jti string, userID uint, issuedAt time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.tokens[jti]; ok {
+		return true
+	}
+	if rev, ok := c.users[userID]; ok && !issuedAt.After(rev.before) {
+		return true
+	}
+	return false
+}
+
+func (c *revocationCache) clientRevoked(clientID string, userID uint, issuedAt time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.tokens[clientID]; ok {
+		return true
+	}
+	if rev, ok := c.clients[clientGrant{clientID, userID}]; ok && !issuedAt.After(rev.before) {
+		return true
+	}
+	return false
+}
+
+func (c *revocationCache) prune(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for jti, expiresAt := range c.tokens {
+		if now.After(expiresAt) {
+			delete(c.tokens, jti)
+		}
+	}
+	for userID, rev := range c.users {
+		if now.After(rev.expiresAt) {
+			delete(c.users, userID)
+		}
+	}
+	for key, rev := range c.clients {
+		if now.After(rev.expiresAt) {
+			delete(c.clients, key)
+		}
+	}
+}
+
+func (c *revocationCache) since() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.synced
+}
+
+func (c *revocationCache) markSynced(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.synced = at
+}
+
+// revocationSyncOverlap is how far before the previous sync LoadRevocations
+// looks again. Rows are stamped by the writing instance before they commit,
+// so a row may become visible after rows with a later CreatedAt; the overlap
+// covers that delay and clock skew between instances.
+const revocationSyncOverlap = time.Minute
+
+var revocations = newRevocationCache()
+
+// RevokeToken revokes a single access token until its expiry.
+func RevokeToken(jti string, userID uint, expiresAt time.Time) error {
+	return addRevocation(TokenRevocation{JTI: jti, UserID: userID, ExpiresAt: expiresAt})
+}
+
+// RevokeAllTokens revokes every access token of the user issued so far. until
+// must be at least the expiry of the longest-lived token that may still be in use.
+func RevokeAllTokens(userID uint, until time.Time) error {
+	return addRevocation(TokenRevocation{UserID: userID, ExpiresAt: until})
+}
+
+// RevokeClientTokens revokes every access token the OAuth client with the
+// given client_id holds for the user, issued so far. until must be at least
+// the expiry of the longest-lived token that may still be in use.
+func RevokeClientTokens(clientID string, userID uint, until time.Time) error {
+	return addRevocation(TokenRevocation{ClientID: clientID, UserID: userID, ExpiresAt: until})
+}
+
+func addRevocation(rev TokenRevocation) error {
+	rev.CreatedAt = time.Now()
+	if err := DB.Create(&rev).Error; err != nil {
+		return err
+	}
+	revocations.add(rev)
+	return nil
+}
+
+// IsTokenRevoked reports whether the access token with the given jti, owner
+// and issue time has been revoked. It only consults the in-process cache.
+func IsTokenRevoked(jti string, userID uint, issuedAt time.Time) bool {
+	return revocations.revoked(jti, userID, issuedAt)
+}
+
+// LoadRevocations fills the cache with the revocations stored in the database
+// since the previous sync, including those written by other instances. Rows
+// it has seen already are loaded again harmlessly.
+func LoadRevocations() error {
+	now := time.Now()
+	var rows []TokenRevocation
+	err := DB.Where("created_at > ? AND expires_at > ?", revocations.since().Add(-revocationSyncOverlap), now).
+		Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, rev := range rows {
+		revocations.add(rev)
+	}
+	revocations.markSynced(now)
+	return nil
+}
+
+// PurgeExpiredRevocations deletes revocations whose tokens have all expired
+// and drops them from the cache.
+func PurgeExpiredRevocations() (int64, error) {
+	now := time.Now()
+	revocations.prune(now)
+	result := DB.Where("expires_at < ?", now).Delete(&TokenRevocation{})
+	return result.RowsAffected, result.Error
+}
+
+// StartRevocationSweeper periodically garbage-collects expired revocations and
+// picks up revocations made by other instances, until ctx is cancelled.
+func StartRevocationSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := PurgeExpiredRevocations()
+				if err != nil {
+					slog.Error("Failed to purge expired token revocations", "error", err)
+				} else if purged > 0 {
+					slog.Info("Purged expired token revocations", "count", purged)
+				}
+				if err := LoadRevocations(); err != nil {
+					slog.Error("Failed to sync token revocations", "error", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevocationCache(t *testing.T) {
+	cache := newRevocationCache()
+	now := time.Now()
+
+	cache.add(TokenRevocation{ID: 1, JTI: "abc", UserID: 1, CreatedAt: now, ExpiresAt: now.Add(time.Minute)})
+
+	if !cache.revoked("abc", 1, now) {
+		t.Errorf("expected token abc to be revoked")
+	}
+	if cache.revoked("def", 1, now) {
+		t.Errorf("expected token def not to be revoked")
+	}
+
+	cache.add(TokenRevocation{ID: 2, UserID: 2, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+	if !cache.revoked("old", 2, now.Add(-2*time.Second)) {
+		t.Errorf("expected token issued before the user-wide revocation to be revoked")
+	}
+	if !cache.revoked("same", 2, now.Truncate(time.Microsecond)) {
+		t.Errorf("expected token issued with the user-wide revocation to be revoked")
+	}
+	if cache.revoked("new", 2, now.Add(time.Millisecond)) {
+		t.Errorf("expected token issued after the user-wide revocation in the same second to be valid")
+	}
+	if cache.revoked("other", 1, now.Add(-2*time.Second)) {
+		t.Errorf("user-wide revocation must not affect other users")
+	}
+
+	// Rows loaded again by an overlapping sync change nothing
+	cache.add(TokenRevocation{ID: 2, UserID: 2, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	cache.add(TokenRevocation{ID: 1, JTI: "abc", UserID: 1, CreatedAt: now, ExpiresAt: now.Add(time.Minute)})
+	if cache.revoked("new", 2, now.Add(time.Millisecond)) || !cache.revoked("abc", 1, now) {
+		t.Errorf("expected reloading revocations to be idempotent")
+	}
+
+	// An older revocation that arrives late does not move the cutoff back
+	cache.add(TokenRevocation{ID: 3, UserID: 2, CreatedAt: now.Add(-time.Second), ExpiresAt: now.Add(time.Hour)})
+	if !cache.revoked("same", 2, now.Truncate(time.Microsecond)) {
+		t.Errorf("expected the latest user-wide revocation to be kept")
+	}
+
+	cache.prune(now.Add(2 * time.Minute))
+	if cache.revoked("abc", 1, now) {
+		t.Errorf("expected expired revocation to be pruned")
+	}
+	if !cache.revoked("old", 2, now.Add(-2*time.Second)) {
+		t.Errorf("expected unexpired user-wide revocation to be kept")
+	}
+}
+
+func TestClientRevocationCache(t *testing.T) {
+	cache := newRevocationCache()
+	now := time.Now()
+
+	cache.add(TokenRevocation{ClientID: "app", UserID: 1, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+	if !cache.clientRevoked("app", 1, now.Add(-time.Second)) {
+		t.Errorf("expected the client's earlier tokens for the user to be revoked")
+	}
+	if cache.clientRevoked("app", 1, now.Add(time.Millisecond)) {
+		t.Errorf("expected tokens issued after a new consent to be valid")
+	}
+	if cache.clientRevoked("app", 2, now.Add(-time.Second)) || cache.clientRevoked("other", 1, now.Add(-time.Second)) {
+		t.Errorf("expected the revocation to be limited to the client and user")
+	}
+	if cache.revoked("jti", 1, now.Add(-time.Second)) {
+		t.Errorf("expected the user's other tokens to stay valid")
+	}
+
+	// Deleting the client revokes its tokens for every user
+	cache.add(TokenRevocation{JTI: "app", UserID: 3, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if !cache.clientRevoked("app", 2, now.Add(time.Second)) {
+		t.Errorf("expected every token of a deleted client to be revoked")
+	}
+
+	cache.prune(now.Add(2 * time.Hour))
+	if cache.clientRevoked("app", 1, now.Add(-time.Second)) {
+		t.Errorf("expected expired revocations to be pruned")
+	}
+}
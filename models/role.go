@@ -0,0 +1,169 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Built-in roles. Every user has exactly one role, "user" by default.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Permissions checked by the admin API.
+const (
+	PermissionUsersRead    = "users:read"     // list and inspect users
+	PermissionUsersManage  = "users:manage"   // disable, restore, unlock and assign roles
+	PermissionUsersDelete  = "users:delete"   // delete users
+	PermissionTasksReadAll = "tasks:read_all" // inspect the tasks of any user
+	PermissionRolesManage  = "roles:manage"   // create, change and delete custom roles
+
+	// PermissionAll grants every permission, including future ones.
+	PermissionAll = "*"
+)
+
+// AllPermissions lists the permissions a custom role may be given.
+var AllPermissions = []string{
+	PermissionUsersRead,
+	PermissionUsersManage,
+	PermissionUsersDelete,
+	PermissionTasksReadAll,
+	PermissionRolesManage,
+}
+
+var (
+	// ErrRoleBuiltin is returned when changing or deleting a built-in role.
+	ErrRoleBuiltin = errors.New("built-in roles cannot be changed")
+	// ErrRoleInUse is returned when deleting a role that is still assigned.
+	ErrRoleInUse = errors.New("role is still assigned to users")
+)
+
+// Role is a named set of permissions.
+type Role struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions" gorm:"serializer:json"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ValidPermission reports whether p can be granted to a custom role.
+func ValidPermission(p string) bool {
+	for _, known := range AllPermissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Builtin reports whether the role is one of the built-in roles.
+func (r Role) Builtin() bool {
+	return r.Name == RoleUser || r.Name == RoleAdmin
+}
+
+// Has reports whether the role grants the permission.
+func (r Role) Has(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == permission || p == PermissionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the role grants every permission of other.
+func (r Role) Covers(other Role) bool {
+	for _, p := range other.Permissions {
+		if !r.Has(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnsureDefaultRoles creates the built-in roles if they are missing.
+func EnsureDefaultRoles() error {
+	return DB.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).
+		Create(&[]Role{
+			{Name: RoleUser, Description: "Manages their own tasks", Permissions: []string{}},
+			{Name: RoleAdmin, Description: "Full access to the admin API", Permissions: []string{PermissionAll}},
+		}).Error
+}
+
+// GetRoles lists all roles by name.
+func GetRoles() []Role {
+	var roles []Role
+	DB.Order("name").Find(&roles)
+	return roles
+}
+
+// GetRole looks up a role by name.
+func GetRole(name string) (Role, bool) {
+	var role Role
+	if result := DB.Where("name = ?", name).First(&role); result.Error != nil {
+		return Role{}, false
+	}
+	return role, true
+}
+
+// AddRole creates a custom role.
+func AddRole(role Role) (Role, error) {
+	role.CreatedAt = time.Now()
+	if err := DB.Create(&role).Error; err != nil {
+		return Role{}, err
+	}
+	return role, nil
+}
+
+// UpdateRole replaces the description and permissions of a custom role.
+func UpdateRole(name, description string, permissions []string) (Role, error) {
+	role, found := GetRole(name)
+	if !found {
+		return Role{}, gorm.ErrRecordNotFound
+	}
+	if role.Builtin() {
+		return Role{}, ErrRoleBuiltin
+	}
+	role.Description = description
+	role.Permissions = permissions
+	if err := DB.Save(&role).Error; err != nil {
+		return Role{}, err
+	}
+	return role, nil
+}
+
+// DeleteRole deletes a custom role that no user has anymore.
+func DeleteRole(name string) (Role, error) {
+	role, found := GetRole(name)
+	if !found {
+		return Role{}, gorm.ErrRecordNotFound
+	}
+	if role.Builtin() {
+		return Role{}, ErrRoleBuiltin
+	}
+	var users int64
+	DB.Unscoped().Model(&User{}).Where("role = ?", name).Count(&users)
+	if users > 0 {
+		return Role{}, ErrRoleInUse
+	}
+	if err := DB.Delete(&role).Error; err != nil {
+		return Role{}, err
+	}
+	return role, nil
+}
+
+// UserHasPermission reports whether the role of an active user grants the permission.
+func UserHasPermission(userID uint, permission string) bool {
+	user, found := GetUserByID(userID)
+	if !found || user.DisabledAt != nil {
+		return false
+	}
+	role, found := GetRole(user.Role)
+	return found && role.Has(permission)
+}
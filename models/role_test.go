@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestRoleHas(t *testing.T) {
+	admin := Role{Name: RoleAdmin, Permissions: []string{PermissionAll}}
+	for _, p := range AllPermissions {
+		if !admin.Has(p) {
+			t.Errorf("expected admin to have %s", p)
+		}
+	}
+
+	user := Role{Name: RoleUser, Permissions: []string{}}
+	if user.Has(PermissionUsersRead) {
+		t.Errorf("expected user not to have %s", PermissionUsersRead)
+	}
+
+	support := Role{Name: "support", Permissions: []string{PermissionUsersRead, PermissionTasksReadAll}}
+	if !support.Has(PermissionTasksReadAll) || support.Has(PermissionUsersDelete) {
+		t.Errorf("expected support to have exactly its permissions")
+	}
+	if support.Builtin() || !admin.Builtin() {
+		t.Errorf("unexpected built-in flags")
+	}
+
+	if ValidPermission(PermissionAll) || ValidPermission("tasks:write") {
+		t.Errorf("expected only listed permissions to be valid for custom roles")
+	}
+}
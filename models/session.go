@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is one login of a user on a device. Its FamilyID is both the
+// refresh token family of the login and the "sid" claim of its access tokens.
+// LastJTI is the jti of the most recent access token issued to the session.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"-" gorm:"index"`
+	User       User       `json:"-" gorm:"foreignKey:UserID"`
+	FamilyID   string     `json:"-" gorm:"uniqueIndex"`
+	LastJTI    string     `json:"-"`
+	DeviceName string     `json:"device_name"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// AddSession records a new login session.
+func AddSession(session Session) (Session, error) {
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	if err := DB.Create(&session).Error; err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// GetSessions lists the active sessions of a user, most recently seen first.
+func GetSessions(userID uint) []Session {
+	var sessions []Session
+	DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions)
+	return sessions
+}
+
+// RefreshSession records that the session was refreshed: a new access token
+// with the given jti was issued and the session now lasts until expiresAt.
+func RefreshSession(familyID, jti string, expiresAt time.Time) error {
+	return DB.Model(&Session{}).Where("family_id = ?", familyID).Updates(map[string]interface{}{
+		"last_jti":     jti,
+		"last_seen_at": time.Now(),
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+// RevokeSession revokes one of the user's sessions: its refresh tokens and
+// every access token issued to it.
+func RevokeSession(id, userID uint, until time.Time) (Session, bool) {
+	var session Session
+	result := DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).First(&session)
+	if result.Error != nil {
+		return Session{}, false
+	}
+	if err := revokeSession(session, until); err != nil {
+		return Session{}, false
+	}
+	return session, true
+}
+
+// RevokeSessionByFamily revokes the session with the given refresh token
+// family, as RevokeSession does. Unknown families are ignored.
+func RevokeSessionByFamily(familyID string, until time.Time) error {
+	var session Session
+	if result := DB.Where("family_id = ? AND revoked_at IS NULL", familyID).First(&session); result.Error != nil {
+		return nil
+	}
+	return revokeSession(session, until)
+}
+
+// revokeSession marks the session revoked and revokes its tokens. until must
+// be at least the expiry of the last access token issued to the session.
+func revokeSession(session Session, until time.Time) error {
+	now := time.Now()
+	if err := DB.Model(&session).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	if err := RevokeRefreshTokenFamily(session.FamilyID); err != nil {
+		return err
+	}
+	return addRevocation(TokenRevocation{JTI: session.FamilyID, UserID: session.UserID, ExpiresAt: until})
+}
+
+// RevokeUserSessions marks every session of a user revoked. The caller
+// revokes their tokens, see RevokeUserRefreshTokens and RevokeAllTokens.
+func RevokeUserSessions(userID uint) error {
+	return DB.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// IsSessionRevoked reports whether the session with the given sid has been
+// revoked. Session revocations share the revocation cache with single tokens:
+// sids and jtis are both random IDs and never collide.
+func IsSessionRevoked(sid string) bool {
+	return revocations.revoked(sid, 0, time.Time{})
+}
+
+// sessionActivity buffers last-seen times so that authenticated requests do
+// not write to the database; FlushSessionActivity stores them in one statement.
+type sessionActivity struct {
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+var activity = &sessionActivity{pending: map[string]time.Time{}}
+
+// TouchSession records that the session with the given sid was just used.
+// It never blocks on the database.
+func TouchSession(sid string) {
+	activity.mu.Lock()
+	activity.pending[sid] = time.Now()
+	activity.mu.Unlock()
+}
+
+// FlushSessionActivity writes the buffered last-seen times of every touched
+// session and returns how many sessions were updated.
+func FlushSessionActivity() (int64, error) {
+	activity.mu.Lock()
+	pending := activity.pending
+	activity.pending = map[string]time.Time{}
+	activity.mu.Unlock()
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	values := make([]string, 0, len(pending))
+	args := make([]interface{}, 0, 2*len(pending))
+	for sid, seen := range pending {
+		values = append(values, "(?, ?::timestamptz)")
+		args = append(args, sid, seen)
+	}
+	result := DB.Exec(`UPDATE sessions SET last_seen_at = seen.at
+		FROM (VALUES `+strings.Join(values, ", ")+`) AS seen(family_id, at)
+		WHERE sessions.family_id = seen.family_id AND sessions.last_seen_at < seen.at`, args...)
+	return result.RowsAffected, result.Error
+}
+
+// StartSessionActivityRecorder periodically flushes the buffered last-seen
+// times until ctx is cancelled, and once more before it returns.
+func StartSessionActivityRecorder(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if _, err := FlushSessionActivity(); err != nil {
+					slog.Error("Failed to record session activity", "error", err)
+				}
+				return
+			case <-ticker.C:
+				if _, err := FlushSessionActivity(); err != nil {
+					slog.Error("Failed to record session activity", "error", err)
+				}
+			}
+		}
+	}()
+}
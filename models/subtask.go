@@ -0,0 +1,196 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrParentInvalid is returned when the parent of a task is not another
+	// task of the same user.
+	ErrParentInvalid = errors.New("parent must be another of your tasks")
+	// ErrParentCycle is returned when a task would become its own ancestor.
+	ErrParentCycle = errors.New("a task cannot be moved under its own subtask")
+	// ErrTaskTooDeep is returned when subtasks would be nested too deeply.
+	ErrTaskTooDeep = errors.New("subtasks are nested too deeply")
+)
+
+// maxHierarchyDepth bounds the walks up and down a task hierarchy, so that
+// a cycle created by concurrent updates cannot make them run forever. The
+// walks without a depth use UNION, which ends on a cycle by itself.
+const maxHierarchyDepth = 100
+
+// TaskTree is a task with its subtasks at every depth.
+type TaskTree struct {
+	Task
+	Children []TaskTree `json:"children"`
+}
+
+// ValidateParent checks that the task with the given ID (0 for a new task)
+// may become a subtask of parentID: the parent is another task of the user,
+// not one of the task's own subtasks, and the task with its subtasks stays
+// within maxDepth levels below a top-level task.
+func ValidateParent(taskID, parentID, userID uint, maxDepth int) error {
+	if parentID == taskID {
+		return ErrParentInvalid
+	}
+	if _, ok := GetTaskByID(parentID, userID); !ok {
+		return ErrParentInvalid
+	}
+
+	ancestors := ancestorIDs(DB, parentID)
+	if taskID != 0 {
+		for _, id := range ancestors {
+			if id == taskID {
+				return ErrParentCycle
+			}
+		}
+	}
+
+	// The parent's depth plus one, plus the levels of subtasks below the task
+	if len(ancestors)+1+subtreeHeight(DB, taskID) > maxDepth {
+		return ErrTaskTooDeep
+	}
+	return nil
+}
+
+// GetChildren returns the direct subtasks of one of the user's tasks, in
+// their manual order. It returns false if the task does not exist.
+func GetChildren(id, userID uint) ([]Task, bool) {
+	if _, ok := GetTaskByID(id, userID); !ok {
+		return nil, false
+	}
+	var children []Task
+	DB.Preload("Tags", orderTags).
+		Where("parent_id = ? AND user_id = ?", id, userID).
+		Order("position").Order("id").Find(&children)
+	fillComputed(children)
+	return children, true
+}
+
+// GetTaskTree returns one of the user's tasks with all its subtasks.
+func GetTaskTree(id, userID uint) (TaskTree, bool) {
+	root, ok := GetTaskByID(id, userID)
+	if !ok {
+		return TaskTree{}, false
+	}
+
+	var descendants []Task
+	DB.Preload("Tags", orderTags).
+		Where("id IN ?", descendantIDs(DB, id)).
+		Order("position").Order("id").Find(&descendants)
+	fillComputed(descendants)
+
+	byParent := map[uint][]Task{}
+	for _, t := range descendants {
+		byParent[*t.ParentID] = append(byParent[*t.ParentID], t)
+	}
+	var build func(t Task) TaskTree
+	build = func(t Task) TaskTree {
+		node := TaskTree{Task: t, Children: []TaskTree{}}
+		for _, child := range byParent[t.ID] {
+			node.Children = append(node.Children, build(child))
+		}
+		return node
+	}
+	return build(root), true
+}
+
+// fillProgress sets the subtask counts and progress of tasks with one query.
+// Progress is the percentage of completed subtasks at any depth; a task
+// without subtasks is at 0 or 100 depending on its own state.
+func fillProgress(tasks []Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	ids := make([]uint, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+
+	var counts []struct {
+		Root      uint
+		Total     int64
+		Completed int64
+	}
+	DB.Raw(`WITH RECURSIVE tree(root, id, completed) AS (
+			SELECT parent_id, id, completed FROM tasks WHERE parent_id IN ? AND deleted_at IS NULL
+			UNION
+			SELECT tree.root, t.id, t.completed FROM tasks t JOIN tree ON t.parent_id = tree.id WHERE t.deleted_at IS NULL
+		)
+		SELECT root, COUNT(*) AS total, COUNT(*) FILTER (WHERE completed) AS completed FROM tree GROUP BY root`, ids).
+		Scan(&counts)
+
+	byID := make(map[uint]int, len(counts))
+	for i, c := range counts {
+		byID[c.Root] = i
+	}
+	for i := range tasks {
+		t := &tasks[i]
+		if c, ok := byID[t.ID]; ok {
+			t.Subtasks = counts[c].Total
+			t.CompletedSubtasks = counts[c].Completed
+			t.Progress = int(100 * t.CompletedSubtasks / t.Subtasks)
+		} else if t.Completed {
+			t.Progress = 100
+		}
+	}
+}
+
+// ancestorIDs returns the IDs of the ancestors of a task, nearest first.
+func ancestorIDs(db *gorm.DB, id uint) []uint {
+	var ids []uint
+	db.Raw(`WITH RECURSIVE up(id, parent_id, depth) AS (
+			SELECT id, parent_id, 0 FROM tasks WHERE id = ?
+			UNION ALL
+			SELECT t.id, t.parent_id, up.depth + 1 FROM tasks t JOIN up ON t.id = up.parent_id WHERE up.depth < ?
+		)
+		SELECT id FROM up WHERE depth > 0 ORDER BY depth`, id, maxHierarchyDepth).Scan(&ids)
+	return ids
+}
+
+// descendantIDs returns the IDs of the subtasks of a task at every depth,
+// leaving out deleted ones.
+func descendantIDs(db *gorm.DB, id uint) []uint {
+	var ids []uint
+	db.Raw(`WITH RECURSIVE down(id) AS (
+			SELECT id FROM tasks WHERE parent_id = ? AND deleted_at IS NULL
+			UNION
+			SELECT t.id FROM tasks t JOIN down ON t.parent_id = down.id WHERE t.deleted_at IS NULL
+		)
+		SELECT id FROM down`, id).Scan(&ids)
+	return ids
+}
+
+// subtreeHeight returns how many levels of subtasks are below a task.
+func subtreeHeight(db *gorm.DB, id uint) int {
+	if id == 0 {
+		return 0
+	}
+	var height int
+	db.Raw(`WITH RECURSIVE down(id, depth) AS (
+			SELECT id, 1 FROM tasks WHERE parent_id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT t.id, down.depth + 1 FROM tasks t JOIN down ON t.parent_id = down.id WHERE t.deleted_at IS NULL AND down.depth < ?
+		)
+		SELECT COALESCE(MAX(depth), 0) FROM down`, id, maxHierarchyDepth).Scan(&height)
+	return height
+}
+
+// cascadeCompletion keeps a task's hierarchy consistent after its completion
+// changed: completing a task completes all its subtasks, and reopening a
+// task reopens its completed ancestors. Each moves to the done or first
+// status of its own project's workflow, under the same rules as if it were
+// changed by itself (see setCompletion); otherwise the change of the task
+// is rejected with the error of the first task that cannot follow.
+func cascadeCompletion(tx *gorm.DB, task Task, force bool) error {
+	ids := descendantIDs(tx, task.ID)
+	if !task.Completed {
+		ids = ancestorIDs(tx, task.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return setCompletion(tx, ids, task.Completed, force)
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tag is a label a user attaches to their tasks. Names are unique per user.
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `json:"-" gorm:"uniqueIndex:idx_tags_user_name"`
+	User      User      `json:"-" gorm:"foreignKey:UserID"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_tags_user_name"`
+	Color     string    `json:"color"`
+}
+
+// ErrTagExists is returned when a user already has a tag with the same name.
+var ErrTagExists = errors.New("a tag with this name already exists")
+
+// Tag matching modes of TaskFilter.
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// GetTags lists the tags of a user by name.
+func GetTags(userID uint) []Tag {
+	var tags []Tag
+	DB.Where("user_id = ?", userID).Order("name").Find(&tags)
+	return tags
+}
+
+// GetTag returns one of the user's tags.
+func GetTag(id, userID uint) (Tag, bool) {
+	var tag Tag
+	if err := DB.Where("id = ? AND user_id = ?", id, userID).First(&tag).Error; err != nil {
+		return Tag{}, false
+	}
+	return tag, true
+}
+
+// AddTag creates a tag for the user.
+func AddTag(tag Tag, userID uint) (Tag, error) {
+	tag.ID = 0
+	tag.UserID = userID
+	if tagNameTaken(tag.Name, userID, 0) {
+		return Tag{}, ErrTagExists
+	}
+	if err := DB.Create(&tag).Error; err != nil {
+		return Tag{}, err
+	}
+	return tag, nil
+}
+
+// UpdateTag renames or recolors one of the user's tags. It returns
+// gorm.ErrRecordNotFound for tags of other users.
+func UpdateTag(id, userID uint, name, color string) (Tag, error) {
+	tag, ok := GetTag(id, userID)
+	if !ok {
+		return Tag{}, gorm.ErrRecordNotFound
+	}
+	if tagNameTaken(name, userID, id) {
+		return Tag{}, ErrTagExists
+	}
+	tag.Name = name
+	tag.Color = color
+	if err := DB.Save(&tag).Error; err != nil {
+		return Tag{}, err
+	}
+	return tag, nil
+}
+
+// DeleteTag deletes one of the user's tags. The database detaches it from
+// every task.
+func DeleteTag(id, userID uint) (Tag, bool) {
+	tag, ok := GetTag(id, userID)
+	if !ok {
+		return Tag{}, false
+	}
+	if err := DB.Delete(&tag).Error; err != nil {
+		return Tag{}, false
+	}
+	return tag, true
+}
+
+// tagNameTaken reports whether another tag of the user has the name.
+func tagNameTaken(name string, userID, exceptID uint) bool {
+	var count int64
+	DB.Model(&Tag{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, exceptID).Count(&count)
+	return count > 0
+}
+
+// AttachTags adds the user's tags with the given IDs to one of their tasks
+// and returns the task with all its tags. Tags that are already attached are
+// kept. It returns false if the task or any of the tags is not the user's.
+func AttachTags(taskID, userID uint, tagIDs []uint) (Task, bool) {
+	task, ok := GetTaskByID(taskID, userID)
+	if !ok {
+		return Task{}, false
+	}
+	var tags []Tag
+	DB.Where("id IN ? AND user_id = ?", tagIDs, userID).Find(&tags)
+	if len(tags) != len(unique(tagIDs)) {
+		return Task{}, false
+	}
+	if err := DB.Model(&task).Association("Tags").Append(tags); err != nil {
+		return Task{}, false
+	}
+	return GetTaskByID(taskID, userID)
+}
+
+// DetachTag removes a tag from one of the user's tasks and returns the task.
+// It returns false if the task or the tag is not the user's.
+func DetachTag(taskID, tagID, userID uint) (Task, bool) {
+	task, ok := GetTaskByID(taskID, userID)
+	if !ok {
+		return Task{}, false
+	}
+	tag, ok := GetTag(tagID, userID)
+	if !ok {
+		return Task{}, false
+	}
+	if err := DB.Model(&task).Association("Tags").Delete(&tag); err != nil {
+		return Task{}, false
+	}
+	return GetTaskByID(taskID, userID)
+}
+
+// unique returns items without duplicates, in their first order.
+func unique[T comparable](items []T) []T {
+	seen := make(map[T]bool, len(items))
+	var result []T
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
@@ -16,57 +17,337 @@ type Task struct {
 	Completed   bool           	`json:"completed"`
 	UserID 		uint 			`json:"user_id"`
 	User   		User 			`json:"-" gorm:"foreignKey:UserID"`
+
+	// Status is the task's place in the workflow of its project (see
+	// Workflow), and Completed follows from it. CompletedAt is when the task
+	// last reached a done status.
+	Status      string     `json:"status" gorm:"index"`
+	CompletedAt *time.Time `json:"completed_at"`
+
+	// StartAt and DueAt are instants; clients send them with their UTC offset.
+	// ReminderMinutes asks for a reminder that many minutes before DueAt, at
+	// RemindAt, which is derived and cannot be set directly.
+	StartAt         *time.Time `json:"start_at"`
+	DueAt           *time.Time `json:"due_at" gorm:"index"`
+	ReminderMinutes *int       `json:"reminder_minutes"`
+	RemindAt        *time.Time `json:"remind_at" gorm:"index"`
+	ReminderSentAt  *time.Time `json:"-"`
+
+	// Priority ranks tasks from PriorityNone to PriorityHigh. Position is the
+	// user's manual order, changed only by MoveTask; lower comes first.
+	Priority int     `json:"priority"`
+	Position float64 `json:"position" gorm:"index"`
+
+	// Tags are attached with AttachTags and DetachTag; the tags sent with a
+	// task when creating or updating it are ignored.
+	Tags []Tag `json:"tags" gorm:"many2many:task_tags;constraint:OnDelete:CASCADE"`
+
+	// ProjectID is the project the task belongs to, if any.
+	ProjectID *uint    `json:"project_id" gorm:"index"`
+	Project   *Project `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:SET NULL"`
+
+	// ParentID makes the task a subtask. Subtasks are counted and rolled up
+	// into Progress when tasks are read.
+	ParentID          *uint `json:"parent_id" gorm:"index"`
+	Parent            *Task `json:"-" gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE"`
+	Subtasks          int64 `json:"subtasks" gorm:"-"`
+	CompletedSubtasks int64 `json:"completed_subtasks" gorm:"-"`
+	Progress          int   `json:"progress" gorm:"-"`
+
+	// Recurrence is an RRULE (see package rrule) expanded from DueAt in
+	// TimeZone (default UTC). Completing the task creates the next
+	// occurrence, linked by NextOccurrenceID. Occurrence numbers the tasks of
+	// a series, starting at 1, for the rule's COUNT.
+	Recurrence       string `json:"recurrence"`
+	TimeZone         string `json:"time_zone"`
+	Occurrence       int    `json:"occurrence"`
+	NextOccurrenceID *uint  `json:"next_occurrence_id"`
+
+	// BlockedBy lists the tasks this one waits for (see TaskDependency), and
+	// Blocked is set while any of them is open.
+	BlockedBy []uint `json:"blocked_by" gorm:"-"`
+	Blocked   bool   `json:"blocked" gorm:"-"`
+}
+
+// Task priorities.
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+// Orders of FindTasks.
+const (
+	SortPosition = "position"
+	SortPriority = "priority"
+	SortDue      = "due"
+	SortCreated  = "created"
+)
+
+// taskOrders maps each sort to its SQL order and whether it is descending by
+// default. Ties fall back to the manual order.
+var taskOrders = map[string]struct {
+	column string
+	desc   bool
+}{
+	SortPosition: {"position", false},
+	SortPriority: {"priority", true},
+	SortDue:      {"due_at", false},
+	SortCreated:  {"created_at", true},
+}
+
+// ValidTaskSort reports whether sort is one of the Sort constants.
+func ValidTaskSort(sort string) bool {
+	_, ok := taskOrders[sort]
+	return ok
+}
+
+// TaskFilter narrows and orders the tasks returned by FindTasks. Zero fields
+// do not filter; tasks are in their manual order unless Sort is set.
+type TaskFilter struct {
+	DueFrom   *time.Time // due at or after
+	DueBefore *time.Time // due strictly before
+	Overdue   bool       // not completed and past due
+
+	ProjectID *uint  // only tasks of this project
+	Status    string // only tasks in this status
+
+	Tags     []string // tag names
+	TagMatch string   // TagMatchAny (default) or TagMatchAll of Tags
+
+	Sort  string // one of the Sort constants
+	Order string // "asc" or "desc"; empty uses the default of Sort
+}
+
+// scheduleReminder derives RemindAt from DueAt and ReminderMinutes.
+func (t *Task) scheduleReminder() {
+	t.RemindAt = nil
+	if t.DueAt != nil && t.ReminderMinutes != nil {
+		remindAt := t.DueAt.Add(-time.Duration(*t.ReminderMinutes) * time.Minute)
+		t.RemindAt = &remindAt
+	}
 }
 
 // GetTasks retrieves all tasks from the database
 func GetTasks(userID uint) []Task {
+	return FindTasks(userID, TaskFilter{})
+}
+
+// FindTasks retrieves the tasks of a user that match filter.
+func FindTasks(userID uint, filter TaskFilter) []Task {
+	query := DB.Where("user_id = ?", userID)
+	if filter.DueFrom != nil {
+		query = query.Where("due_at >= ?", *filter.DueFrom)
+	}
+	if filter.DueBefore != nil {
+		query = query.Where("due_at < ?", *filter.DueBefore)
+	}
+	if filter.Overdue {
+		query = query.Where("completed = ? AND due_at < ?", false, time.Now())
+	}
+
+	if filter.ProjectID != nil {
+		query = query.Where("project_id = ?", *filter.ProjectID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if len(filter.Tags) > 0 {
+		tagged := DB.Table("task_tags").
+			Select("task_tags.task_id").
+			Joins("JOIN tags ON tags.id = task_tags.tag_id").
+			Where("tags.user_id = ? AND tags.name IN ?", userID, filter.Tags)
+		if filter.TagMatch == TagMatchAll {
+			tagged = tagged.Group("task_tags.task_id").
+				Having("COUNT(DISTINCT tags.name) = ?", len(unique(filter.Tags)))
+		}
+		query = query.Where("id IN (?)", tagged)
+	}
+
+	order, ok := taskOrders[filter.Sort]
+	if !ok {
+		order = taskOrders[SortPosition]
+	}
+	direction := "ASC"
+	if filter.Order == "desc" || (filter.Order == "" && order.desc) {
+		direction = "DESC"
+	}
+	// Tasks without a due date come last either way
+	query = query.Order(order.column + " " + direction + " NULLS LAST").Order("position").Order("id")
+
 	var tasks []Task
-	DB.Where("user_id = ?", userID).Find(&tasks)
+	query.Preload("Tags", orderTags).Find(&tasks)
+	fillComputed(tasks)
 	return tasks
 }
 
-// AddTask adds a new task and returns it with its ID set by the DB
-func AddTask(task Task, userID uint) Task {
+// fillComputed sets the fields of tasks that are derived from other rows:
+// subtask progress and blockers.
+func fillComputed(tasks []Task) {
+	fillProgress(tasks)
+	fillBlocked(tasks)
+}
+
+// withComputed returns task with its derived fields set.
+func withComputed(task Task) Task {
+	tasks := []Task{task}
+	fillComputed(tasks)
+	return tasks[0]
+}
+
+// orderTags lists preloaded tags by name.
+func orderTags(db *gorm.DB) *gorm.DB {
+	return db.Order("name")
+}
+
+// AddTask adds a new task and returns it with its ID set by the DB. A task
+// without a status starts in the first status of its workflow, or the done
+// one if it is completed. It returns ErrWIPLimit if that column of the
+// project board is full.
+func AddTask(task Task, userID uint) (Task, error) {
 	task.UserID = userID
 
+	wf := WorkflowFor(DB, task.ProjectID)
+	task.Status = statusOf(task, wf)
+	task.Completed = wf.IsDone(task.Status)
+	task.CompletedAt = nil
+	if task.Completed {
+		now := time.Now()
+		task.CompletedAt = &now
+	}
+
 	task.CreatedAt = time.Now()
+	task.ReminderSentAt = nil
+	task.scheduleReminder()
+	task.Tags = nil
+	task.NextOccurrenceID = nil
+	task.Occurrence = 0
+	if task.Recurrence != "" {
+		task.Occurrence = 1
+	}
 
-	DB.Create(&task)
-	return task
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
+		if task.ProjectID != nil {
+			if err := checkWIPLimit(tx, wf, *task.ProjectID, task.Status, task.ID); err != nil {
+				return err
+			}
+		}
+		task.Position = nextPosition(tx, userID)
+		return tx.Omit(clause.Associations).Create(&task).Error
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	if task.Completed {
+		task.Progress = 100
+	}
+	return task, nil
 }
 
 // GetTaskByID retrieves a single task by its ID
 func GetTaskByID(id , userID uint) (Task, bool) {
 	var task Task
-	result := DB.Where("id = ? AND user_id = ?", id, userID).First(&task, id)
+	result := DB.Preload("Tags", orderTags).Where("id = ? AND user_id = ?", id, userID).First(&task, id)
 	if result.Error != nil {
 		return Task{}, false
 	}
-	return task, true
+	return withComputed(task), true
 }
 
-// UpdateTask updates the task with the given ID
-func UpdateTask(id, userID uint, updated Task) (Task, bool) {
+// UpdateTask updates the task with the given ID. Status changes must be
+// allowed by the workflow of the task's project; see resolveStatus for how
+// Completed is kept working. Completing a task completes its subtasks and
+// creates the next occurrence of a recurring task; reopening it reopens its
+// ancestors, see cascadeCompletion. A task with open blockers cannot be
+// completed unless force is set. It returns gorm.ErrRecordNotFound if the task does not exist,
+// ErrStatusUnknown or ErrStatusTransition for a rejected status,
+// ErrWIPLimit if a column the task, its subtasks or its next occurrence
+// move to on a project board is full, and ErrTaskBlocked.
+func UpdateTask(id, userID uint, updated Task, force bool) (Task, error) {
 	var existing Task
-	result := DB.Where("id = ? AND user_id = ?", id, userID).First(&existing)
+	result := DB.Preload("Tags", orderTags).Where("id = ? AND user_id = ?", id, userID).First(&existing)
 	if result.Error != nil {
-		return Task{}, false
+		return Task{}, result.Error
 	}
 
+	wf := WorkflowFor(DB, updated.ProjectID)
+	if err := resolveStatus(existing, &updated, wf); err != nil {
+		return Task{}, err
+	}
+	updated.scheduleReminder()
+	updated.Tags = existing.Tags
 	if updated.Title == existing.Title &&
 		updated.Description == existing.Description &&
-		updated.Completed == existing.Completed {
-		return existing, true
+		updated.Status == existing.Status &&
+		updated.Completed == existing.Completed &&
+		updated.Priority == existing.Priority &&
+		sameValue(updated.ProjectID, existing.ProjectID) &&
+		sameValue(updated.ParentID, existing.ParentID) &&
+		updated.Recurrence == existing.Recurrence &&
+		updated.TimeZone == existing.TimeZone &&
+		sameTime(updated.StartAt, existing.StartAt) &&
+		sameTime(updated.DueAt, existing.DueAt) &&
+		sameValue(updated.ReminderMinutes, existing.ReminderMinutes) {
+		return withComputed(existing), nil
 	}
 
 	updated.ID = existing.ID
 	updated.CreatedAt = existing.CreatedAt
 	updated.UserID = existing.UserID
-	DB.Save(&updated)
-	return updated, true
+	updated.Position = existing.Position
+	updated.NextOccurrenceID = existing.NextOccurrenceID
+	// A changed rule starts a new series
+	updated.Occurrence = existing.Occurrence
+	if updated.Recurrence != existing.Recurrence || updated.TimeZone != existing.TimeZone {
+		updated.Occurrence = 0
+		if updated.Recurrence != "" {
+			updated.Occurrence = 1
+		}
+	}
+	// A moved reminder fires again
+	updated.ReminderSentAt = existing.ReminderSentAt
+	if !sameTime(updated.RemindAt, existing.RemindAt) {
+		updated.ReminderSentAt = nil
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkBlockers(tx, existing, updated, force); err != nil {
+			return err
+		}
+		if updated.Status != existing.Status || !sameValue(updated.ProjectID, existing.ProjectID) {
+			if err := lockUserTasks(tx, userID); err != nil {
+				return err
+			}
+			if updated.ProjectID != nil {
+				if err := checkWIPLimit(tx, wf, *updated.ProjectID, updated.Status, updated.ID); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(&updated).Error; err != nil {
+			return err
+		}
+		if updated.Completed == existing.Completed {
+			return nil
+		}
+		if err := cascadeCompletion(tx, updated, force); err != nil {
+			return err
+		}
+		if updated.Completed {
+			return createNextOccurrence(tx, &updated)
+		}
+		return nil
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return withComputed(updated), nil
 }
 
-// DeleteTask deletes a task by ID
+// DeleteTask deletes a task by ID, with all its subtasks
 func DeleteTask(id, userID uint) (Task, bool) {
 	var task Task
 	result := DB.Where("id = ? AND user_id = ?", id, userID).Unscoped().First(&task)
@@ -77,6 +358,44 @@ func DeleteTask(id, userID uint) (Task, bool) {
 		return Task{}, false // Already deleted
 	}
 
-	DB.Delete(&task)
+	// Subtasks are deleted with their parent, in one statement so that they
+	// share its deletion time
+	ids := append(descendantIDs(DB, task.ID), task.ID)
+	DB.Where("id IN ?", ids).Delete(&Task{})
 	return task, true
 }
+
+// sameTime reports whether two optional instants are equal.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// sameValue reports whether two optional values are equal.
+func sameValue[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// GetDueReminders returns the open tasks, with their users, whose reminder
+// time has come and whose reminder has not been sent yet.
+func GetDueReminders(now time.Time) []Task {
+	var tasks []Task
+	DB.Preload("User").
+		Where("remind_at <= ? AND reminder_sent_at IS NULL AND completed = ?", now, false).
+		Order("remind_at").Find(&tasks)
+	return tasks
+}
+
+// ClaimReminder marks the reminder of a task as sent. It returns false if it
+// was already claimed, e.g. by another instance, so every reminder is sent once.
+func ClaimReminder(id uint) bool {
+	result := DB.Model(&Task{}).
+		Where("id = ? AND reminder_sent_at IS NULL", id).
+		Update("reminder_sent_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// positionGap is the distance between neighbouring tasks after a new task is
+// appended or the positions of a user are renumbered. A move places the task
+// halfway between its new neighbours, so about 30 moves into the same gap
+// fit before the user's tasks have to be renumbered.
+const (
+	positionGap    = 1024
+	minPositionGap = 1e-6
+)
+
+// nextPosition returns the position after the last task of the user.
+func nextPosition(db *gorm.DB, userID uint) float64 {
+	var last float64
+	db.Model(&Task{}).Where("user_id = ?", userID).Select("COALESCE(MAX(position), 0)").Scan(&last)
+	return last + positionGap
+}
+
+// MoveTask moves a task of the user directly before the target task, or
+// after it. Only the moved task is updated, unless its new neighbours are too
+// close to fit it between them and the user's tasks are renumbered first.
+// It returns gorm.ErrRecordNotFound if either task does not exist.
+func MoveTask(id, targetID, userID uint, after bool) (Task, error) {
+	var task Task
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&task).Error; err != nil {
+			return err
+		}
+
+		position, err := positionNextTo(tx, task.ID, targetID, userID, after)
+		if err == errPositionsCrowded {
+			if err := renumberTasks(tx, userID); err != nil {
+				return err
+			}
+			position, err = positionNextTo(tx, task.ID, targetID, userID, after)
+		}
+		if err != nil {
+			return err
+		}
+
+		task.Position = position
+		return tx.Model(&task).UpdateColumn("position", position).Error
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return task, nil
+}
+
+// errPositionsCrowded means there is no room between two tasks.
+var errPositionsCrowded = errors.New("no room between task positions")
+
+// positionNextTo returns the position between the target and its neighbour on
+// the given side, ignoring the task being moved.
+func positionNextTo(tx *gorm.DB, movedID, targetID, userID uint, after bool) (float64, error) {
+	var target Task
+	if err := tx.Where("id = ? AND user_id = ?", targetID, userID).First(&target).Error; err != nil {
+		return 0, err
+	}
+
+	// Tasks sharing the target's position have no defined order, e.g. those
+	// created before positions existed
+	var ties int64
+	tx.Model(&Task{}).
+		Where("user_id = ? AND position = ? AND id NOT IN ?", userID, target.Position, []uint{movedID, targetID}).
+		Count(&ties)
+	if ties > 0 {
+		return 0, errPositionsCrowded
+	}
+
+	comparison, order, step := "position < ?", "position DESC", -float64(positionGap)
+	if after {
+		comparison, order, step = "position > ?", "position ASC", positionGap
+	}
+	var neighbours []float64
+	tx.Model(&Task{}).
+		Where("user_id = ? AND id <> ?", userID, movedID).
+		Where(comparison, target.Position).
+		Order(order).Limit(1).Pluck("position", &neighbours)
+	if len(neighbours) == 0 {
+		return target.Position + step, nil
+	}
+
+	neighbour := neighbours[0]
+	if diff := neighbour - target.Position; diff < 2*minPositionGap && diff > -2*minPositionGap {
+		return 0, errPositionsCrowded
+	}
+	return (target.Position + neighbour) / 2, nil
+}
+
+// renumberTasks spreads the positions of the user's tasks evenly, keeping
+// their order.
+func renumberTasks(tx *gorm.DB, userID uint) error {
+	var ids []uint
+	if err := tx.Model(&Task{}).Where("user_id = ?", userID).Order("position").Order("id").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if err := tx.Model(&Task{}).Where("id = ?", id).UpdateColumn("position", float64(i+1)*positionGap).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -17,7 +17,10 @@ func TestAddTask(t *testing.T) {
 		Completed:   false,
 	}
 
-	added := AddTask(task, userID)
+	added, err := AddTask(task, userID)
+	if err != nil {
+		t.Fatalf("expected the task to be added, got %v", err)
+	}
 
 	// Check if an ID is assigned
 	if added.ID == 0 {
@@ -141,10 +144,10 @@ func TestUpdateTask(t *testing.T) {
 	var existingID uint = 1
 	var existingUserID uint = 1
 
-	task, updated := UpdateTask(existingID, existingUserID, updatedTask)
+	task, err := UpdateTask(existingID, existingUserID, updatedTask, false)
 
-	if !updated {
-		t.Errorf("Expected task with ID %d to be updated, but UpdateTask returned false", existingID)
+	if err != nil {
+		t.Errorf("Expected task with ID %d to be updated, but UpdateTask returned %v", existingID, err)
 	}
 
 	if task.ID != existingID {
@@ -153,10 +156,10 @@ func TestUpdateTask(t *testing.T) {
 
 	// Test non-existing task
 	var nonExistingID uint = 9999
-	_, updated = UpdateTask(nonExistingID,existingUserID, updatedTask)
+	_, err = UpdateTask(nonExistingID,existingUserID, updatedTask, false)
 
-	if updated {
-		t.Errorf("Expected no task to be updated for ID %d, but got true", nonExistingID)
+	if err == nil {
+		t.Errorf("Expected no task to be updated for ID %d, but got no error", nonExistingID)
 	}
 
 	nonExistingUser := "example@example.com"
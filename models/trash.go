@@ -0,0 +1,183 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrParentDeleted is returned when a subtask is restored while its parent
+// is still in the trash.
+var ErrParentDeleted = errors.New("restore the parent task first")
+
+// TrashedTask is a deleted task, kept until PurgeAt.
+type TrashedTask struct {
+	Task
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// GetTrash returns the deleted tasks of a user, most recently deleted first,
+// with the time they are purged after retention.
+func GetTrash(userID uint, retention time.Duration) []TrashedTask {
+	var tasks []Task
+	DB.Unscoped().Preload("Tags", orderTags).
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").Order("id").Find(&tasks)
+
+	trash := make([]TrashedTask, len(tasks))
+	for i, t := range tasks {
+		trash[i] = TrashedTask{Task: t, DeletedAt: t.DeletedAt.Time, PurgeAt: t.DeletedAt.Time.Add(retention)}
+	}
+	return trash
+}
+
+// RestoreTask takes a deleted task of the user out of the trash, with the
+// subtasks that were deleted along with it. A task whose status is no longer
+// part of its project's workflow starts over in it. It returns
+// gorm.ErrRecordNotFound if the task is not in the trash, ErrParentDeleted
+// for a subtask of a deleted task, and ErrWIPLimit if the tasks do not fit
+// in their columns of a project board.
+func RestoreTask(id, userID uint) (Task, error) {
+	var task Task
+	if err := DB.Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).
+		First(&task).Error; err != nil {
+		return Task{}, err
+	}
+	if task.ParentID != nil {
+		if _, ok := GetTaskByID(*task.ParentID, userID); !ok {
+			return Task{}, ErrParentDeleted
+		}
+	}
+
+	deletedAt := task.DeletedAt.Time
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserTasks(tx, userID); err != nil {
+			return err
+		}
+		ids := append(deletedSubtreeIDs(tx, id, deletedAt), id)
+		if err := tx.Unscoped().Model(&Task{}).Where("id IN ?", ids).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		var restored []Task
+		if err := tx.Select("id", "project_id", "status", "completed").
+			Where("id IN ?", ids).Find(&restored).Error; err != nil {
+			return err
+		}
+		workflows := map[uint]Workflow{}
+		joining := map[boardColumn][]uint{}
+		for _, t := range restored {
+			key := uint(0)
+			if t.ProjectID != nil {
+				key = *t.ProjectID
+			}
+			wf, ok := workflows[key]
+			if !ok {
+				wf = WorkflowFor(tx, t.ProjectID)
+				workflows[key] = wf
+			}
+			if !wf.Has(t.Status) {
+				t.Status = wf.Initial()
+				if t.Completed {
+					t.Status = wf.DoneStatus()
+				}
+				if err := tx.Model(&t).UpdateColumn("status", t.Status).Error; err != nil {
+					return err
+				}
+			}
+			col := boardColumn{key, t.Status}
+			joining[col] = append(joining[col], t.ID)
+		}
+		return checkColumnLimits(tx, workflows, joining)
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	restored, _ := GetTaskByID(id, userID)
+	return restored, nil
+}
+
+// PurgeTask deletes a task of the user for good, in the trash or not, with
+// all its subtasks, tags and dependencies. It returns false if the task does
+// not exist.
+func PurgeTask(id, userID uint) (Task, bool) {
+	var task Task
+	if err := DB.Unscoped().Where("id = ? AND user_id = ?", id, userID).First(&task).Error; err != nil {
+		return Task{}, false
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		_, err := hardDeleteTasks(tx, []uint{id})
+		return err
+	}); err != nil {
+		return Task{}, false
+	}
+	return task, true
+}
+
+// PurgeTrash deletes for good the tasks that have been in the trash since
+// before the given time and returns how many it deleted, subtasks included.
+// Tasks deleted along with their user's account are kept, so that the
+// account can still be restored with them.
+func PurgeTrash(before time.Time) (int64, error) {
+	var ids []uint
+	if err := DB.Unscoped().Model(&Task{}).
+		Where("deleted_at < ?", before).
+		Where("user_id IN (?)", DB.Model(&User{}).Select("id")).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var purged int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		purged, err = hardDeleteTasks(tx, ids)
+		return err
+	})
+	return purged, err
+}
+
+// hardDeleteTasks removes tasks and their subtasks from the database and
+// returns how many it removed. Their tags and dependencies go with them
+// through the foreign keys, and links from earlier occurrences are cleared.
+func hardDeleteTasks(tx *gorm.DB, ids []uint) (int64, error) {
+	ids = subtreeIDs(tx, ids)
+	if err := tx.Unscoped().Model(&Task{}).Where("next_occurrence_id IN ?", ids).
+		UpdateColumn("next_occurrence_id", nil).Error; err != nil {
+		return 0, err
+	}
+	result := tx.Unscoped().Where("id IN ?", ids).Delete(&Task{})
+	return result.RowsAffected, result.Error
+}
+
+// subtreeIDs returns the given task IDs with the IDs of all their subtasks,
+// deleted or not.
+func subtreeIDs(db *gorm.DB, ids []uint) []uint {
+	var all []uint
+	db.Raw(`WITH RECURSIVE down(id) AS (
+			SELECT id FROM tasks WHERE id IN ?
+			UNION
+			SELECT t.id FROM tasks t JOIN down ON t.parent_id = down.id
+		)
+		SELECT id FROM down`, ids).Scan(&all)
+	return all
+}
+
+// deletedSubtreeIDs returns the IDs of the subtasks of a task that were
+// deleted at the given time, that is together with it.
+func deletedSubtreeIDs(db *gorm.DB, id uint, deletedAt time.Time) []uint {
+	var ids []uint
+	db.Raw(`WITH RECURSIVE down(id) AS (
+			SELECT id FROM tasks WHERE parent_id = ? AND deleted_at = ?
+			UNION
+			SELECT t.id FROM tasks t JOIN down ON t.parent_id = down.id WHERE t.deleted_at = ?
+		)
+		SELECT id FROM down`, id, deletedAt, deletedAt).Scan(&ids)
+	return ids
+}
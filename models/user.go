@@ -11,6 +11,13 @@ type User struct {
 	ID       	uint   			`json:"id" gorm:"primaryKey"`
 	Email    	string 			`gorm:"unique" json:"email"`
 	Password 	string 			`json:"password"`
+	EmailVerified	bool		`json:"email_verified"`
+	EmailVerifiedAt	*time.Time	`json:"email_verified_at"`
+	TOTPSecret	string		`json:"-"`
+	TOTPEnabled	bool		`json:"totp_enabled"`
+	TOTPLastStep	int64		`json:"-"`
+	Role		string		`json:"role" gorm:"default:user;index"`
+	DisabledAt	*time.Time	`json:"disabled_at"`
 	CreatedAt 	time.Time 		`json:"created_at"`
 	UpdatedAt   time.Time      	`json:"updated_at"`
 	DeletedAt   gorm.DeletedAt 	`gorm:"index" json:"-"`
@@ -49,6 +56,18 @@ func GetUserByEmail(email string) (User, bool) {
 	return user, true
 }
 
+func GetUserByID(id uint) (User, bool) {
+
+	var user User
+
+	result := DB.First(&user, id)
+
+	if result.Error != nil {
+		return User{}, false
+	}
+	return user, true
+}
+
 func UpdateUser(id uint, updatedUser User) (User, bool){
 
 	var existingUser User
@@ -70,6 +89,20 @@ func UpdateUser(id uint, updatedUser User) (User, bool){
 	return updatedUser, true
 }
 
+// MarkEmailVerified records that the user proved ownership of their email address.
+func MarkEmailVerified(id uint) (User, bool) {
+	var user User
+	if result := DB.First(&user, id); result.Error != nil {
+		return User{}, false
+	}
+
+	now := time.Now()
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	DB.Model(&user).Updates(map[string]interface{}{"email_verified": true, "email_verified_at": now})
+	return user, true
+}
+
 func DeleteUser(id uint) (User, bool){
 	
 	var user User
@@ -82,11 +115,95 @@ func DeleteUser(id uint) (User, bool){
 		return User{}, false // Already deleted
 	}
 	
-	tasks := GetTasks(user.ID)
-	for _, task := range tasks{
-		DeleteTask(task.ID, user.ID)
-	}
+	// Tasks share the user's deletion time so RestoreUser can bring them back
+	now := time.Now()
+	DB.Model(&Task{}).Where("user_id = ?", user.ID).Update("deleted_at", now)
+
+	// Credentials of a deleted account must stop working immediately
+	RevokeUserRefreshTokens(user.ID)
+	RevokeUserPersonalAccessTokens(user.ID)
 	
-	DB.Delete(&user)
+	DB.Model(&user).Update("deleted_at", now)
+	user.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	return user, true
+}
+
+// User statuses accepted by GetUsersByStatus.
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusDeleted  = "deleted"
+)
+
+// GetUsersByStatus lists users with the given status, or every user that is
+// not deleted when status is empty.
+func GetUsersByStatus(status string) []User {
+	var users []User
+	query := DB.Order("id")
+	switch status {
+	case UserStatusActive:
+		query = query.Where("disabled_at IS NULL")
+	case UserStatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	case UserStatusDeleted:
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	query.Find(&users)
+	return users
+}
+
+// GetUserByIDUnscoped looks up a user by ID, including deleted users.
+func GetUserByIDUnscoped(id uint) (User, bool) {
+	var user User
+	if result := DB.Unscoped().First(&user, id); result.Error != nil {
+		return User{}, false
+	}
 	return user, true
+}
+
+// SetUserRole assigns an existing role to a user.
+func SetUserRole(id uint, role string) (User, bool) {
+	if _, found := GetRole(role); !found {
+		return User{}, false
+	}
+	result := DB.Model(&User{}).Where("id = ?", id).Update("role", role)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return User{}, false
+	}
+	return GetUserByID(id)
+}
+
+// DisableUser blocks a user from signing in until RestoreUser is called.
+func DisableUser(id uint) (User, bool) {
+	now := time.Now()
+	result := DB.Model(&User{}).Where("id = ? AND disabled_at IS NULL", id).Update("disabled_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return User{}, false
+	}
+	return GetUserByID(id)
+}
+
+// RestoreUser re-enables a disabled user, or undeletes a deleted user together
+// with the tasks that were deleted with the account.
+func RestoreUser(id uint) (User, bool) {
+	user, found := GetUserByIDUnscoped(id)
+	if !found || (user.DisabledAt == nil && !user.DeletedAt.Valid) {
+		return User{}, false
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if user.DeletedAt.Valid {
+			if err := tx.Unscoped().Model(&Task{}).
+				Where("user_id = ? AND deleted_at = ?", id, user.DeletedAt.Time).
+				Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Model(&User{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"disabled_at": nil, "deleted_at": nil}).Error
+	})
+	if err != nil {
+		return User{}, false
+	}
+	return GetUserByID(id)
 }
\ No newline at end of file
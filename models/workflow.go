@@ -0,0 +1,334 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of the default workflow.
+const (
+	StatusTodo  = "todo"
+	StatusDoing = "doing"
+	StatusDone  = "done"
+)
+
+var (
+	// ErrStatusUnknown is returned for a status that is not part of the
+	// workflow of the task's project.
+	ErrStatusUnknown = errors.New("status is not part of the workflow")
+	// ErrStatusTransition is returned for a status change the workflow does
+	// not allow.
+	ErrStatusTransition = errors.New("status change is not allowed by the workflow")
+	// ErrStatusInUse is returned when a workflow change removes a status that
+	// tasks still have.
+	ErrStatusInUse = errors.New("status is still used by tasks")
+)
+
+// Workflow is the set of statuses tasks of a project move through.
+// Statuses are in board order and the first one is where new tasks start.
+// Transitions lists the statuses each status may move to; without
+// Transitions every change is allowed. Tasks in a Done status are completed.
+// Limits caps how many tasks of the project may be in a status on its board;
+// statuses without a limit take any number.
+type Workflow struct {
+	Statuses    []string            `json:"statuses"`
+	Transitions map[string][]string `json:"transitions,omitempty"`
+	Done        []string            `json:"done"`
+	Limits      map[string]int      `json:"wip_limits,omitempty"`
+}
+
+// DefaultWorkflow is the workflow of tasks without a project and of projects
+// that do not define their own.
+var DefaultWorkflow = Workflow{
+	Statuses: []string{StatusTodo, StatusDoing, StatusDone},
+	Done:     []string{StatusDone},
+}
+
+// Validate checks that the workflow is consistent.
+func (wf Workflow) Validate() error {
+	if len(wf.Statuses) < 2 {
+		return errors.New("a workflow needs at least two statuses")
+	}
+	for i, s := range wf.Statuses {
+		if s == "" || len(s) > 30 {
+			return errors.New("statuses must be 1 to 30 characters long")
+		}
+		if slices.Contains(wf.Statuses[:i], s) {
+			return fmt.Errorf("status %q is listed twice", s)
+		}
+	}
+	if len(wf.Done) == 0 {
+		return errors.New("a workflow needs at least one done status")
+	}
+	for _, s := range wf.Done {
+		if !wf.Has(s) {
+			return fmt.Errorf("done status %q is not one of the statuses", s)
+		}
+	}
+	if wf.IsDone(wf.Initial()) {
+		return errors.New("the first status cannot be a done status")
+	}
+	for from, targets := range wf.Transitions {
+		if !wf.Has(from) {
+			return fmt.Errorf("transition from unknown status %q", from)
+		}
+		for _, to := range targets {
+			if !wf.Has(to) {
+				return fmt.Errorf("transition to unknown status %q", to)
+			}
+		}
+	}
+	for status, limit := range wf.Limits {
+		if !wf.Has(status) {
+			return fmt.Errorf("limit of unknown status %q", status)
+		}
+		if limit < 1 {
+			return fmt.Errorf("limit of %q must be positive", status)
+		}
+	}
+	return nil
+}
+
+// Has reports whether status is part of the workflow.
+func (wf Workflow) Has(status string) bool {
+	return slices.Contains(wf.Statuses, status)
+}
+
+// Initial returns the status new and reopened tasks start in.
+func (wf Workflow) Initial() string {
+	return wf.Statuses[0]
+}
+
+// DoneStatus returns the status tasks completed without naming a status
+// move to.
+func (wf Workflow) DoneStatus() string {
+	return wf.Done[0]
+}
+
+// IsDone reports whether status completes a task.
+func (wf Workflow) IsDone(status string) bool {
+	return slices.Contains(wf.Done, status)
+}
+
+// Allows reports whether a task may move from one status to another.
+func (wf Workflow) Allows(from, to string) bool {
+	if from == to || wf.Transitions == nil {
+		return true
+	}
+	return slices.Contains(wf.Transitions[from], to)
+}
+
+// WorkflowFor returns the workflow of tasks in the given project, or of
+// tasks without a project when projectID is nil.
+func WorkflowFor(db *gorm.DB, projectID *uint) Workflow {
+	if projectID == nil {
+		return DefaultWorkflow
+	}
+	var project Project
+	if err := db.Select("id", "workflow").First(&project, *projectID).Error; err != nil || project.Workflow == nil {
+		return DefaultWorkflow
+	}
+	return *project.Workflow
+}
+
+// statusOf returns the status of a task, deriving it from Completed for
+// tasks stored before statuses existed.
+func statusOf(task Task, wf Workflow) string {
+	switch {
+	case task.Status != "":
+		return task.Status
+	case task.Completed:
+		return wf.DoneStatus()
+	default:
+		return wf.Initial()
+	}
+}
+
+// resolveStatus decides the status of an updated task and sets Status,
+// Completed and CompletedAt accordingly. A changed status must be allowed by
+// the workflow. Clients that only know Completed keep working: when the
+// status is unchanged but Completed is toggled, the task moves to the done
+// status or back to the initial one. A task moved to another project keeps
+// its status if the new workflow has it, and otherwise starts over.
+func resolveStatus(existing Task, updated *Task, wf Workflow) error {
+	current := statusOf(existing, wf)
+	movedProject := !sameValue(existing.ProjectID, updated.ProjectID)
+
+	target := current
+	switch {
+	case updated.Status != "" && updated.Status != current:
+		target = updated.Status
+		if !wf.Has(target) {
+			return fmt.Errorf("%w: %s", ErrStatusUnknown, target)
+		}
+	case updated.Completed != existing.Completed:
+		target = wf.Initial()
+		if updated.Completed {
+			target = wf.DoneStatus()
+		}
+	}
+
+	if movedProject {
+		if !wf.Has(target) {
+			target = wf.Initial()
+			if updated.Completed {
+				target = wf.DoneStatus()
+			}
+		}
+	} else if !wf.Allows(current, target) {
+		return fmt.Errorf("%w: %s to %s", ErrStatusTransition, current, target)
+	}
+
+	updated.Status = target
+	updated.Completed = wf.IsDone(target)
+	updated.CompletedAt = nil
+	if updated.Completed {
+		now := time.Now()
+		updated.CompletedAt = &now
+		if existing.Completed && existing.CompletedAt != nil {
+			updated.CompletedAt = existing.CompletedAt
+		}
+	}
+	return nil
+}
+
+// setCompletion completes or reopens the tasks with the given IDs that are
+// not in that state yet, moving each to the done or initial status of its
+// project's workflow. Every task must be able to make that change on its
+// own: its workflow must allow it, the column it moves to must have room
+// under its work-in-progress limit, and a task being completed must not
+// wait for open blockers outside ids unless force is set. Completed
+// recurring tasks get their next occurrence.
+func setCompletion(tx *gorm.DB, ids []uint, completed, force bool) error {
+	var tasks []Task
+	if err := tx.Preload("Tags", orderTags).
+		Where("id IN ? AND completed = ?", ids, !completed).Order("id").Find(&tasks).Error; err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	workflows := map[uint]Workflow{}
+	moves := map[boardColumn][]uint{}
+	for _, t := range tasks {
+		key := uint(0)
+		if t.ProjectID != nil {
+			key = *t.ProjectID
+		}
+		wf, ok := workflows[key]
+		if !ok {
+			wf = WorkflowFor(tx, t.ProjectID)
+			workflows[key] = wf
+		}
+
+		current, target := statusOf(t, wf), wf.Initial()
+		if completed {
+			target = wf.DoneStatus()
+		}
+		if !wf.Allows(current, target) {
+			return fmt.Errorf("%w: task %d cannot follow from %s to %s", ErrStatusTransition, t.ID, current, target)
+		}
+		col := boardColumn{key, target}
+		moves[col] = append(moves[col], t.ID)
+	}
+	if err := checkColumnLimits(tx, workflows, moves); err != nil {
+		return err
+	}
+
+	if completed && !force {
+		taskIDs := make([]uint, len(tasks))
+		for i, t := range tasks {
+			taskIDs[i] = t.ID
+		}
+		if blocked := blockedIDs(tx, taskIDs, ids); len(blocked) > 0 {
+			return fmt.Errorf("%w: task %d", ErrTaskBlocked, blocked[0])
+		}
+	}
+
+	now := time.Now()
+	for col, group := range moves {
+		values := map[string]interface{}{"completed": completed, "status": col.status, "updated_at": now}
+		if completed {
+			values["completed_at"] = now
+		} else {
+			values["completed_at"] = nil
+		}
+		if err := tx.Model(&Task{}).Where("id IN ?", group).Updates(values).Error; err != nil {
+			return err
+		}
+	}
+
+	if completed {
+		for i := range tasks {
+			if err := createNextOccurrence(tx, &tasks[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetProjectWorkflow replaces the workflow of one of the user's projects, or
+// restores the default one when wf is nil. Tasks in a status that becomes
+// or stops being done are completed or reopened; their subtasks are left
+// as they are. It returns ErrStatusInUse if tasks of the project have a
+// status the new workflow lacks.
+func SetProjectWorkflow(id, userID uint, wf *Workflow) (Project, error) {
+	project, ok := GetProject(id, userID)
+	if !ok {
+		return Project{}, gorm.ErrRecordNotFound
+	}
+	effective := DefaultWorkflow
+	if wf != nil {
+		effective = *wf
+	}
+
+	var used []string
+	DB.Model(&Task{}).Where("project_id = ? AND status <> ''", id).Distinct().Pluck("status", &used)
+	for _, s := range used {
+		if !effective.Has(s) {
+			return Project{}, fmt.Errorf("%w: %s", ErrStatusInUse, s)
+		}
+	}
+
+	project.Workflow = wf
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&project).Select("workflow").Updates(&project).Error; err != nil {
+			return err
+		}
+		// Tasks follow a change of the done statuses
+		return syncCompletion(tx, id, effective)
+	})
+	if err != nil {
+		return Project{}, err
+	}
+	project, _ = GetProject(id, userID)
+	return project, nil
+}
+
+// syncCompletion completes or reopens the tasks of a project whose status
+// became or stopped being a done status of wf.
+func syncCompletion(tx *gorm.DB, projectID uint, wf Workflow) error {
+	now := time.Now()
+	if err := tx.Model(&Task{}).
+		Where("project_id = ? AND completed = ? AND status IN ?", projectID, false, wf.Done).
+		Updates(map[string]interface{}{"completed": true, "completed_at": now, "updated_at": now}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Task{}).
+		Where("project_id = ? AND completed = ? AND status NOT IN ?", projectID, true, wf.Done).
+		Updates(map[string]interface{}{"completed": false, "completed_at": nil, "updated_at": now}).Error
+}
+
+// backfillTaskStatuses gives tasks stored before statuses existed the status
+// matching their Completed flag in the default workflow.
+func backfillTaskStatuses(db *gorm.DB) error {
+	return db.Exec(`UPDATE tasks SET status = CASE WHEN completed THEN ? ELSE ? END,
+		completed_at = CASE WHEN completed THEN updated_at END
+		WHERE status IS NULL OR status = ''`, StatusDone, StatusTodo).Error
+}
@@ -0,0 +1,41 @@
+package oidc
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// loadFromEnv registers the providers listed in OIDC_PROVIDERS. For a
+// provider named "company" it reads OIDC_COMPANY_ISSUER,
+// OIDC_COMPANY_CLIENT_ID, OIDC_COMPANY_CLIENT_SECRET, OIDC_COMPANY_REDIRECT_URL
+// and optionally OIDC_COMPANY_SCOPES (space separated).
+func loadFromEnv() {
+	_ = godotenv.Load()
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		p := &Provider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if p.RedirectURL == "" {
+			p.RedirectURL = "http://localhost:8080/auth/oidc/" + name + "/callback"
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Printf("OIDC provider %s needs %sISSUER and %sCLIENT_ID, skipping", name, prefix, prefix)
+			continue
+		}
+		providers[name] = p
+	}
+}
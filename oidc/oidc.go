@@ -0,0 +1,300 @@
+// Package oidc signs users in with external OpenID Connect identity
+// providers. It implements the relying-party side of the authorization code
+// flow with PKCE: provider discovery, the authorization redirect, the code
+// exchange and ID token validation. What to do with the verified identity is
+// left to the caller.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+)
+
+// ErrInvalidIDToken is returned for ID tokens that fail validation.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Metadata is the part of a provider's discovery document the flow needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken holds the validated claims of an ID token this API uses.
+type IDToken struct {
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	Name            string `json:"name"`
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// Provider is one configured identity provider. Metadata and signing keys
+// are discovered from Issuer on first use and cached.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// HTTPClient is used for discovery, key and token requests.
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	metadata  *Metadata
+	keys      tokens.JWKS
+	keysFetch time.Time
+}
+
+// keyRefreshInterval limits how often an unknown kid triggers a JWKS refetch.
+const keyRefreshInterval = time.Minute
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// getJSON fetches url and decodes its JSON body into v.
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Discover returns the provider metadata from its discovery document.
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var meta Metadata
+	wellKnown := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.Name, err)
+	}
+	// The issuer must match exactly, or ID tokens could be accepted from another provider
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery for %s: issuer %q does not match %q", p.Name, meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery for %s: incomplete metadata", p.Name)
+	}
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// NewPKCE returns a random code verifier and its S256 code challenge.
+func NewPKCE() (verifier, challenge string) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	return verifier, PKCEChallenge(verifier)
+}
+
+// PKCEChallenge returns the S256 code challenge of a code verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider URL the user is redirected to for signing in.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// tokenResponse is the token endpoint response.
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code and returns the validated ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDToken, error) {
+	meta, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	res, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body tokenResponse
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("token endpoint of %s: %s", p.Name, res.Status)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("token endpoint of %s: %s %s", p.Name, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint of %s: no id_token in response", p.Name)
+	}
+
+	return p.VerifyIDToken(ctx, body.IDToken, nonce)
+}
+
+// VerifyIDToken validates the signature, issuer, audience, expiry and nonce
+// of an ID token issued by the provider.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	meta, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDToken{}
+	_, err = jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.verificationKey(ctx, kid, t.Method.Alg())
+		},
+		jwt.WithValidMethods([]string{tokens.AlgRS256, tokens.AlgEdDSA}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	// With several audiences the token must have been issued to us
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, fmt.Errorf("%w: azp %q is not this client", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+	return claims, nil
+}
+
+// verificationKey finds the provider key with the given kid, refetching the
+// JWKS when the kid is unknown, as happens after the provider rotated keys.
+func (p *Provider) verificationKey(ctx context.Context, kid, alg string) (interface{}, error) {
+	meta, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		for _, k := range p.keys.Keys {
+			if (kid == "" || k.KeyID == kid) && (k.Algorithm == "" || k.Algorithm == alg) && k.Use != "enc" {
+				return k.PublicKey()
+			}
+		}
+		if attempt > 0 || time.Since(p.keysFetch) < keyRefreshInterval {
+			break
+		}
+		var set tokens.JWKS
+		if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+			return nil, err
+		}
+		p.keys, p.keysFetch = set, time.Now()
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]*Provider{}
+	envOnce     sync.Once
+)
+
+// Register makes a provider available to Lookup under its name.
+func Register(p *Provider) {
+	envOnce.Do(loadFromEnv)
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name] = p
+}
+
+// Lookup returns the provider registered under name.
+func Lookup(name string) (*Provider, bool) {
+	envOnce.Do(loadFromEnv)
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
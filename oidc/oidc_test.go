@@ -0,0 +1,109 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/youssef-abbih/go-todo-list/oidc"
+	"github.com/youssef-abbih/go-todo-list/oidc/oidctest"
+)
+
+// authorize follows the provider's authorization redirect and returns the
+// code and state it sends back.
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	res.Body.Close()
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if res.StatusCode != http.StatusFound || err != nil {
+		t.Fatalf("authorize: expected a redirect, got %d", res.StatusCode)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	provider := idp.Provider("mock", "http://localhost/callback")
+	ctx := context.Background()
+
+	verifier, challenge := oidc.NewPKCE()
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned error: %v", err)
+	}
+
+	code, state := authorize(t, authURL)
+	if state != "state-1" {
+		t.Errorf("expected state to round-trip, got %q", state)
+	}
+
+	if _, err := provider.Exchange(ctx, code, "wrong-verifier", "nonce-1"); err == nil {
+		t.Errorf("expected a wrong PKCE verifier to be rejected")
+	}
+
+	code, _ = authorize(t, authURL)
+	idToken, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange returned error: %v", err)
+	}
+	if idToken.Subject != "mock-user" || idToken.Email != "sso@example.com" || !idToken.EmailVerified {
+		t.Errorf("unexpected ID token claims %+v", idToken)
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	provider := idp.Provider("mock", "http://localhost/callback")
+	ctx := context.Background()
+	now := time.Now()
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": idp.URL, "sub": "u1", "aud": idp.ClientID, "nonce": "n",
+			"iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}
+	}
+	if _, err := provider.VerifyIDToken(ctx, idp.SignIDToken(valid()), "n"); err != nil {
+		t.Fatalf("expected a valid token to be accepted, got %v", err)
+	}
+
+	for name, mutate := range map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "another-client" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"foreign azp":    func(c jwt.MapClaims) { c["aud"] = []string{idp.ClientID, "other"}; c["azp"] = "other" },
+	} {
+		claims := valid()
+		mutate(claims)
+		if _, err := provider.VerifyIDToken(ctx, idp.SignIDToken(claims), "n"); err == nil {
+			t.Errorf("%s: expected token to be rejected", name)
+		}
+	}
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("secret"))
+	if _, err := provider.VerifyIDToken(ctx, unsigned, "n"); err == nil {
+		t.Errorf("expected an HMAC-signed token to be rejected")
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	provider := idp.Provider("mock", "http://localhost/callback")
+	provider.Issuer = idp.URL + "/"
+
+	if _, err := provider.Discover(context.Background()); err == nil {
+		t.Errorf("expected discovery to fail when the issuer does not match")
+	}
+}
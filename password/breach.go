@@ -0,0 +1,133 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prefixLength is the number of hex characters of a SHA-1 hash that select a
+// range, as in the Have I Been Pwned k-anonymity API.
+const prefixLength = 5
+
+// BreachList is an offline list of SHA-1 hashes of breached passwords,
+// grouped into ranges by hash prefix. A list is either loaded into memory from
+// a single file of full hashes, or read range by range from a directory of
+// files named after their prefix (00000.txt ... FFFFF.txt) holding hash
+// suffixes, the layout of the Pwned Passwords downloader. Lines may carry a
+// ":count" suffix; entries with a count of 0 are padding and are ignored.
+type BreachList struct {
+	dir    string
+	ranges map[string]map[string]struct{}
+}
+
+// LoadBreachList opens a breached hash file or range directory.
+func LoadBreachList(path string) (*BreachList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachList{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachList{ranges: map[string]map[string]struct{}{}}
+	err = scanHashes(f, func(hash string) error {
+		if len(hash) != sha1.Size*2 {
+			return fmt.Errorf("%s: invalid SHA-1 hash %q", path, hash)
+		}
+		prefix := hash[:prefixLength]
+		if list.ranges[prefix] == nil {
+			list.ranges[prefix] = map[string]struct{}{}
+		}
+		list.ranges[prefix][hash[prefixLength:]] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Range returns the hash suffixes of the breached passwords whose SHA-1 hash
+// starts with prefix, in upper case.
+func (l *BreachList) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != prefixLength {
+		return nil, errors.New("hash prefix must be 5 hex characters")
+	}
+
+	var suffixes []string
+	if l.dir == "" {
+		for suffix := range l.ranges[prefix] {
+			suffixes = append(suffixes, suffix)
+		}
+		return suffixes, nil
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	err = scanHashes(f, func(suffix string) error {
+		suffixes = append(suffixes, suffix)
+		return nil
+	})
+	return suffixes, err
+}
+
+// Contains reports whether password is on the list. Only the prefix of its
+// hash selects the range to compare against. Unreadable ranges count as not
+// breached, so that a damaged list does not block every password change.
+func (l *BreachList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := l.Range(hash[:prefixLength])
+	if err != nil {
+		return false
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[prefixLength:] {
+			return true
+		}
+	}
+	return false
+}
+
+// scanHashes calls fn with every upper-cased hash of r, skipping blank lines
+// and entries with a count of 0.
+func scanHashes(r io.Reader, fn func(hash string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, count, _ := strings.Cut(line, ":")
+		if strings.TrimSpace(count) == "0" {
+			continue
+		}
+		if err := fn(strings.ToUpper(strings.TrimSpace(hash))); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
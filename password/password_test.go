@@ -0,0 +1,104 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// SHA-1 of "password", split as in the Pwned Passwords range layout.
+const (
+	passwordPrefix = "5BAA6"
+	passwordSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+)
+
+func rules(err error) []string {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	var names []string
+	for _, v := range verr.Violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, MinEntropyBits: 35, DisallowEmail: true}
+
+	cases := []struct {
+		password string
+		want     []string
+	}{
+		{"correct horse battery", nil},
+		{"Tr0ub4dor&3", nil},
+		{"short1", []string{RuleMinLength, RuleEntropy}},
+		{"aaaaaaaaaaaa", []string{RuleEntropy}},
+		{"abcdefgh1234", []string{RuleEntropy}},
+		{"Leon-is-great-42", []string{RuleEmail}},
+	}
+	for _, c := range cases {
+		got := rules(policy.Check(c.password, "leon@gmail.com"))
+		if len(got) != len(c.want) {
+			t.Errorf("%q: expected %v, got %v", c.password, c.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%q: expected %v, got %v", c.password, c.want, got)
+			}
+		}
+	}
+}
+
+func TestBreachListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := passwordPrefix + passwordSuffix + ":9545824\n" +
+		"7C4A8D09CA3762AF61E59520943DC26494F8941B:0\n" // "123456", padding
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadBreachList(path)
+	if err != nil {
+		t.Fatalf("LoadBreachList returned error: %v", err)
+	}
+	if !list.Contains("password") {
+		t.Errorf("expected \"password\" to be breached")
+	}
+	if list.Contains("123456") {
+		t.Errorf("expected entries with a count of 0 to be ignored")
+	}
+	if list.Contains("correct horse battery") {
+		t.Errorf("expected an unlisted password not to be breached")
+	}
+
+	policy := Policy{MinLength: 8, Breaches: list}
+	if got := rules(policy.Check("password", "")); len(got) != 1 || got[0] != RuleBreached {
+		t.Errorf("expected the breached rule, got %v", got)
+	}
+}
+
+func TestBreachListDirectory(t *testing.T) {
+	dir := t.TempDir()
+	content := "0018A45C4D1DEF81644B54AB7F969B88D65:1\n" + passwordSuffix + ":9545824\n"
+	if err := os.WriteFile(filepath.Join(dir, passwordPrefix+".txt"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadBreachList(dir)
+	if err != nil {
+		t.Fatalf("LoadBreachList returned error: %v", err)
+	}
+	if !list.Contains("password") {
+		t.Errorf("expected \"password\" to be breached")
+	}
+	if list.Contains("correct horse battery") {
+		t.Errorf("expected a password with a missing range file not to be breached")
+	}
+	if _, err := list.Range("5BAA"); err == nil {
+		t.Errorf("expected a short prefix to be rejected")
+	}
+}
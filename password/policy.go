@@ -0,0 +1,186 @@
+// Package password checks new passwords against a configurable policy and
+// an offline list of breached password hashes.
+package password
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/youssef-abbih/go-todo-list/utils"
+)
+
+// Rules a password can fail, reported to clients in Violation.Rule.
+const (
+	RuleMinLength = "min_length"
+	RuleEntropy   = "entropy"
+	RuleEmail     = "email"
+	RuleBreached  = "breached"
+)
+
+// Violation describes one rule a password failed.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule a password failed.
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password rejected: " + strings.Join(messages, "; ")
+}
+
+// Policy holds the rules new passwords must follow. Breaches is optional.
+type Policy struct {
+	MinLength      int
+	MinEntropyBits float64
+	DisallowEmail  bool
+	Breaches       *BreachList
+}
+
+// PolicyFromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_MIN_ENTROPY and
+// PASSWORD_ALLOW_EMAIL. It does not load the breach list.
+func PolicyFromEnv() Policy {
+	return Policy{
+		MinLength:      utils.EnvInt("PASSWORD_MIN_LENGTH", 8),
+		MinEntropyBits: float64(utils.EnvInt("PASSWORD_MIN_ENTROPY", 35)),
+		DisallowEmail:  !utils.EnvBool("PASSWORD_ALLOW_EMAIL", false),
+	}
+}
+
+// Check returns a *ValidationError listing every rule password fails for
+// the account with the given email, or nil if it is acceptable.
+func (p Policy) Check(password, email string) error {
+	var violations []Violation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: "Password must be at least " + strconv.Itoa(p.MinLength) + " characters long",
+		})
+	}
+	if p.MinEntropyBits > 0 && Entropy(password) < p.MinEntropyBits {
+		violations = append(violations, Violation{
+			Rule:    RuleEntropy,
+			Message: "Password is too easy to guess, use more and more varied characters",
+		})
+	}
+	if p.DisallowEmail && containsEmail(password, email) {
+		violations = append(violations, Violation{
+			Rule:    RuleEmail,
+			Message: "Password must not contain your email address",
+		})
+	}
+	if p.Breaches != nil && p.Breaches.Contains(password) {
+		violations = append(violations, Violation{
+			Rule:    RuleBreached,
+			Message: "Password appears in a known data breach",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// Entropy estimates the bits of entropy of a password: every character adds
+// log2 of the size of the character classes used, except characters that
+// repeat the previous one or continue a sequence (abc, 321), which add one bit.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+
+	bits := 0.0
+	prev := rune(-1)
+	for _, r := range password {
+		if d := r - prev; prev >= 0 && (d == 0 || d == 1 || d == -1) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+	return bits
+}
+
+// containsEmail reports whether password contains the email address or its
+// local part, ignoring case. Local parts shorter than three characters are
+// too common to reject.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultPolicy Policy
+)
+
+// Default returns the process-wide Policy, configured from the environment on
+// first use. PASSWORD_BREACH_LIST names the breached hash list to load.
+func Default() Policy {
+	defaultOnce.Do(func() {
+		defaultPolicy = PolicyFromEnv()
+		if path := utils.Env("PASSWORD_BREACH_LIST", ""); path != "" {
+			list, err := LoadBreachList(path)
+			if err != nil {
+				log.Fatalf("Failed to load breached password list: %v", err)
+			}
+			defaultPolicy.Breaches = list
+		}
+	})
+	return defaultPolicy
+}
+
+// SetDefault replaces the process-wide Policy, e.g. in tests.
+func SetDefault(p Policy) {
+	defaultOnce.Do(func() {})
+	defaultPolicy = p
+}
@@ -0,0 +1,262 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+)
+
+// newAdminServer starts a test server where leon@gmail.com (user 1) is an
+// administrator and returns a session token for that user.
+func newAdminServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	srv := newTestServer(t)
+	if _, ok := models.SetUserRole(1, models.RoleAdmin); !ok {
+		t.Fatalf("failed to make user 1 an admin")
+	}
+	return srv, login(t, srv, "leon@gmail.com", "leon123")
+}
+
+func TestAdminRequiresPermission(t *testing.T) {
+	srv, admin := newAdminServer(t)
+	user := login(t, srv, "youssef@hotmail.com", "youssef123")
+
+	res := doJSON(t, http.MethodGet, srv.URL+"/admin/users", "", nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized without a token, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users", user, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden for a regular user, got %d", res.StatusCode)
+	}
+
+	// A personal access token of an admin does not carry role permissions
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/me/tokens", admin,
+		map[string]interface{}{"name": "ci", "scopes": []string{"user:read"}})
+	var pat struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(res.Body).Decode(&pat)
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users", pat.Token, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden for a personal access token, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users", admin, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK for an admin, got %d", res.StatusCode)
+	}
+	var users []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&users)
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+	if _, leaked := users[0]["password"]; leaked {
+		t.Errorf("password hash must not be returned")
+	}
+	if users[0]["role"] != models.RoleAdmin || users[1]["role"] != models.RoleUser {
+		t.Errorf("unexpected roles %v and %v", users[0]["role"], users[1]["role"])
+	}
+}
+
+func TestAdminInspectTasks(t *testing.T) {
+	srv, admin := newAdminServer(t)
+
+	res := doJSON(t, http.MethodGet, srv.URL+"/admin/users/2/tasks", admin, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+	var tasks []models.Task
+	json.NewDecoder(res.Body).Decode(&tasks)
+	if len(tasks) != 1 || tasks[0].Title != "Build API" {
+		t.Errorf("expected the task of user 2, got %+v", tasks)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users/99/tasks", admin, nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for an unknown user, got %d", res.StatusCode)
+	}
+}
+
+func TestAdminDisableAndRestoreUser(t *testing.T) {
+	srv, admin := newAdminServer(t)
+	session := login(t, srv, "youssef@hotmail.com", "youssef123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/admin/users/1/disable", admin, nil)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request when disabling yourself, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/admin/users/2/disable", admin, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", session, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected sessions of a disabled user to be revoked, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login", "",
+		map[string]string{"email": "youssef@hotmail.com", "password": "youssef123"})
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden when a disabled user logs in, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users?status=disabled", admin, nil)
+	var disabled []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&disabled)
+	if len(disabled) != 1 || disabled[0]["email"] != "youssef@hotmail.com" {
+		t.Errorf("expected only the disabled user, got %v", disabled)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/admin/users/2/restore", admin, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on restore, got %d", res.StatusCode)
+	}
+	login(t, srv, "youssef@hotmail.com", "youssef123")
+}
+
+func TestAdminDeleteAndRestoreUser(t *testing.T) {
+	srv, admin := newAdminServer(t)
+
+	res := doJSON(t, http.MethodDelete, srv.URL+"/admin/users/2", admin, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login", "",
+		map[string]string{"email": "youssef@hotmail.com", "password": "youssef123"})
+	if res.StatusCode == http.StatusOK {
+		t.Errorf("expected a deleted user not to log in")
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users?status=deleted", admin, nil)
+	var deleted []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&deleted)
+	if len(deleted) != 1 || deleted[0]["deleted_at"] == nil {
+		t.Errorf("expected the deleted user, got %v", deleted)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/admin/users/2/restore", admin, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on restore, got %d", res.StatusCode)
+	}
+
+	session := login(t, srv, "youssef@hotmail.com", "youssef123")
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", session, nil)
+	var tasks []models.Task
+	json.NewDecoder(res.Body).Decode(&tasks)
+	if len(tasks) != 1 {
+		t.Errorf("expected the tasks deleted with the account to be restored, got %d", len(tasks))
+	}
+}
+
+func TestAdminCustomRoles(t *testing.T) {
+	srv, admin := newAdminServer(t)
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/admin/roles", admin,
+		map[string]interface{}{"name": "support", "permissions": []string{"users:fly"}})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an unknown permission, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/admin/roles", admin, map[string]interface{}{
+		"name":        "support",
+		"description": "Helps users",
+		"permissions": []string{models.PermissionUsersRead, models.PermissionTasksReadAll},
+	})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPut, srv.URL+"/admin/users/2/role", admin, map[string]string{"role": "support"})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK when assigning the role, got %d", res.StatusCode)
+	}
+
+	support := login(t, srv, "youssef@hotmail.com", "youssef123")
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users/1/tasks", support, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected support to inspect tasks, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPost, srv.URL+"/admin/users/1/disable", support, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected support not to disable users, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodDelete, srv.URL+"/admin/roles/support", admin, nil)
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for an assigned role, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPut, srv.URL+"/admin/roles/admin", admin,
+		map[string]interface{}{"permissions": []string{}})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected built-in roles to be read-only, got %d", res.StatusCode)
+	}
+
+	// Permissions follow the role, not the token
+	res = doJSON(t, http.MethodPut, srv.URL+"/admin/roles/support", admin,
+		map[string]interface{}{"permissions": []string{models.PermissionUsersRead}})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK when updating the role, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/admin/users/1/tasks", support, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected the removed permission to apply immediately, got %d", res.StatusCode)
+	}
+}
+
+func TestAdminCannotGrantMorePermissions(t *testing.T) {
+	srv, admin := newAdminServer(t)
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/admin/roles", admin, map[string]interface{}{
+		"name":        "helpdesk",
+		"permissions": []string{models.PermissionUsersRead, models.PermissionUsersManage},
+	})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPut, srv.URL+"/admin/users/2/role", admin, map[string]string{"role": "helpdesk"}); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK when assigning the role, got %d", res.StatusCode)
+	}
+	accomplice, err := models.AddUser(models.User{Email: "mallory@example.com", Password: "mallory123"})
+	if err != nil {
+		t.Fatalf("failed to add a user: %v", err)
+	}
+	accompliceURL := srv.URL + "/admin/users/" + strconv.Itoa(int(accomplice.ID)) + "/role"
+
+	helpdesk := login(t, srv, "youssef@hotmail.com", "youssef123")
+	if res := doJSON(t, http.MethodPut, accompliceURL, helpdesk, map[string]string{"role": models.RoleAdmin}); res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden when granting admin, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPut, srv.URL+"/admin/users/1/role", helpdesk, map[string]string{"role": models.RoleUser}); res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden when demoting an admin, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPut, accompliceURL, helpdesk, map[string]string{"role": "helpdesk"}); res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK when assigning the caller's own role, got %d", res.StatusCode)
+	}
+}
+
+func TestAdminUnlockUser(t *testing.T) {
+	srv, admin := newAdminServer(t)
+	t.Setenv("LOGIN_MAX_FAILURES", "1")
+
+	doJSON(t, http.MethodPost, srv.URL+"/users/login", "",
+		map[string]string{"email": "youssef@hotmail.com", "password": "wrong"})
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/login", "",
+		map[string]string{"email": "youssef@hotmail.com", "password": "youssef123"})
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected the account to be locked, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/admin/users/2/unlock", admin, nil)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", res.StatusCode)
+	}
+	login(t, srv, "youssef@hotmail.com", "youssef123")
+}
@@ -0,0 +1,331 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/youssef-abbih/go-todo-list/oidc"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+// oauthClient is the registration response of POST /oauth/clients.
+type oauthClient struct {
+	ID           uint   `json:"id"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// oauthTokens is the response body of the token endpoint.
+type oauthTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	Error        string `json:"error"`
+}
+
+// registerClient registers an OAuth client for the user of session.
+func registerClient(t *testing.T, srv *httptest.Server, session string, body map[string]interface{}) oauthClient {
+	t.Helper()
+	res := doJSON(t, http.MethodPost, srv.URL+"/oauth/clients", session, body)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("register client: expected 201 Created, got %d", res.StatusCode)
+	}
+	var client oauthClient
+	json.NewDecoder(res.Body).Decode(&client)
+	return client
+}
+
+// postForm sends a form to an OAuth endpoint, authenticating as client.
+func postForm(t *testing.T, endpoint string, client oauthClient, form url.Values) *http.Response {
+	t.Helper()
+	if client.ClientSecret == "" {
+		// Public clients only identify themselves
+		form.Set("client_id", client.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if client.ClientSecret != "" {
+		req.SetBasicAuth(client.ClientID, client.ClientSecret)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", endpoint, err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+// requestTokens calls the token endpoint and decodes its response.
+func requestTokens(t *testing.T, srv *httptest.Server, client oauthClient, form url.Values) (int, oauthTokens) {
+	t.Helper()
+	res := postForm(t, srv.URL+"/oauth/token", client, form)
+	var body oauthTokens
+	json.NewDecoder(res.Body).Decode(&body)
+	return res.StatusCode, body
+}
+
+// authorizeCode approves an authorization request as the user of session and
+// returns the code and the PKCE verifier.
+func authorizeCode(t *testing.T, srv *httptest.Server, session string, client oauthClient, scope string) (string, string) {
+	t.Helper()
+	verifier, challenge := oidc.NewPKCE()
+	res := doJSON(t, http.MethodPost, srv.URL+"/oauth/authorize", session, map[string]interface{}{
+		"response_type":         "code",
+		"client_id":             client.ClientID,
+		"redirect_uri":          testRedirectURI,
+		"scope":                 scope,
+		"state":                 "xyz",
+		"code_challenge":        challenge,
+		"code_challenge_method": "S256",
+		"approve":               true,
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("authorize: expected 200 OK, got %d", res.StatusCode)
+	}
+	var body struct {
+		RedirectURI string `json:"redirect_uri"`
+	}
+	json.NewDecoder(res.Body).Decode(&body)
+	redirect, err := url.Parse(body.RedirectURI)
+	if err != nil || redirect.Query().Get("code") == "" || redirect.Query().Get("state") != "xyz" {
+		t.Fatalf("authorize: expected a code and the state in %q", body.RedirectURI)
+	}
+	return redirect.Query().Get("code"), verifier
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	srv := newTestServer(t)
+	session := login(t, srv, "leon@gmail.com", "leon123")
+	client := registerClient(t, srv, session, map[string]interface{}{
+		"name":          "Public app",
+		"redirect_uris": []string{testRedirectURI},
+		"scopes":        []string{"tasks:read", "tasks:write"},
+	})
+
+	// The consent screen asks before the first approval
+	res := doJSON(t, http.MethodGet, srv.URL+"/oauth/authorize?response_type=code&client_id="+client.ClientID+
+		"&redirect_uri="+url.QueryEscape(testRedirectURI)+"&scope=tasks:read&code_challenge=abc&code_challenge_method=S256", session, nil)
+	var review map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&review)
+	if res.StatusCode != http.StatusOK || review["consent_required"] != true {
+		t.Fatalf("expected the consent to be required, got %d %v", res.StatusCode, review)
+	}
+
+	code, verifier := authorizeCode(t, srv, session, client, "tasks:read")
+
+	status, _ := requestTokens(t, srv, client, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code},
+		"redirect_uri": {testRedirectURI}, "code_verifier": {"wrong"},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for a wrong PKCE verifier, got %d", status)
+	}
+
+	code, verifier = authorizeCode(t, srv, session, client, "tasks:read")
+	exchange := url.Values{
+		"grant_type": {"authorization_code"}, "code": {code},
+		"redirect_uri": {testRedirectURI}, "code_verifier": {verifier},
+	}
+	status, issued := requestTokens(t, srv, client, exchange)
+	if status != http.StatusOK || issued.AccessToken == "" || issued.RefreshToken == "" || issued.Scope != "tasks:read" {
+		t.Fatalf("expected tokens for tasks:read, got %d %+v", status, issued)
+	}
+
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", issued.AccessToken, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("expected tasks:read to list tasks, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPost, srv.URL+"/tasks", issued.AccessToken, map[string]interface{}{"title": "From app"})
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden without tasks:write, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/oauth/clients", issued.AccessToken, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden for client tokens on session endpoints, got %d", res.StatusCode)
+	}
+
+	// Refreshing keeps the granted scopes
+	status, refreshed := requestTokens(t, srv, client, url.Values{
+		"grant_type": {"refresh_token"}, "refresh_token": {issued.RefreshToken},
+	})
+	if status != http.StatusOK || refreshed.Scope != "tasks:read" {
+		t.Fatalf("expected a refresh with tasks:read, got %d %+v", status, refreshed)
+	}
+
+	// Replaying the code revokes the tokens it was exchanged for
+	if status, _ := requestTokens(t, srv, client, exchange); status != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for a reused code, got %d", status)
+	}
+	status, _ = requestTokens(t, srv, client, url.Values{
+		"grant_type": {"refresh_token"}, "refresh_token": {refreshed.RefreshToken},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("expected the refresh token to be revoked after code reuse, got %d", status)
+	}
+	for _, token := range []string{issued.AccessToken, refreshed.AccessToken} {
+		if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", token, nil); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected 401 Unauthorized for an access token after code reuse, got %d", res.StatusCode)
+		}
+	}
+
+	// Login refresh tokens are not interchangeable with client refresh tokens
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": refreshed.RefreshToken})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for a client refresh token, got %d", res.StatusCode)
+	}
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	srv := newTestServer(t)
+	session := login(t, srv, "leon@gmail.com", "leon123")
+	client := registerClient(t, srv, session, map[string]interface{}{
+		"name":         "Internal tool",
+		"scopes":       []string{"tasks:read"},
+		"grant_types":  []string{"client_credentials"},
+		"confidential": true,
+	})
+	if client.ClientSecret == "" {
+		t.Fatalf("expected a secret for a confidential client")
+	}
+
+	status, issued := requestTokens(t, srv, client, url.Values{"grant_type": {"client_credentials"}})
+	if status != http.StatusOK || issued.AccessToken == "" || issued.RefreshToken != "" {
+		t.Fatalf("expected an access token only, got %d %+v", status, issued)
+	}
+	// The token acts on behalf of the client's owner
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", issued.AccessToken, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("expected the owner's tasks, got %d", res.StatusCode)
+	}
+
+	status, _ = requestTokens(t, srv, client, url.Values{"grant_type": {"client_credentials"}, "scope": {"tasks:write"}})
+	if status != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an unregistered scope, got %d", status)
+	}
+
+	wrong := oauthClient{ClientID: client.ClientID, ClientSecret: "wrong"}
+	if status, _ := requestTokens(t, srv, wrong, url.Values{"grant_type": {"client_credentials"}}); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for a wrong secret, got %d", status)
+	}
+
+	for _, uri := range []string{
+		"javascript:alert(document.cookie)",
+		"data:text/html,<script>alert(1)</script>",
+		"myapp://callback",
+		"http://app.example.com/callback",
+		"https://app.example.com/callback#token",
+	} {
+		res := doJSON(t, http.MethodPost, srv.URL+"/oauth/clients", session, map[string]interface{}{
+			"name": "Bad app", "scopes": []string{"tasks:read"}, "redirect_uris": []string{uri},
+		})
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("redirect URI %q: expected 400 Bad Request, got %d", uri, res.StatusCode)
+		}
+	}
+	registerClient(t, srv, session, map[string]interface{}{
+		"name": "Native app", "scopes": []string{"tasks:read"}, "redirect_uris": []string{"http://127.0.0.1:8765/callback"},
+	})
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/oauth/clients", session, map[string]interface{}{
+		"name":        "Public tool",
+		"scopes":      []string{"tasks:read"},
+		"grant_types": []string{"client_credentials"},
+	})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for client_credentials on a public client, got %d", res.StatusCode)
+	}
+
+	// Deleting the client revokes the access tokens it already holds
+	res = doJSON(t, http.MethodDelete, srv.URL+"/oauth/clients/"+strconv.Itoa(int(client.ID)), session, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK when deleting the client, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", issued.AccessToken, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for a token of a deleted client, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", session, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("expected the owner's session to stay valid, got %d", res.StatusCode)
+	}
+}
+
+func TestOAuthIntrospectAndRevoke(t *testing.T) {
+	srv := newTestServer(t)
+	session := login(t, srv, "leon@gmail.com", "leon123")
+	client := registerClient(t, srv, session, map[string]interface{}{
+		"name":          "Confidential app",
+		"redirect_uris": []string{testRedirectURI},
+		"scopes":        []string{"tasks:read", "user:read"},
+		"confidential":  true,
+	})
+
+	code, verifier := authorizeCode(t, srv, session, client, "")
+	_, issued := requestTokens(t, srv, client, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code},
+		"redirect_uri": {testRedirectURI}, "code_verifier": {verifier},
+	})
+
+	introspect := func(token string) map[string]interface{} {
+		res := postForm(t, srv.URL+"/oauth/introspect", client, url.Values{"token": {token}})
+		var body map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&body)
+		return body
+	}
+
+	if body := introspect(issued.AccessToken); body["active"] != true || body["scope"] != "tasks:read user:read" {
+		t.Fatalf("expected an active access token with the default scopes, got %v", body)
+	}
+	if body := introspect(session); body["active"] != false {
+		t.Errorf("expected login tokens to be inactive for the client, got %v", body)
+	}
+
+	postForm(t, srv.URL+"/oauth/revoke", client, url.Values{"token": {issued.AccessToken}})
+	if body := introspect(issued.AccessToken); body["active"] != false {
+		t.Errorf("expected the revoked access token to be inactive, got %v", body)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", issued.AccessToken, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for a revoked token, got %d", res.StatusCode)
+	}
+
+	// Withdrawing the consent revokes the client's tokens
+	code, verifier = authorizeCode(t, srv, session, client, "")
+	_, second := requestTokens(t, srv, client, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code},
+		"redirect_uri": {testRedirectURI}, "code_verifier": {verifier},
+	})
+	res := doJSON(t, http.MethodGet, srv.URL+"/users/me/consents", session, nil)
+	var consents []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&consents)
+	if len(consents) != 1 {
+		t.Fatalf("expected one consent, got %v", consents)
+	}
+	id, _ := consents[0]["id"].(float64)
+	res = doJSON(t, http.MethodDelete, srv.URL+"/users/me/consents/"+strconv.Itoa(int(id)), session, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK when revoking the consent, got %d", res.StatusCode)
+	}
+	if body := introspect(issued.RefreshToken); body["active"] != false {
+		t.Errorf("expected the refresh token to be revoked with the consent, got %v", body)
+	}
+	if body := introspect(second.AccessToken); body["active"] != false {
+		t.Errorf("expected the access token to be revoked with the consent, got %v", body)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", second.AccessToken, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for an access token after the consent was withdrawn, got %d", res.StatusCode)
+	}
+
+	// Consenting again gives the client working tokens
+	code, verifier = authorizeCode(t, srv, session, client, "")
+	_, third := requestTokens(t, srv, client, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code},
+		"redirect_uri": {testRedirectURI}, "code_verifier": {verifier},
+	})
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks", third.AccessToken, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("expected a new consent to give working tokens, got %d", res.StatusCode)
+	}
+}
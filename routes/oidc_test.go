@@ -0,0 +1,214 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/oidc"
+	"github.com/youssef-abbih/go-todo-list/oidc/oidctest"
+)
+
+// newOIDCServer starts the API with a mock identity provider registered as "mock".
+func newOIDCServer(t *testing.T) (*httptest.Server, *oidctest.Server) {
+	t.Helper()
+	srv := newTestServer(t)
+	idp := oidctest.NewServer(t)
+	oidc.Register(idp.Provider("mock", srv.URL+"/auth/oidc/mock/callback"))
+	return srv, idp
+}
+
+// newBrowser returns a client that keeps cookies and follows redirects.
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookie jar: %v", err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// browse sends a request with the browser and an optional bearer token.
+func browse(t *testing.T, browser *http.Client, method, url, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := browser.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+// ssoLogin signs in through the mock provider and returns the API token.
+func ssoLogin(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	res := browse(t, newBrowser(t), http.MethodGet, srv.URL+"/auth/oidc/mock/login", "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("SSO login: expected 200 OK, got %d", res.StatusCode)
+	}
+	var pair tokenPair
+	json.NewDecoder(res.Body).Decode(&pair)
+	if pair.Token == "" || pair.RefreshToken == "" {
+		t.Fatalf("SSO login: expected an access and a refresh token")
+	}
+	return pair.Token
+}
+
+// currentUser returns the id and email of the token's user.
+func currentUser(t *testing.T, srv *httptest.Server, token string) (float64, string) {
+	t.Helper()
+	res := doJSON(t, http.MethodGet, srv.URL+"/users/me", token, nil)
+	var user map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&user)
+	id, _ := user["id"].(float64)
+	email, _ := user["email"].(string)
+	return id, email
+}
+
+func TestOIDCLoginCreatesAndLinksUser(t *testing.T) {
+	srv, _ := newOIDCServer(t)
+
+	id, email := currentUser(t, srv, ssoLogin(t, srv))
+	if email != "sso@example.com" {
+		t.Fatalf("expected a new user for the SSO identity, got %q", email)
+	}
+
+	// Signing in again finds the same user through the linked identity
+	if again, _ := currentUser(t, srv, ssoLogin(t, srv)); again != id {
+		t.Errorf("expected the same user %v, got %v", id, again)
+	}
+}
+
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	srv, idp := newOIDCServer(t)
+
+	idp.SetUser(oidctest.User{Subject: "unverified", Email: "leon@gmail.com", EmailVerified: false})
+	res := browse(t, newBrowser(t), http.MethodGet, srv.URL+"/auth/oidc/mock/login", "")
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for an unverified email of an existing user, got %d", res.StatusCode)
+	}
+
+	idp.SetUser(oidctest.User{Subject: "leon", Email: "leon@gmail.com", EmailVerified: true})
+	if id, _ := currentUser(t, srv, ssoLogin(t, srv)); id != 1 {
+		t.Errorf("expected the verified email to sign in user 1, got %v", id)
+	}
+
+	// An account that never verified the address may not be its owner's
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/register", "",
+		map[string]string{"email": "victim@example.com", "password": "attacker-Pass-91"})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+	idp.SetUser(oidctest.User{Subject: "victim", Email: "victim@example.com", EmailVerified: true})
+	res = browse(t, newBrowser(t), http.MethodGet, srv.URL+"/auth/oidc/mock/login", "")
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for an account with an unverified email, got %d", res.StatusCode)
+	}
+}
+
+func TestOIDCLoginRequiresTOTP(t *testing.T) {
+	srv, idp := newOIDCServer(t)
+	if !models.SetPendingTOTPSecret(1, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("SetPendingTOTPSecret failed")
+	}
+	if err := models.EnableTOTP(1, 0, nil); err != nil {
+		t.Fatalf("EnableTOTP returned error: %v", err)
+	}
+
+	idp.SetUser(oidctest.User{Subject: "leon", Email: "leon@gmail.com", EmailVerified: true})
+	res := browse(t, newBrowser(t), http.MethodGet, srv.URL+"/auth/oidc/mock/login", "")
+	var body struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"Token"`
+	}
+	json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode != http.StatusOK || !body.MFARequired || body.MFAToken == "" || body.Token != "" {
+		t.Errorf("expected an MFA challenge instead of tokens, got %d %+v", res.StatusCode, body)
+	}
+}
+
+func TestOIDCCallbackRequiresState(t *testing.T) {
+	srv, _ := newOIDCServer(t)
+
+	// A browser that did not start the sign-in has no state cookie
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res := browse(t, noRedirect, http.MethodGet, srv.URL+"/auth/oidc/mock/login", "")
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d", res.StatusCode)
+	}
+	res = browse(t, newBrowser(t), http.MethodGet, res.Header.Get("Location"), "")
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request without the state cookie, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/auth/oidc/unknown/login", "", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for an unknown provider, got %d", res.StatusCode)
+	}
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	srv, idp := newOIDCServer(t)
+	idp.SetUser(oidctest.User{Subject: "corp-42", Email: "leon@corp.example.com", EmailVerified: true})
+	session := login(t, srv, "leon@gmail.com", "leon123")
+
+	link := func(token string) *http.Response {
+		browser := newBrowser(t)
+		res := browse(t, browser, http.MethodPost, srv.URL+"/users/me/identities/mock", token)
+		var body struct {
+			AuthorizationURL string `json:"authorization_url"`
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		if body.AuthorizationURL == "" {
+			t.Fatalf("expected an authorization URL, got %d", res.StatusCode)
+		}
+		return browse(t, browser, http.MethodGet, body.AuthorizationURL, "")
+	}
+
+	if res := link(session); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK when linking, got %d", res.StatusCode)
+	}
+
+	res := doJSON(t, http.MethodGet, srv.URL+"/users/me/identities", session, nil)
+	var identities []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&identities)
+	if len(identities) != 1 || identities[0]["subject"] != "corp-42" {
+		t.Fatalf("expected the linked identity, got %v", identities)
+	}
+
+	// The corporate identity now signs in leon, despite the different email
+	if id, _ := currentUser(t, srv, ssoLogin(t, srv)); id != 1 {
+		t.Errorf("expected the linked identity to sign in user 1, got %v", id)
+	}
+
+	other := login(t, srv, "youssef@hotmail.com", "youssef123")
+	if res := link(other); res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict when linking someone else's identity, got %d", res.StatusCode)
+	}
+}
+
+func TestPasswordLoginDisabled(t *testing.T) {
+	srv, _ := newOIDCServer(t)
+	t.Setenv("PASSWORD_LOGIN", "false")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/login", "",
+		map[string]string{"email": "leon@gmail.com", "password": "leon123"})
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden for password login, got %d", res.StatusCode)
+	}
+	ssoLogin(t, srv)
+}
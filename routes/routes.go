@@ -0,0 +1,203 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/swaggo/http-swagger"
+	_ "github.com/youssef-abbih/go-todo-list/docs"
+	"github.com/youssef-abbih/go-todo-list/handlers"
+	"github.com/youssef-abbih/go-todo-list/middleware"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/tokens"
+)
+
+// NewRouter builds the chi router with every route and middleware of the API.
+func NewRouter() *chi.Mux {
+	r := chi.NewRouter()
+
+	// Global middleware
+	r.Use(middleware.SecureHeadersMiddleware) // Security headers
+	r.Use(middleware.LogRequestMiddleware)    // Request logging
+
+	// Public routes
+	r.Get("/", handlers.DefaultResponse)
+	r.Get("/health", handlers.HealthCheck)
+	r.Get("/swagger/*", httpSwagger.WrapHandler)
+	r.Get("/.well-known/jwks.json", handlers.JWKS)
+
+	// /auth/oidc routes: sign-in with external identity providers
+	r.Route("/auth/oidc/{provider}", func(r chi.Router) {
+		r.Get("/login", handlers.OIDCLogin)
+		r.Get("/callback", handlers.OIDCCallback)
+	})
+
+	// /oauth routes: the token endpoints authenticate clients, the rest needs a login session
+	r.Route("/oauth", func(r chi.Router) {
+		r.Post("/token", handlers.OAuthToken)
+		r.Post("/introspect", handlers.IntrospectToken)
+		r.Post("/revoke", handlers.RevokeOAuthToken)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware)
+			r.Use(middleware.RequireSession)
+			r.Get("/authorize", handlers.Authorize)
+			r.Post("/authorize", handlers.ApproveAuthorization)
+			r.Get("/clients", handlers.ListOAuthClients)
+			r.Post("/clients", handlers.CreateOAuthClient)
+			r.Delete("/clients/{id}", handlers.DeleteOAuthClient)
+		})
+	})
+
+	// /users routes: registration and login are public, /users/me/* is protected
+	r.Route("/users", func(r chi.Router) {
+		r.Post("/register", handlers.Register)
+		r.Post("/login", handlers.Login)
+		r.Post("/login/mfa", handlers.LoginMFA)
+		r.Post("/token/refresh", handlers.RefreshToken)
+		r.Post("/password/forgot", handlers.ForgotPassword)
+		r.Post("/password/reset", handlers.ResetPassword)
+		r.Get("/verify", handlers.VerifyEmail)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware)
+			r.Post("/logout", handlers.Logout)
+			r.Post("/logout/all", handlers.LogoutAll)
+			r.Post("/verify/resend", handlers.ResendVerification)
+
+			r.With(middleware.RequireScope(tokens.ScopeUserRead)).Get("/me", handlers.GetCurrentUser)
+			r.With(middleware.RequireScope(tokens.ScopeUserRead)).Get("/me/tokens", handlers.ListPersonalAccessTokens)
+			r.With(middleware.RequireScope(tokens.ScopeUserRead)).Get("/me/identities", handlers.ListIdentities)
+			r.With(middleware.RequireScope(tokens.ScopeUserRead)).Get("/me/consents", handlers.ListConsents)
+			r.With(middleware.RequireScope(tokens.ScopeUserRead)).Get("/me/sessions", handlers.ListSessions)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(tokens.ScopeUserWrite))
+				r.Patch("/me", handlers.PatchCurrentUser)
+				r.Delete("/me", handlers.DeleteCurrentUser)
+				r.Post("/me/password", handlers.ChangePassword)
+				r.Post("/me/tokens", handlers.CreatePersonalAccessToken)
+				r.Delete("/me/tokens/{id}", handlers.RevokePersonalAccessToken)
+				r.Post("/me/mfa/totp", handlers.EnrollTOTP)
+				r.Post("/me/mfa/totp/confirm", handlers.ConfirmTOTP)
+				r.Delete("/me/mfa/totp", handlers.DisableTOTP)
+				r.Post("/me/mfa/recovery-codes", handlers.RegenerateRecoveryCodes)
+				r.Post("/me/identities/{provider}", handlers.LinkIdentity)
+				r.Delete("/me/identities/{id}", handlers.UnlinkIdentity)
+				r.Delete("/me/consents/{id}", handlers.RevokeConsent)
+				r.Delete("/me/sessions/{id}", handlers.RevokeSession)
+			})
+		})
+	})
+
+	// Protected /tasks routes
+	r.Route("/tasks", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware) // Scoped only to /tasks/*
+		r.Use(middleware.RequireVerifiedEmail)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(tokens.ScopeTasksRead))
+			r.Get("/", handlers.GetTasks)
+			r.Get("/next", handlers.GetNextTasks)
+			r.Get("/trash", handlers.ListTrash)
+			r.Get("/{id}", handlers.GetTask)
+			r.Get("/{id}/children", handlers.GetTaskChildren)
+			r.Get("/{id}/tree", handlers.GetTaskTree)
+			r.Get("/{id}/occurrences", handlers.GetTaskOccurrences)
+			r.Get("/{id}/blockers", handlers.ListTaskBlockers)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(tokens.ScopeTasksWrite))
+			r.Post("/", handlers.PostTask)
+			r.Put("/{id}", handlers.PutTask)
+			r.Post("/{id}/move", handlers.MoveTask)
+			r.Post("/{id}/tags", handlers.AttachTaskTags)
+			r.Delete("/{id}/tags/{tagID}", handlers.DetachTaskTag)
+			r.Post("/{id}/blockers", handlers.AddTaskBlocker)
+			r.Delete("/{id}/blockers/{blockerID}", handlers.RemoveTaskBlocker)
+			r.Delete("/{id}", handlers.DeleteTask)
+			r.Post("/{id}/restore", handlers.RestoreTask)
+		})
+	})
+
+	// Protected /tags routes
+	r.Route("/tags", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+		r.Use(middleware.RequireVerifiedEmail)
+
+		r.With(middleware.RequireScope(tokens.ScopeTasksRead)).Get("/", handlers.ListTags)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(tokens.ScopeTasksWrite))
+			r.Post("/", handlers.CreateTag)
+			r.Put("/{id}", handlers.UpdateTag)
+			r.Delete("/{id}", handlers.DeleteTag)
+		})
+	})
+
+	// Protected /projects routes
+	r.Route("/projects", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+		r.Use(middleware.RequireVerifiedEmail)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(tokens.ScopeTasksRead))
+			r.Get("/", handlers.ListProjects)
+			r.Get("/{id}", handlers.GetProject)
+			r.Get("/{id}/tasks", handlers.ListProjectTasks)
+			r.Get("/{id}/workflow", handlers.GetProjectWorkflow)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(tokens.ScopeTasksWrite))
+			r.Post("/", handlers.CreateProject)
+			r.Put("/{id}", handlers.UpdateProject)
+			r.Delete("/{id}", handlers.DeleteProject)
+			r.Post("/{id}/archive", handlers.ArchiveProject)
+			r.Post("/{id}/unarchive", handlers.UnarchiveProject)
+			r.Post("/{id}/tasks", handlers.CreateProjectTask)
+			r.Put("/{id}/workflow", handlers.SetProjectWorkflow)
+		})
+	})
+
+	// Protected /boards routes, one board per project
+	r.Route("/boards", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+		r.Use(middleware.RequireVerifiedEmail)
+
+		r.With(middleware.RequireScope(tokens.ScopeTasksRead)).Get("/{project}", handlers.GetBoard)
+		r.With(middleware.RequireScope(tokens.ScopeTasksWrite)).Post("/{project}/move", handlers.MoveOnBoard)
+	})
+
+	// /admin routes: each one checks a permission of the caller's role
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Route("/users", func(r chi.Router) {
+			r.With(middleware.RequirePermission(models.PermissionUsersRead)).Get("/", handlers.ListUsers)
+			r.With(middleware.RequirePermission(models.PermissionUsersRead)).Get("/{id}", handlers.GetUser)
+			r.With(middleware.RequirePermission(models.PermissionTasksReadAll)).Get("/{id}/tasks", handlers.ListUserTasks)
+			r.With(middleware.RequirePermission(models.PermissionUsersDelete)).Delete("/{id}", handlers.DeleteUser)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionUsersManage))
+				r.Post("/{id}/disable", handlers.DisableUser)
+				r.Post("/{id}/restore", handlers.RestoreUser)
+				r.Post("/{id}/unlock", handlers.UnlockUser)
+				r.Put("/{id}/role", handlers.SetUserRole)
+			})
+		})
+
+		r.Route("/roles", func(r chi.Router) {
+			r.With(middleware.RequirePermission(models.PermissionUsersRead)).Get("/", handlers.ListRoles)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionRolesManage))
+				r.Post("/", handlers.CreateRole)
+				r.Put("/{name}", handlers.UpdateRole)
+				r.Delete("/{name}", handlers.DeleteRole)
+			})
+		})
+	})
+
+	return r
+}
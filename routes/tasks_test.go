@@ -0,0 +1,975 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/handlers"
+	"github.com/youssef-abbih/go-todo-list/models"
+)
+
+// createTask posts a task and returns it, failing the test otherwise.
+func createTask(t *testing.T, srv *httptest.Server, token string, task map[string]interface{}) models.Task {
+	t.Helper()
+	if task["description"] == nil {
+		task["description"] = "test task"
+	}
+	res := doJSON(t, http.MethodPost, srv.URL+"/tasks", token, task)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create task %v: expected 201 Created, got %d", task["title"], res.StatusCode)
+	}
+	var created models.Task
+	json.NewDecoder(res.Body).Decode(&created)
+	return created
+}
+
+// listTasks fetches GET /tasks with the given query and returns the titles.
+func listTasks(t *testing.T, srv *httptest.Server, token, query string) []string {
+	t.Helper()
+	res := doJSON(t, http.MethodGet, srv.URL+"/tasks?"+query, token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET /tasks?%s: expected 200 OK, got %d", query, res.StatusCode)
+	}
+	var tasks []models.Task
+	json.NewDecoder(res.Body).Decode(&tasks)
+	titles := make([]string, len(tasks))
+	for i, task := range tasks {
+		titles[i] = task.Title
+	}
+	return titles
+}
+
+func TestTaskScheduleValidation(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	due := time.Now().Add(24 * time.Hour).UTC()
+	cases := []map[string]interface{}{
+		{"title": "Starts late", "description": "x", "start_at": due.Add(time.Hour), "due_at": due},
+		{"title": "No due date", "description": "x", "reminder_minutes": 30},
+		{"title": "Too early", "description": "x", "due_at": due, "reminder_minutes": -5},
+	}
+	for _, c := range cases {
+		res := doJSON(t, http.MethodPost, srv.URL+"/tasks", token, c)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %d", c["title"], res.StatusCode)
+		}
+	}
+
+	task := createTask(t, srv, token, map[string]interface{}{"title": "Scheduled", "start_at": due.Add(-time.Hour), "due_at": due, "reminder_minutes": 60})
+	if task.RemindAt == nil || !task.RemindAt.Equal(due.Add(-time.Hour)) {
+		t.Errorf("expected the reminder an hour before the due date, got %v", task.RemindAt)
+	}
+
+	for _, query := range []string{"due=tomorrow", "tz=Mars/Olympus", "due_before=yesterday"} {
+		res := doJSON(t, http.MethodGet, srv.URL+"/tasks?"+query, token, nil)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %d", query, res.StatusCode)
+		}
+	}
+}
+
+func TestTaskDueFilters(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	// Use a time zone far from UTC so that "today" differs from the UTC day.
+	tz := "Pacific/Kiritimati"
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	createTask(t, srv, token, map[string]interface{}{"title": "Overdue", "due_at": time.Now().Add(-time.Minute)})
+	createTask(t, srv, token, map[string]interface{}{"title": "Today", "due_at": today.Add(23*time.Hour + 59*time.Minute)})
+	createTask(t, srv, token, map[string]interface{}{"title": "Next month", "due_at": today.AddDate(0, 1, 0)})
+	done := createTask(t, srv, token, map[string]interface{}{"title": "Done", "due_at": time.Now().Add(-time.Hour)})
+	res := doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(done.ID)), token, map[string]interface{}{"title": "Done", "description": "test task", "due_at": done.DueAt, "completed": true})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("complete task: expected 200 OK, got %d", res.StatusCode)
+	}
+
+	if got := listTasks(t, srv, token, "due=overdue"); strings.Join(got, ",") != "Overdue" {
+		t.Errorf("due=overdue: expected [Overdue], got %v", got)
+	}
+	got := listTasks(t, srv, token, "due=today&tz="+url.QueryEscape(tz))
+	if !slices.Contains(got, "Today") || slices.Contains(got, "Next month") {
+		t.Errorf("due=today: expected Today and not Next month, got %v", got)
+	}
+	got = listTasks(t, srv, token, "due=week&tz="+url.QueryEscape(tz))
+	if !slices.Contains(got, "Today") || slices.Contains(got, "Next month") {
+		t.Errorf("due=week: expected Today and not Next month, got %v", got)
+	}
+	after := url.QueryEscape(today.AddDate(0, 0, 7).Format(time.RFC3339))
+	if got := listTasks(t, srv, token, "due_after="+after); strings.Join(got, ",") != "Next month" {
+		t.Errorf("due_after: expected [Next month], got %v", got)
+	}
+	for _, query := range []string{"due=today&due_after=" + after, "due=overdue&due_before=" + after} {
+		if res := doJSON(t, http.MethodGet, srv.URL+"/tasks?"+query, token, nil); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %d", query, res.StatusCode)
+		}
+	}
+	if got := listTasks(t, srv, token, ""); len(got) != 5 {
+		t.Errorf("expected the filters to be optional, got %v", got)
+	}
+}
+
+func TestTaskReminders(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	due := time.Now().Add(10 * time.Minute)
+	createTask(t, srv, token, map[string]interface{}{"title": "Call the bank", "due_at": due, "reminder_minutes": 15})
+	createTask(t, srv, token, map[string]interface{}{"title": "Later", "due_at": due.Add(24 * time.Hour), "reminder_minutes": 15})
+
+	sent, err := handlers.SendDueReminders(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("expected one reminder to be sent, got %d (%v)", sent, err)
+	}
+	msgs, _ := mailbox.Messages()
+	if len(msgs) == 0 || msgs[len(msgs)-1].To != "leon@gmail.com" || msgs[len(msgs)-1].Subject != "Reminder: Call the bank" {
+		t.Errorf("expected a reminder email to leon@gmail.com, got %+v", msgs)
+	}
+
+	if sent, _ := handlers.SendDueReminders(context.Background()); sent != 0 {
+		t.Errorf("expected every reminder to be sent once, got %d more", sent)
+	}
+}
+
+func TestTaskOrdering(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	low := createTask(t, srv, token, map[string]interface{}{"title": "Low", "priority": models.PriorityLow})
+	high := createTask(t, srv, token, map[string]interface{}{"title": "High", "priority": models.PriorityHigh})
+	none := createTask(t, srv, token, map[string]interface{}{"title": "None"})
+
+	if got := strings.Join(listTasks(t, srv, token, ""), ","); got != "Learn Go,Low,High,None" {
+		t.Errorf("expected new tasks at the end, got %s", got)
+	}
+
+	move := func(id uint, body map[string]interface{}) *http.Response {
+		return doJSON(t, http.MethodPost, srv.URL+"/tasks/"+strconv.Itoa(int(id))+"/move", token, body)
+	}
+	if res := move(none.ID, map[string]interface{}{"before": low.ID}); res.StatusCode != http.StatusOK {
+		t.Fatalf("move: expected 200 OK, got %d", res.StatusCode)
+	}
+	if res := move(low.ID, map[string]interface{}{"after": high.ID}); res.StatusCode != http.StatusOK {
+		t.Fatalf("move: expected 200 OK, got %d", res.StatusCode)
+	}
+	if got := strings.Join(listTasks(t, srv, token, "sort=position"), ","); got != "Learn Go,None,High,Low" {
+		t.Errorf("expected the moved order, got %s", got)
+	}
+
+	// Repeated moves into the same gap eventually renumber the tasks
+	for i := 0; i < 60; i++ {
+		target, moved := high, low
+		if i%2 == 1 {
+			target, moved = low, high
+		}
+		if res := move(moved.ID, map[string]interface{}{"before": target.ID}); res.StatusCode != http.StatusOK {
+			t.Fatalf("move %d: expected 200 OK, got %d", i, res.StatusCode)
+		}
+	}
+	if got := strings.Join(listTasks(t, srv, token, ""), ","); got != "Learn Go,None,High,Low" {
+		t.Errorf("expected the order to survive renumbering, got %s", got)
+	}
+
+	if got := strings.Join(listTasks(t, srv, token, "sort=priority"), ","); got != "High,Low,Learn Go,None" {
+		t.Errorf("sort=priority: expected highest first, got %s", got)
+	}
+	if got := strings.Join(listTasks(t, srv, token, "sort=priority&order=asc"), ","); got != "Learn Go,None,Low,High" {
+		t.Errorf("sort=priority&order=asc: expected lowest first, got %s", got)
+	}
+
+	for _, body := range []map[string]interface{}{{}, {"before": low.ID, "after": high.ID}, {"before": none.ID}} {
+		if res := move(none.ID, body); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("move %v: expected 400 Bad Request, got %d", body, res.StatusCode)
+		}
+	}
+	if res := move(none.ID, map[string]interface{}{"before": 2}); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for another user's task, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks?sort=title", token, nil); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an unknown sort, got %d", res.StatusCode)
+	}
+}
+
+func TestTags(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+	other := login(t, srv, "youssef@hotmail.com", "youssef123")
+
+	createTag := func(token, name, color string) models.Tag {
+		t.Helper()
+		res := doJSON(t, http.MethodPost, srv.URL+"/tags", token, map[string]string{"name": name, "color": color})
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("create tag %s: expected 201 Created, got %d", name, res.StatusCode)
+		}
+		var tag models.Tag
+		json.NewDecoder(res.Body).Decode(&tag)
+		return tag
+	}
+	work := createTag(token, "work", "#1E90FF")
+	urgent := createTag(token, "urgent", "")
+	foreign := createTag(other, "work", "#000000")
+	if work.Color != "#1e90ff" || urgent.Color != "#808080" {
+		t.Errorf("expected normalized and default colors, got %s and %s", work.Color, urgent.Color)
+	}
+
+	if res := doJSON(t, http.MethodPost, srv.URL+"/tags", token, map[string]string{"name": "work"}); res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for a duplicate name, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPost, srv.URL+"/tags", token, map[string]string{"name": "home", "color": "red"}); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an invalid color, got %d", res.StatusCode)
+	}
+
+	both := createTask(t, srv, token, map[string]interface{}{"title": "Both"})
+	workOnly := createTask(t, srv, token, map[string]interface{}{"title": "Work only"})
+	attach := func(task models.Task, ids ...uint) *http.Response {
+		return doJSON(t, http.MethodPost, srv.URL+"/tasks/"+strconv.Itoa(int(task.ID))+"/tags", token, map[string]interface{}{"tag_ids": ids})
+	}
+	res := attach(both, work.ID, urgent.ID)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("attach: expected 200 OK, got %d", res.StatusCode)
+	}
+	var tagged models.Task
+	json.NewDecoder(res.Body).Decode(&tagged)
+	if len(tagged.Tags) != 2 || tagged.Tags[0].Name != "urgent" || tagged.Tags[1].Name != "work" {
+		t.Errorf("expected the task with both tags, got %+v", tagged.Tags)
+	}
+	attach(workOnly, work.ID)
+	if res := attach(workOnly, foreign.ID); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for another user's tag, got %d", res.StatusCode)
+	}
+
+	// Tags sent with a task update are ignored
+	res = doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(workOnly.ID)), token, map[string]interface{}{
+		"title": "Work only", "description": "changed", "tags": []models.Tag{foreign},
+	})
+	json.NewDecoder(res.Body).Decode(&tagged)
+	if len(tagged.Tags) != 1 || tagged.Tags[0].ID != work.ID {
+		t.Errorf("expected the update to keep the task's tags, got %+v", tagged.Tags)
+	}
+
+	if got := strings.Join(listTasks(t, srv, token, "tags=work,urgent"), ","); got != "Both,Work only" {
+		t.Errorf("tags=work,urgent: expected tasks with any of the tags, got %s", got)
+	}
+	if got := strings.Join(listTasks(t, srv, token, "tags=work,urgent&tag_match=all"), ","); got != "Both" {
+		t.Errorf("tag_match=all: expected tasks with all of the tags, got %s", got)
+	}
+
+	res = doJSON(t, http.MethodDelete, srv.URL+"/tasks/"+strconv.Itoa(int(both.ID))+"/tags/"+strconv.Itoa(int(urgent.ID)), token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("detach: expected 200 OK, got %d", res.StatusCode)
+	}
+	if got := listTasks(t, srv, token, "tags=urgent"); len(got) != 0 {
+		t.Errorf("expected no tasks tagged urgent after detaching, got %v", got)
+	}
+
+	if res := doJSON(t, http.MethodDelete, srv.URL+"/tags/"+strconv.Itoa(int(work.ID)), token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("delete tag: expected 200 OK, got %d", res.StatusCode)
+	}
+	if got := listTasks(t, srv, token, "tags=work"); len(got) != 0 {
+		t.Errorf("expected a deleted tag to be removed from tasks, got %v", got)
+	}
+	if res := doJSON(t, http.MethodDelete, srv.URL+"/tags/"+strconv.Itoa(int(foreign.ID)), token, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for another user's tag, got %d", res.StatusCode)
+	}
+}
+
+func TestProjects(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+	other := login(t, srv, "youssef@hotmail.com", "youssef123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/projects", token, map[string]string{"name": "Home", "description": "Chores"})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create project: expected 201 Created, got %d", res.StatusCode)
+	}
+	var project models.Project
+	json.NewDecoder(res.Body).Decode(&project)
+	projectURL := srv.URL + "/projects/" + strconv.Itoa(int(project.ID))
+
+	res = doJSON(t, http.MethodPost, projectURL+"/tasks", token, map[string]interface{}{"title": "Dishes", "description": "x"})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create project task: expected 201 Created, got %d", res.StatusCode)
+	}
+	createTask(t, srv, token, map[string]interface{}{"title": "Laundry", "project_id": project.ID})
+	done := createTask(t, srv, token, map[string]interface{}{"title": "Groceries", "project_id": project.ID})
+	res = doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(done.ID)), token, map[string]interface{}{
+		"title": "Groceries", "description": "test task", "project_id": project.ID, "completed": true,
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("complete task: expected 200 OK, got %d", res.StatusCode)
+	}
+
+	if got := strings.Join(listTasks(t, srv, token, ""), ","); got != "Learn Go,Dishes,Laundry,Groceries" {
+		t.Errorf("expected project tasks in the full list, got %s", got)
+	}
+	res = doJSON(t, http.MethodGet, projectURL+"/tasks?sort=created&order=asc", token, nil)
+	var tasks []models.Task
+	json.NewDecoder(res.Body).Decode(&tasks)
+	if len(tasks) != 3 || tasks[0].Title != "Dishes" {
+		t.Errorf("expected the three project tasks, got %+v", tasks)
+	}
+
+	res = doJSON(t, http.MethodGet, projectURL, token, nil)
+	json.NewDecoder(res.Body).Decode(&project)
+	if project.OpenTasks != 2 || project.CompletedTasks != 1 {
+		t.Errorf("expected 2 open and 1 completed task, got %d and %d", project.OpenTasks, project.CompletedTasks)
+	}
+
+	// Other users can neither see the project nor add tasks to it
+	if res := doJSON(t, http.MethodGet, projectURL+"/tasks", other, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for another user's project, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPost, srv.URL+"/tasks", other, map[string]interface{}{"title": "Sneaky", "description": "x", "project_id": project.ID}); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for another user's project, got %d", res.StatusCode)
+	}
+
+	// Archived projects are hidden by default and take no new tasks
+	if res := doJSON(t, http.MethodPost, projectURL+"/archive", token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("archive: expected 200 OK, got %d", res.StatusCode)
+	}
+	var projects []models.Project
+	json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/projects", token, nil).Body).Decode(&projects)
+	if len(projects) != 0 {
+		t.Errorf("expected archived projects to be hidden, got %+v", projects)
+	}
+	json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/projects?archived=true", token, nil).Body).Decode(&projects)
+	if len(projects) != 1 || projects[0].ArchivedAt == nil || projects[0].OpenTasks != 2 {
+		t.Errorf("expected the archived project with its counts, got %+v", projects)
+	}
+	if res := doJSON(t, http.MethodPost, projectURL+"/tasks", token, map[string]interface{}{"title": "Late", "description": "x"}); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an archived project, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(done.ID)), token, map[string]interface{}{
+		"title": "Groceries", "description": "still editable", "project_id": project.ID, "completed": true,
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected tasks of an archived project to stay editable, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPost, projectURL+"/unarchive", token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("unarchive: expected 200 OK, got %d", res.StatusCode)
+	}
+
+	// Deleting a project keeps its tasks
+	if res := doJSON(t, http.MethodDelete, projectURL, token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("delete project: expected 200 OK, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(done.ID)), token, nil)
+	var kept models.Task
+	json.NewDecoder(res.Body).Decode(&kept)
+	if res.StatusCode != http.StatusOK || kept.ProjectID != nil {
+		t.Errorf("expected the task to be kept without a project, got %d %+v", res.StatusCode, kept)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+	t.Setenv("TASK_MAX_DEPTH", "2")
+
+	root := createTask(t, srv, token, map[string]interface{}{"title": "Move house"})
+	pack := createTask(t, srv, token, map[string]interface{}{"title": "Pack", "parent_id": root.ID})
+	books := createTask(t, srv, token, map[string]interface{}{"title": "Books", "parent_id": pack.ID})
+	createTask(t, srv, token, map[string]interface{}{"title": "Clothes", "parent_id": pack.ID})
+	createTask(t, srv, token, map[string]interface{}{"title": "Book van", "parent_id": root.ID})
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/tasks", token, map[string]interface{}{"title": "Too deep", "description": "x", "parent_id": books.ID})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request beyond the maximum depth, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(root.ID)), token, map[string]interface{}{"title": "Move house", "description": "test task", "parent_id": books.ID})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for a cycle, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPost, srv.URL+"/tasks", token, map[string]interface{}{"title": "Foreign", "description": "x", "parent_id": 2})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for another user's parent, got %d", res.StatusCode)
+	}
+
+	update := func(task models.Task, completed bool) {
+		t.Helper()
+		res := doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(task.ID)), token, map[string]interface{}{
+			"title": task.Title, "description": "test task", "parent_id": task.ParentID, "completed": completed,
+		})
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("update %s: expected 200 OK, got %d", task.Title, res.StatusCode)
+		}
+	}
+	getTask := func(id uint) models.Task {
+		var task models.Task
+		json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(id)), token, nil).Body).Decode(&task)
+		return task
+	}
+
+	update(books, true)
+	if got := getTask(root.ID); got.Subtasks != 4 || got.CompletedSubtasks != 1 || got.Progress != 25 {
+		t.Errorf("expected 1 of 4 subtasks done (25%%), got %d of %d (%d%%)", got.CompletedSubtasks, got.Subtasks, got.Progress)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(root.ID))+"/children", token, nil)
+	var children []models.Task
+	json.NewDecoder(res.Body).Decode(&children)
+	if len(children) != 2 || children[0].Title != "Pack" || children[0].Progress != 50 {
+		t.Errorf("expected Pack (50%%) and Book van, got %+v", children)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(root.ID))+"/tree", token, nil)
+	var tree models.TaskTree
+	json.NewDecoder(res.Body).Decode(&tree)
+	if len(tree.Children) != 2 || len(tree.Children[0].Children) != 2 || tree.Children[0].Children[0].Title != "Books" {
+		t.Errorf("expected the nested tree, got %+v", tree)
+	}
+
+	// Completing a parent completes its subtasks; reopening one reopens its ancestors
+	update(root, true)
+	if got := getTask(root.ID); got.Progress != 100 {
+		t.Errorf("expected all subtasks completed with the parent, got %d%%", got.Progress)
+	}
+	update(books, false)
+	if getTask(pack.ID).Completed || getTask(root.ID).Completed {
+		t.Errorf("expected reopening a subtask to reopen its ancestors")
+	}
+
+	// Deleting a parent deletes its subtasks
+	if res := doJSON(t, http.MethodDelete, srv.URL+"/tasks/"+strconv.Itoa(int(pack.ID)), token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("delete: expected 200 OK, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(books.ID)), token, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected subtasks to be deleted with their parent, got %d", res.StatusCode)
+	}
+	if got := getTask(root.ID); got.Subtasks != 1 {
+		t.Errorf("expected 1 remaining subtask, got %d", got.Subtasks)
+	}
+}
+
+func TestRecurringTasks(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	for _, body := range []map[string]interface{}{
+		{"title": "No due date", "description": "x", "recurrence": "FREQ=DAILY"},
+		{"title": "Yearly", "description": "x", "due_at": time.Now(), "recurrence": "FREQ=YEARLY"},
+		{"title": "Bad zone", "description": "x", "due_at": time.Now(), "recurrence": "FREQ=DAILY", "time_zone": "Mars/Olympus"},
+	} {
+		if res := doJSON(t, http.MethodPost, srv.URL+"/tasks", token, body); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %d", body["title"], res.StatusCode)
+		}
+	}
+
+	// Monday 09:00 in Berlin, the week before the switch to summer time
+	due := time.Date(2024, 3, 25, 8, 0, 0, 0, time.UTC)
+	tag := doJSON(t, http.MethodPost, srv.URL+"/tags", token, map[string]string{"name": "chores"})
+	var chores models.Tag
+	json.NewDecoder(tag.Body).Decode(&chores)
+	task := createTask(t, srv, token, map[string]interface{}{
+		"title": "Take out the bins", "due_at": due, "reminder_minutes": 60,
+		"recurrence": "freq=weekly;count=3", "time_zone": "Europe/Berlin",
+	})
+	if task.Recurrence != "FREQ=WEEKLY;COUNT=3" || task.Occurrence != 1 {
+		t.Errorf("expected the canonical rule as occurrence 1, got %q (%d)", task.Recurrence, task.Occurrence)
+	}
+	doJSON(t, http.MethodPost, srv.URL+"/tasks/"+strconv.Itoa(int(task.ID))+"/tags", token, map[string]interface{}{"tag_ids": []uint{chores.ID}})
+
+	res := doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(task.ID))+"/occurrences?count=5", token, nil)
+	var preview []time.Time
+	json.NewDecoder(res.Body).Decode(&preview)
+	// 09:00 in Berlin is 07:00 UTC in summer time
+	if len(preview) != 2 || !preview[0].Equal(time.Date(2024, 4, 1, 7, 0, 0, 0, time.UTC)) || !preview[1].Equal(time.Date(2024, 4, 8, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the two remaining Mondays at 09:00 Berlin time, got %v", preview)
+	}
+
+	complete := func(task models.Task, completed bool) models.Task {
+		t.Helper()
+		res := doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(task.ID)), token, map[string]interface{}{
+			"title": task.Title, "description": task.Description, "due_at": task.DueAt, "reminder_minutes": task.ReminderMinutes,
+			"recurrence": task.Recurrence, "time_zone": task.TimeZone, "completed": completed,
+		})
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("update %s: expected 200 OK, got %d", task.Title, res.StatusCode)
+		}
+		var updated models.Task
+		json.NewDecoder(res.Body).Decode(&updated)
+		return updated
+	}
+
+	done := complete(task, true)
+	if done.NextOccurrenceID == nil {
+		t.Fatal("expected completing the task to create the next occurrence")
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(*done.NextOccurrenceID)), token, nil)
+	var next models.Task
+	json.NewDecoder(res.Body).Decode(&next)
+	if next.Completed || next.Occurrence != 2 || next.DueAt == nil || !next.DueAt.Equal(preview[0]) {
+		t.Errorf("expected open occurrence 2 due %s, got %+v", preview[0], next)
+	}
+	if next.RemindAt == nil || !next.RemindAt.Equal(preview[0].Add(-time.Hour)) {
+		t.Errorf("expected the reminder to move along, got %v", next.RemindAt)
+	}
+	if len(next.Tags) != 1 || next.Tags[0].Name != "chores" {
+		t.Errorf("expected the tags to be copied, got %+v", next.Tags)
+	}
+
+	// Completing again after reopening does not create another occurrence
+	complete(complete(done, false), true)
+	second := complete(next, true)
+	if second.NextOccurrenceID == nil {
+		t.Fatal("expected occurrence 3 to be created")
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(*second.NextOccurrenceID)), token, nil)
+	var last models.Task
+	json.NewDecoder(res.Body).Decode(&last)
+	if last = complete(last, true); last.NextOccurrenceID != nil {
+		t.Errorf("expected the series to end after COUNT occurrences")
+	}
+	if got := listTasks(t, srv, token, "tags=chores"); len(got) != 3 {
+		t.Errorf("expected 3 occurrences in total, got %v", got)
+	}
+}
+
+func TestTaskWorkflow(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/projects", token, map[string]string{"name": "Blog"})
+	var project models.Project
+	json.NewDecoder(res.Body).Decode(&project)
+	projectURL := srv.URL + "/projects/" + strconv.Itoa(int(project.ID))
+
+	for _, wf := range []map[string]interface{}{
+		{"statuses": []string{"draft"}, "done": []string{"draft"}},
+		{"statuses": []string{"draft", "published"}, "done": []string{"gone"}},
+		{"statuses": []string{"draft", "published"}, "done": []string{"draft"}},
+		{"statuses": []string{"draft", "published"}, "done": []string{"published"}, "transitions": map[string][]string{"draft": {"nowhere"}}},
+	} {
+		if res := doJSON(t, http.MethodPut, projectURL+"/workflow", token, wf); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: expected 400 Bad Request, got %d", wf, res.StatusCode)
+		}
+	}
+	res = doJSON(t, http.MethodPut, projectURL+"/workflow", token, map[string]interface{}{
+		"statuses": []string{"draft", "writing", "review", "published"},
+		"transitions": map[string][]string{
+			"draft":     {"writing"},
+			"writing":   {"review"},
+			"review":    {"writing", "published"},
+			"published": {"writing"},
+		},
+		"done": []string{"published"},
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("set workflow: expected 200 OK, got %d", res.StatusCode)
+	}
+
+	post := createTask(t, srv, token, map[string]interface{}{"title": "Post", "project_id": project.ID})
+	if post.Status != "draft" || post.Completed {
+		t.Errorf("expected a new task in the first status, got %q", post.Status)
+	}
+	if res := doJSON(t, http.MethodPost, srv.URL+"/tasks", token, map[string]interface{}{"title": "Odd", "description": "x", "project_id": project.ID, "status": "doing"}); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for a status outside the workflow, got %d", res.StatusCode)
+	}
+
+	update := func(body map[string]interface{}) (models.Task, int) {
+		t.Helper()
+		body["title"], body["description"], body["project_id"] = "Post", "test task", project.ID
+		res := doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(post.ID)), token, body)
+		var task models.Task
+		json.NewDecoder(res.Body).Decode(&task)
+		return task, res.StatusCode
+	}
+
+	if _, status := update(map[string]interface{}{"status": "review"}); status != http.StatusConflict {
+		t.Errorf("draft to review: expected 409 Conflict, got %d", status)
+	}
+	if _, status := update(map[string]interface{}{"status": "lost"}); status != http.StatusBadRequest {
+		t.Errorf("unknown status: expected 400 Bad Request, got %d", status)
+	}
+	update(map[string]interface{}{"status": "writing"})
+	update(map[string]interface{}{"status": "review"})
+	published, _ := update(map[string]interface{}{"status": "published"})
+	if !published.Completed || published.CompletedAt == nil {
+		t.Errorf("expected the done status to complete the task, got %+v", published)
+	}
+	if got := listTasks(t, srv, token, "status=published"); !slices.Equal(got, []string{"Post"}) {
+		t.Errorf("expected the task under status=published, got %v", got)
+	}
+
+	// Clients that only send completed move the task along the workflow, as
+	// long as the workflow allows it
+	if _, status := update(map[string]interface{}{"completed": false}); status != http.StatusConflict {
+		t.Errorf("reopen to draft: expected 409 Conflict, got %d", status)
+	}
+	task := createTask(t, srv, token, map[string]interface{}{"title": "Plain"})
+	res = doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(task.ID)), token, map[string]interface{}{
+		"title": "Plain", "description": "test task", "completed": true,
+	})
+	json.NewDecoder(res.Body).Decode(&task)
+	if task.Status != models.StatusDone || task.CompletedAt == nil {
+		t.Errorf("expected completed=true to move the task to done, got %q", task.Status)
+	}
+	res = doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(task.ID)), token, map[string]interface{}{
+		"title": "Plain", "description": "test task", "status": models.StatusDone, "completed": false,
+	})
+	json.NewDecoder(res.Body).Decode(&task)
+	if task.Status != models.StatusTodo || task.Completed || task.CompletedAt != nil {
+		t.Errorf("expected completed=false to reopen the task, got %q", task.Status)
+	}
+
+	// Statuses in use cannot be removed
+	res = doJSON(t, http.MethodPut, projectURL+"/workflow", token, map[string]interface{}{
+		"statuses": []string{"draft", "done"}, "done": []string{"done"},
+	})
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for removing a status in use, got %d", res.StatusCode)
+	}
+
+	// Deleting the project moves its tasks to the default workflow
+	draft := createTask(t, srv, token, map[string]interface{}{"title": "Draft", "project_id": project.ID})
+	if res := doJSON(t, http.MethodDelete, projectURL, token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("delete project: expected 200 OK, got %d", res.StatusCode)
+	}
+	for _, want := range []models.Task{
+		{ID: post.ID, Status: models.StatusDone, Completed: true},
+		{ID: draft.ID, Status: models.StatusTodo},
+	} {
+		var got models.Task
+		json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/tasks/"+strconv.Itoa(int(want.ID)), token, nil).Body).Decode(&got)
+		if got.ProjectID != nil || got.Status != want.Status || got.Completed != want.Completed {
+			t.Errorf("task %d: expected %q without a project, got %q in %v", want.ID, want.Status, got.Status, got.ProjectID)
+		}
+	}
+}
+
+func TestBoard(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/projects", token, map[string]string{"name": "Sprint"})
+	var project models.Project
+	json.NewDecoder(res.Body).Decode(&project)
+	boardURL := srv.URL + "/boards/" + strconv.Itoa(int(project.ID))
+	res = doJSON(t, http.MethodPut, srv.URL+"/projects/"+strconv.Itoa(int(project.ID))+"/workflow", token, map[string]interface{}{
+		"statuses": []string{"todo", "doing", "done"}, "done": []string{"done"}, "wip_limits": map[string]int{"doing": 2},
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("set workflow: expected 200 OK, got %d", res.StatusCode)
+	}
+
+	var tasks []models.Task
+	for _, title := range []string{"A", "B", "C"} {
+		tasks = append(tasks, createTask(t, srv, token, map[string]interface{}{"title": title, "project_id": project.ID}))
+	}
+
+	move := func(body map[string]interface{}) int {
+		t.Helper()
+		return doJSON(t, http.MethodPost, boardURL+"/move", token, body).StatusCode
+	}
+	column := func(board models.Board, status string) []string {
+		for _, c := range board.Columns {
+			if c.Status == status {
+				titles := make([]string, len(c.Tasks))
+				for i, task := range c.Tasks {
+					titles[i] = task.Title
+				}
+				return titles
+			}
+		}
+		return nil
+	}
+	board := func() models.Board {
+		t.Helper()
+		res := doJSON(t, http.MethodGet, boardURL, token, nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET board: expected 200 OK, got %d", res.StatusCode)
+		}
+		var b models.Board
+		json.NewDecoder(res.Body).Decode(&b)
+		return b
+	}
+
+	if status := move(map[string]interface{}{"task_id": tasks[0].ID, "status": "doing"}); status != http.StatusOK {
+		t.Fatalf("move A: expected 200 OK, got %d", status)
+	}
+	// B goes before A in the same move that changes its column
+	if status := move(map[string]interface{}{"task_id": tasks[1].ID, "status": "doing", "before": tasks[0].ID}); status != http.StatusOK {
+		t.Fatalf("move B: expected 200 OK, got %d", status)
+	}
+	if status := move(map[string]interface{}{"task_id": tasks[2].ID, "status": "doing"}); status != http.StatusConflict {
+		t.Errorf("move C over the limit: expected 409 Conflict, got %d", status)
+	}
+	res = doJSON(t, http.MethodPut, srv.URL+"/tasks/"+strconv.Itoa(int(tasks[2].ID)), token, map[string]interface{}{
+		"title": "C", "description": "test task", "project_id": project.ID, "status": "doing",
+	})
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("PUT over the limit: expected 409 Conflict, got %d", res.StatusCode)
+	}
+	for _, url := range []string{srv.URL + "/tasks", srv.URL + "/projects/" + strconv.Itoa(int(project.ID)) + "/tasks"} {
+		res := doJSON(t, http.MethodPost, url, token, map[string]interface{}{
+			"title": "D", "description": "test task", "project_id": project.ID, "status": "doing",
+		})
+		if res.StatusCode != http.StatusConflict {
+			t.Errorf("POST %s into a full column: expected 409 Conflict, got %d", url, res.StatusCode)
+		}
+	}
+	if status := move(map[string]interface{}{"task_id": tasks[2].ID, "status": "done", "after": tasks[0].ID}); status != http.StatusBadRequest {
+		t.Errorf("neighbour in another column: expected 400 Bad Request, got %d", status)
+	}
+
+	b := board()
+	if len(b.Columns) != 3 || b.Columns[1].WIPLimit != 2 || b.Columns[1].Count != 2 {
+		t.Errorf("expected three columns with the limit and count of doing, got %+v", b.Columns)
+	}
+	if got := column(b, "doing"); !slices.Equal(got, []string{"B", "A"}) {
+		t.Errorf("expected B before A in doing, got %v", got)
+	}
+	if got := column(b, "todo"); !slices.Equal(got, []string{"C"}) {
+		t.Errorf("expected C left in todo, got %v", got)
+	}
+
+	// Moving to a done column completes the task and frees its place
+	if status := move(map[string]interface{}{"task_id": tasks[1].ID, "status": "done"}); status != http.StatusOK {
+		t.Fatalf("move B to done: expected 200 OK, got %d", status)
+	}
+	if status := move(map[string]interface{}{"task_id": tasks[2].ID, "status": "doing", "after": tasks[0].ID}); status != http.StatusOK {
+		t.Errorf("move C: expected 200 OK, got %d", status)
+	}
+	b = board()
+	if got := column(b, "doing"); !slices.Equal(got, []string{"A", "C"}) {
+		t.Errorf("expected A then C in doing, got %v", got)
+	}
+	if done := b.Columns[2]; len(done.Tasks) != 1 || !done.Tasks[0].Completed {
+		t.Errorf("expected B completed in done, got %+v", done.Tasks)
+	}
+
+	// A deleted task cannot come back into a column that filled up
+	doJSON(t, http.MethodDelete, srv.URL+"/tasks/"+strconv.Itoa(int(tasks[2].ID)), token, nil)
+	createTask(t, srv, token, map[string]interface{}{"title": "D", "project_id": project.ID, "status": "doing"})
+	if res := doJSON(t, http.MethodPost, srv.URL+"/tasks/"+strconv.Itoa(int(tasks[2].ID))+"/restore", token, nil); res.StatusCode != http.StatusConflict {
+		t.Errorf("restore into a full column: expected 409 Conflict, got %d", res.StatusCode)
+	}
+
+	other := login(t, srv, "youssef@hotmail.com", "youssef123")
+	if res := doJSON(t, http.MethodGet, boardURL, other, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for another user's board, got %d", res.StatusCode)
+	}
+}
+
+func TestTaskDependencies(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+	other := login(t, srv, "youssef@hotmail.com", "youssef123")
+
+	design := createTask(t, srv, token, map[string]interface{}{"title": "Design"})
+	build := createTask(t, srv, token, map[string]interface{}{"title": "Build", "priority": models.PriorityHigh})
+	ship := createTask(t, srv, token, map[string]interface{}{"title": "Ship"})
+	taskURL := func(task models.Task) string {
+		return srv.URL + "/tasks/" + strconv.Itoa(int(task.ID))
+	}
+	block := func(task, blocker models.Task) int {
+		t.Helper()
+		return doJSON(t, http.MethodPost, taskURL(task)+"/blockers", token, map[string]uint{"blocker_id": blocker.ID}).StatusCode
+	}
+
+	if status := block(build, design); status != http.StatusOK {
+		t.Fatalf("block build: expected 200 OK, got %d", status)
+	}
+	if status := block(ship, build); status != http.StatusOK {
+		t.Fatalf("block ship: expected 200 OK, got %d", status)
+	}
+	if status := block(design, ship); status != http.StatusConflict {
+		t.Errorf("cycle: expected 409 Conflict, got %d", status)
+	}
+	if status := block(design, design); status != http.StatusBadRequest {
+		t.Errorf("self: expected 400 Bad Request, got %d", status)
+	}
+	foreign := createTask(t, srv, other, map[string]interface{}{"title": "Foreign"})
+	if status := block(design, foreign); status != http.StatusBadRequest {
+		t.Errorf("another user's task: expected 400 Bad Request, got %d", status)
+	}
+
+	var got models.Task
+	json.NewDecoder(doJSON(t, http.MethodGet, taskURL(build), token, nil).Body).Decode(&got)
+	if !got.Blocked || !slices.Equal(got.BlockedBy, []uint{design.ID}) {
+		t.Errorf("expected build to be blocked by design, got %v %v", got.Blocked, got.BlockedBy)
+	}
+
+	// Despite its priority, build waits for design
+	var next []models.Task
+	json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/tasks/next", token, nil).Body).Decode(&next)
+	titles := make([]string, len(next))
+	for i, task := range next {
+		titles[i] = task.Title
+	}
+	if !slices.Equal(titles, []string{"Learn Go", "Design", "Build", "Ship"}) {
+		t.Errorf("expected blockers before the tasks they block, got %v", titles)
+	}
+
+	complete := map[string]interface{}{"title": "Build", "description": "test task", "priority": models.PriorityHigh, "completed": true}
+	if res := doJSON(t, http.MethodPut, taskURL(build), token, complete); res.StatusCode != http.StatusConflict {
+		t.Errorf("complete a blocked task: expected 409 Conflict, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPut, taskURL(build)+"?force=true", token, complete); res.StatusCode != http.StatusOK {
+		t.Errorf("force completion: expected 200 OK, got %d", res.StatusCode)
+	}
+	json.NewDecoder(doJSON(t, http.MethodGet, taskURL(ship), token, nil).Body).Decode(&got)
+	if got.Blocked {
+		t.Error("expected ship to be free once build is done")
+	}
+
+	if res := doJSON(t, http.MethodDelete, taskURL(build)+"/blockers/"+strconv.Itoa(int(design.ID)), token, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("remove blocker: expected 200 OK, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodDelete, taskURL(build)+"/blockers/"+strconv.Itoa(int(design.ID)), token, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("remove missing blocker: expected 404 Not Found, got %d", res.StatusCode)
+	}
+}
+
+func TestSubtaskCascadeRules(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+	taskURL := func(task models.Task) string {
+		return srv.URL + "/tasks/" + strconv.Itoa(int(task.ID))
+	}
+	complete := func(task models.Task, query string) int {
+		t.Helper()
+		return doJSON(t, http.MethodPut, taskURL(task)+query, token, map[string]interface{}{
+			"title": task.Title, "description": "test task", "completed": true,
+		}).StatusCode
+	}
+	getTask := func(task models.Task) models.Task {
+		var got models.Task
+		json.NewDecoder(doJSON(t, http.MethodGet, taskURL(task), token, nil).Body).Decode(&got)
+		return got
+	}
+
+	// A subtask with open blockers holds its parent back, unless forced
+	release := createTask(t, srv, token, map[string]interface{}{"title": "Release"})
+	notes := createTask(t, srv, token, map[string]interface{}{"title": "Write notes", "parent_id": release.ID})
+	freeze := createTask(t, srv, token, map[string]interface{}{"title": "Freeze"})
+	doJSON(t, http.MethodPost, taskURL(notes)+"/blockers", token, map[string]uint{"blocker_id": freeze.ID})
+	if status := complete(release, ""); status != http.StatusConflict {
+		t.Errorf("parent of a blocked subtask: expected 409 Conflict, got %d", status)
+	}
+	if getTask(release).Completed || getTask(notes).Completed {
+		t.Errorf("expected the rejected completion to change nothing")
+	}
+	if status := complete(release, "?force=true"); status != http.StatusOK {
+		t.Errorf("forced completion: expected 200 OK, got %d", status)
+	}
+	if !getTask(notes).Completed {
+		t.Errorf("expected the forced completion to complete the subtask")
+	}
+
+	// A subtask whose workflow does not allow the move holds its parent back
+	res := doJSON(t, http.MethodPost, srv.URL+"/projects", token, map[string]string{"name": "Blog"})
+	var blog models.Project
+	json.NewDecoder(res.Body).Decode(&blog)
+	doJSON(t, http.MethodPut, srv.URL+"/projects/"+strconv.Itoa(int(blog.ID))+"/workflow", token, map[string]interface{}{
+		"statuses":    []string{"draft", "review", "published"},
+		"transitions": map[string][]string{"draft": {"review"}, "review": {"published"}},
+		"done":        []string{"published"},
+	})
+	launch := createTask(t, srv, token, map[string]interface{}{"title": "Launch"})
+	createTask(t, srv, token, map[string]interface{}{"title": "Announce", "parent_id": launch.ID, "project_id": blog.ID})
+	if status := complete(launch, ""); status != http.StatusConflict {
+		t.Errorf("parent of a subtask that cannot be published: expected 409 Conflict, got %d", status)
+	}
+
+	// A recurring subtask completed with its parent gets its next occurrence
+	week := createTask(t, srv, token, map[string]interface{}{"title": "Week"})
+	standup := createTask(t, srv, token, map[string]interface{}{
+		"title": "Standup", "parent_id": week.ID, "due_at": time.Now(), "recurrence": "FREQ=DAILY",
+	})
+	if status := complete(week, ""); status != http.StatusOK {
+		t.Fatalf("complete parent: expected 200 OK, got %d", status)
+	}
+	if got := getTask(standup); !got.Completed || got.NextOccurrenceID == nil {
+		t.Errorf("expected the recurring subtask to be completed with a next occurrence, got %+v", got)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	parent := createTask(t, srv, token, map[string]interface{}{"title": "Trip"})
+	child := createTask(t, srv, token, map[string]interface{}{"title": "Book hotel", "parent_id": parent.ID})
+	early := createTask(t, srv, token, map[string]interface{}{"title": "Pack", "parent_id": parent.ID})
+	taskURL := func(task models.Task) string {
+		return srv.URL + "/tasks/" + strconv.Itoa(int(task.ID))
+	}
+	trash := func() []string {
+		t.Helper()
+		var tasks []models.TrashedTask
+		json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/tasks/trash", token, nil).Body).Decode(&tasks)
+		titles := make([]string, len(tasks))
+		for i, task := range tasks {
+			titles[i] = task.Title
+			if task.DeletedAt.IsZero() || !task.PurgeAt.After(task.DeletedAt) {
+				t.Errorf("expected %s with its deletion and purge times, got %+v", task.Title, task)
+			}
+		}
+		slices.Sort(titles)
+		return titles
+	}
+
+	doJSON(t, http.MethodDelete, taskURL(early), token, nil)
+	time.Sleep(10 * time.Millisecond)
+	doJSON(t, http.MethodDelete, taskURL(parent), token, nil)
+	if got := trash(); !slices.Equal(got, []string{"Book hotel", "Pack", "Trip"}) {
+		t.Errorf("expected the deleted tasks in the trash, got %v", got)
+	}
+	if got := listTasks(t, srv, token, ""); !slices.Equal(got, []string{"Learn Go"}) {
+		t.Errorf("expected deleted tasks to be hidden, got %v", got)
+	}
+
+	if res := doJSON(t, http.MethodPost, taskURL(child)+"/restore", token, nil); res.StatusCode != http.StatusConflict {
+		t.Errorf("restore a subtask of a deleted task: expected 409 Conflict, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPost, taskURL(parent)+"/restore", token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("restore: expected 200 OK, got %d", res.StatusCode)
+	}
+	// Only the subtask deleted along with the parent comes back
+	if got := trash(); !slices.Equal(got, []string{"Pack"}) {
+		t.Errorf("expected the earlier deleted subtask to stay in the trash, got %v", got)
+	}
+	if res := doJSON(t, http.MethodPost, taskURL(parent)+"/restore", token, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("restore a live task: expected 404 Not Found, got %d", res.StatusCode)
+	}
+
+	// Permanent deletion skips the trash, and takes the subtasks along
+	if res := doJSON(t, http.MethodDelete, taskURL(parent)+"?permanent=true", token, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("permanent delete: expected 200 OK, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, taskURL(child), token, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the subtask to be gone, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodPost, taskURL(parent)+"/restore", token, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("restore a purged task: expected 404 Not Found, got %d", res.StatusCode)
+	}
+
+	// The purge job removes tasks that outlived the retention period
+	doomed := createTask(t, srv, token, map[string]interface{}{"title": "Old"})
+	doJSON(t, http.MethodDelete, taskURL(doomed), token, nil)
+	if purged, err := models.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("expected recent deletions to be kept, got %d (%v)", purged, err)
+	}
+	if purged, err := models.PurgeTrash(time.Now().Add(time.Minute)); err != nil || purged != 1 {
+		t.Errorf("expected the trashed task to be purged, got %d (%v)", purged, err)
+	}
+	if got := trash(); len(got) != 0 {
+		t.Errorf("expected an empty trash, got %v", got)
+	}
+}
@@ -0,0 +1,739 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youssef-abbih/go-todo-list/mailer"
+	"github.com/youssef-abbih/go-todo-list/models"
+	"github.com/youssef-abbih/go-todo-list/password"
+	"github.com/youssef-abbih/go-todo-list/totp"
+)
+
+// mailbox collects the emails sent by the server under test.
+var mailbox *mailer.FileMailer
+
+// newTestServer resets the test database and starts the full router.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	if os.Getenv("JWT_SECRET") == "" {
+		t.Setenv("JWT_SECRET", "test-secret")
+	}
+	mailbox = &mailer.FileMailer{Dir: t.TempDir()}
+	mailer.SetDefault(mailbox)
+	models.InitDB()
+	models.SeedTestData(models.DB)
+
+	srv := httptest.NewServer(NewRouter())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// doJSON sends body as JSON (if non-nil) with an optional bearer token.
+func doJSON(t *testing.T, method, url, token string, body interface{}) *http.Response {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+// tokenInLastMail returns the token from the "token=" link of the latest email to the given address.
+func tokenInLastMail(t *testing.T, to string) string {
+	t.Helper()
+	msgs, err := mailbox.Messages()
+	if err != nil {
+		t.Fatalf("reading mailbox: %v", err)
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].To != to {
+			continue
+		}
+		if m := tokenLink.FindStringSubmatch(msgs[i].Body); m != nil {
+			return m[1]
+		}
+	}
+	t.Fatalf("no email with a token sent to %s", to)
+	return ""
+}
+
+// awaitTokenInMail is tokenInLastMail for emails sent in the background: it
+// waits up to a few seconds for the first one to the given address.
+func awaitTokenInMail(t *testing.T, to string) string {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		msgs, _ := mailbox.Messages()
+		for _, msg := range msgs {
+			if msg.To == to && tokenLink.MatchString(msg.Body) {
+				return tokenInLastMail(t, to)
+			}
+		}
+	}
+	return tokenInLastMail(t, to)
+}
+
+var tokenLink = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// tokenPair is the response body of login and token refresh.
+type tokenPair struct {
+	Token        string `json:"Token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// loginPair logs in with the given credentials, failing the test otherwise.
+func loginPair(t *testing.T, srv *httptest.Server, email, password string) tokenPair {
+	t.Helper()
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/login", "", map[string]string{"email": email, "password": password})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("login %s: expected 200 OK, got %d", email, res.StatusCode)
+	}
+	var pair tokenPair
+	json.NewDecoder(res.Body).Decode(&pair)
+	if pair.Token == "" || pair.RefreshToken == "" {
+		t.Fatalf("login %s: expected an access and a refresh token in the response", email)
+	}
+	return pair
+}
+
+// login returns a JWT for the given credentials, failing the test otherwise.
+func login(t *testing.T, srv *httptest.Server, email, password string) string {
+	t.Helper()
+	return loginPair(t, srv, email, password).Token
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	srv := newTestServer(t)
+
+	creds := map[string]string{"email": "new@example.com", "password": "secret123"}
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/register", "", creds)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/register", "", creds)
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for duplicate email, got %d", res.StatusCode)
+	}
+
+	token := login(t, srv, "new@example.com", "secret123")
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK from /tasks with issued token, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login", "", map[string]string{"email": "new@example.com", "password": "wrong"})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for wrong password, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login", "", map[string]string{"email": "nobody@example.com", "password": "wrong"})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for unknown email, got %d", res.StatusCode)
+	}
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	srv := newTestServer(t)
+
+	// SHA-1 of "correct horse battery staple"
+	breached := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breached, []byte("ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42:42\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := password.LoadBreachList(breached)
+	if err != nil {
+		t.Fatalf("LoadBreachList returned error: %v", err)
+	}
+	policy := password.PolicyFromEnv()
+	policy.Breaches = list
+	password.SetDefault(policy)
+	t.Cleanup(func() { password.SetDefault(password.PolicyFromEnv()) })
+
+	rejected := func(pw string) []string {
+		t.Helper()
+		res := doJSON(t, http.MethodPost, srv.URL+"/users/register", "",
+			map[string]string{"email": "newbie@example.com", "password": pw})
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%q: expected 400 Bad Request, got %d", pw, res.StatusCode)
+		}
+		var body struct {
+			Violations []password.Violation `json:"violations"`
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		var rules []string
+		for _, v := range body.Violations {
+			rules = append(rules, v.Rule)
+		}
+		return rules
+	}
+
+	if rules := rejected("abc123"); len(rules) != 2 || rules[0] != password.RuleMinLength || rules[1] != password.RuleEntropy {
+		t.Errorf("expected the length and entropy rules, got %v", rules)
+	}
+	if rules := rejected("Newbie@example.com!"); len(rules) != 1 || rules[0] != password.RuleEmail {
+		t.Errorf("expected the email rule, got %v", rules)
+	}
+	if rules := rejected("correct horse battery staple"); len(rules) != 1 || rules[0] != password.RuleBreached {
+		t.Errorf("expected the breached rule, got %v", rules)
+	}
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/register", "",
+		map[string]string{"email": "newbie@example.com", "password": "purple-Harbor-73"})
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201 Created for an acceptable password, got %d", res.StatusCode)
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodGet, srv.URL+"/users/me", "", nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized without token, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+	var me map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&me)
+	if me["email"] != "leon@gmail.com" {
+		t.Errorf("expected email leon@gmail.com, got %v", me["email"])
+	}
+	if _, ok := me["password"]; ok {
+		t.Errorf("password hash must not be returned")
+	}
+
+	res = doJSON(t, http.MethodPatch, srv.URL+"/users/me", token, map[string]string{"email": "youssef@hotmail.com"})
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for taken email, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPatch, srv.URL+"/users/me", token, map[string]string{"email": "leon@example.com"})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", res.StatusCode)
+	}
+	login(t, srv, "leon@example.com", "leon123")
+}
+
+func TestChangePassword(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/me/password", token,
+		map[string]string{"current_password": "wrong", "new_password": "blue-Otter-58"})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for wrong current password, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/me/password", token,
+		map[string]string{"current_password": "leon123", "new_password": "blue-Otter-58"})
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", res.StatusCode)
+	}
+
+	login(t, srv, "leon@gmail.com", "blue-Otter-58")
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodDelete, srv.URL+"/users/me", token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+
+	if tasks := models.GetTasks(1); len(tasks) != 0 {
+		t.Errorf("expected tasks of deleted user to be deleted, got %d", len(tasks))
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login", "", map[string]string{"email": "leon@gmail.com", "password": "leon123"})
+	if res.StatusCode == http.StatusOK {
+		t.Errorf("expected login of deleted user to fail")
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	srv := newTestServer(t)
+	first := loginPair(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+	var second tokenPair
+	json.NewDecoder(res.Body).Decode(&second)
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected a new refresh token on rotation")
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", second.Token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected refreshed access token to be accepted, got %d", res.StatusCode)
+	}
+
+	// Replaying the first token is reuse: the whole family is revoked
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized on reuse, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": second.RefreshToken})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for a token of a revoked family, got %d", res.StatusCode)
+	}
+
+	// The session goes with the family, including its last access token
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", second.Token, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for the access token of a reused family, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me/sessions", login(t, srv, "leon@gmail.com", "leon123"), nil)
+	var sessions []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&sessions)
+	if len(sessions) != 1 {
+		t.Errorf("expected only the new session to be listed, got %d", len(sessions))
+	}
+
+	// Other sessions of the same user are not affected
+	other := loginPair(t, srv, "leon@gmail.com", "leon123")
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": other.RefreshToken})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK for an unrelated session, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": "unknown"})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized for unknown token, got %d", res.StatusCode)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	srv := newTestServer(t)
+
+	// The laptop names itself, the phone is recognised from its User-Agent
+	loginFrom := func(header, value string) tokenPair {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/users/login",
+			strings.NewReader(`{"email": "leon@gmail.com", "password": "leon123"}`))
+		req.Header.Set(header, value)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		defer res.Body.Close()
+		var pair tokenPair
+		json.NewDecoder(res.Body).Decode(&pair)
+		return pair
+	}
+	laptop := loginFrom("X-Device-Name", "Work laptop")
+	phone := loginFrom("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Mobile/15E148 Safari/604.1")
+
+	res := doJSON(t, http.MethodGet, srv.URL+"/users/me/sessions", laptop.Token, nil)
+	var sessions []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected two sessions, got %v", sessions)
+	}
+	devices := map[string]map[string]interface{}{}
+	for _, s := range sessions {
+		devices[s["device_name"].(string)] = s
+	}
+	if devices["Work laptop"]["current"] != true || devices["Safari on iOS"]["current"] != false {
+		t.Fatalf("expected the laptop to be the current session, got %v", sessions)
+	}
+
+	// Activity is recorded in batches
+	seen := devices["Safari on iOS"]["last_seen_at"]
+	time.Sleep(10 * time.Millisecond)
+	doJSON(t, http.MethodGet, srv.URL+"/users/me", phone.Token, nil)
+	if _, err := models.FlushSessionActivity(); err != nil {
+		t.Fatalf("FlushSessionActivity returned error: %v", err)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me/sessions", laptop.Token, nil)
+	json.NewDecoder(res.Body).Decode(&sessions)
+	if sessions[0]["device_name"] != "Safari on iOS" || sessions[0]["last_seen_at"] == seen {
+		t.Errorf("expected the phone to be the most recently seen session, got %v", sessions)
+	}
+
+	// Revoking the phone signs it out, the laptop stays signed in
+	id, _ := devices["Safari on iOS"]["id"].(float64)
+	res = doJSON(t, http.MethodDelete, srv.URL+"/users/me/sessions/"+strconv.Itoa(int(id)), laptop.Token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK when revoking a session, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/users/me", phone.Token, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the revoked session's token to be rejected, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": phone.RefreshToken})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the revoked session's refresh token to be rejected, got %d", res.StatusCode)
+	}
+	if res := doJSON(t, http.MethodGet, srv.URL+"/users/me", laptop.Token, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("expected the other session to keep working, got %d", res.StatusCode)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	srv := newTestServer(t)
+	session := loginPair(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/logout", session.Token, map[string]string{"refresh_token": session.RefreshToken})
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", session.Token, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected revoked token to be rejected, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": session.RefreshToken})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected refresh token of logged out session to be rejected, got %d", res.StatusCode)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	srv := newTestServer(t)
+	first := loginPair(t, srv, "leon@gmail.com", "leon123")
+	second := loginPair(t, srv, "leon@gmail.com", "leon123")
+	otherUser := login(t, srv, "youssef@hotmail.com", "youssef123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/logout/all", first.Token, nil)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", res.StatusCode)
+	}
+
+	for _, token := range []string{first.Token, second.Token} {
+		res = doJSON(t, http.MethodGet, srv.URL+"/users/me", token, nil)
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected token to be revoked, got %d", res.StatusCode)
+		}
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/token/refresh", "", map[string]string{"refresh_token": second.RefreshToken})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected refresh token to be revoked, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", otherUser, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected other users to stay logged in, got %d", res.StatusCode)
+	}
+
+	fresh := login(t, srv, "leon@gmail.com", "leon123")
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", fresh, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected a new login to work after logging out everywhere, got %d", res.StatusCode)
+	}
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	srv := newTestServer(t)
+	session := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/me/tokens", session,
+		map[string]interface{}{"name": "ci", "scopes": []string{"tasks:read"}})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+	var created struct {
+		ID    uint   `json:"id"`
+		Token string `json:"token"`
+	}
+	json.NewDecoder(res.Body).Decode(&created)
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", created.Token, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK with tasks:read, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodPost, srv.URL+"/tasks", created.Token, map[string]string{"title": "t", "description": "d"})
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden without tasks:write, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", created.Token, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden without user:read, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me/tokens", session, nil)
+	var listed []map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0]["last_used_at"] == nil {
+		t.Errorf("expected one token with a last-used timestamp, got %v", listed)
+	}
+	if _, ok := listed[0]["token"]; ok {
+		t.Errorf("token value must not be listed")
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/me/tokens", session,
+		map[string]interface{}{"name": "bad", "scopes": []string{"everything"}})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for unknown scope, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodDelete, srv.URL+"/users/me/tokens/"+strconv.Itoa(int(created.ID)), session, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on revoke, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", created.Token, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected revoked token to be rejected, got %d", res.StatusCode)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	srv := newTestServer(t)
+	session := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/password/forgot", "", map[string]string{"email": "nobody@example.com"})
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 Accepted for unknown email, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/password/forgot", "", map[string]string{"email": "leon@gmail.com"})
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted, got %d", res.StatusCode)
+	}
+	token := awaitTokenInMail(t, "leon@gmail.com")
+	if msgs, _ := mailbox.Messages(); len(msgs) != 1 {
+		t.Errorf("expected no email for unknown account, got %d emails", len(msgs))
+	}
+
+	// Further requests for the same email have to wait, known or not
+	for _, email := range []string{"leon@gmail.com", "nobody@example.com"} {
+		res = doJSON(t, http.MethodPost, srv.URL+"/users/password/forgot", "", map[string]string{"email": email})
+		if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+			t.Errorf("%s: expected 429 Too Many Requests with Retry-After, got %d", email, res.StatusCode)
+		}
+	}
+
+	// A rejected password leaves the token usable
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/password/reset", "", map[string]string{"token": token, "new_password": "short"})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 Bad Request for a weak password, got %d", res.StatusCode)
+	}
+
+	reset := map[string]string{"token": token, "new_password": "blue-Otter-58"}
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/password/reset", "", reset)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/password/reset", "", reset)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected reset token to be single-use, got %d", res.StatusCode)
+	}
+
+	login(t, srv, "leon@gmail.com", "blue-Otter-58")
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", session, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected sessions from before the reset to be revoked, got %d", res.StatusCode)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	srv := newTestServer(t)
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "true")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/register", "",
+		map[string]interface{}{"email": "new@example.com", "password": "secret123", "email_verified": true})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+	session := login(t, srv, "new@example.com", "secret123")
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", session, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden for unverified account, got %d", res.StatusCode)
+	}
+
+	// Resending invalidates the first link
+	first := tokenInLastMail(t, "new@example.com")
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/verify/resend", session, nil)
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted on resend, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/verify?token="+first, "", nil)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected superseded token to be rejected, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/verify?token="+tokenInLastMail(t, "new@example.com"), "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on verification, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", session, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK once verified, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/verify/resend", session, nil)
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 Conflict when already verified, got %d", res.StatusCode)
+	}
+
+	// Changing the address requires verifying it again
+	res = doJSON(t, http.MethodPatch, srv.URL+"/users/me", session, map[string]string{"email": "renamed@example.com"})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+	res = doJSON(t, http.MethodGet, srv.URL+"/tasks", session, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden after changing email, got %d", res.StatusCode)
+	}
+	tokenInLastMail(t, "renamed@example.com")
+}
+
+func TestTOTPTwoFactorLogin(t *testing.T) {
+	srv := newTestServer(t)
+	session := login(t, srv, "leon@gmail.com", "leon123")
+
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/me/mfa/totp", session, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on enrollment, got %d", res.StatusCode)
+	}
+	var enrollment struct {
+		Secret     string `json:"secret"`
+		OTPAuthURL string `json:"otpauth_url"`
+	}
+	json.NewDecoder(res.Body).Decode(&enrollment)
+	if enrollment.Secret == "" || !strings.HasPrefix(enrollment.OTPAuthURL, "otpauth://totp/") {
+		t.Fatalf("unexpected enrollment response %+v", enrollment)
+	}
+
+	// Confirm with the code of the previous step, so the current one is still unused
+	previous, _ := totp.Code(enrollment.Secret, time.Now().Add(-totp.Period))
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/me/mfa/totp/confirm", session, map[string]string{"code": previous})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on confirmation, got %d", res.StatusCode)
+	}
+	var recovery struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(res.Body).Decode(&recovery)
+	if len(recovery.RecoveryCodes) == 0 {
+		t.Fatalf("expected recovery codes")
+	}
+
+	// The password alone no longer yields tokens
+	mfaToken := func() string {
+		res := doJSON(t, http.MethodPost, srv.URL+"/users/login", "",
+			map[string]string{"email": "leon@gmail.com", "password": "leon123"})
+		var body struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+			Token       string `json:"Token"`
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		if !body.MFARequired || body.MFAToken == "" || body.Token != "" {
+			t.Fatalf("expected an MFA challenge instead of tokens, got %+v", body)
+		}
+		return body.MFAToken
+	}
+
+	challenge := mfaToken()
+	res = doJSON(t, http.MethodGet, srv.URL+"/users/me", challenge, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the MFA token not to work as an access token, got %d", res.StatusCode)
+	}
+
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login/mfa", "",
+		map[string]string{"mfa_token": challenge, "code": "000000"})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected wrong code to be rejected, got %d", res.StatusCode)
+	}
+
+	code, _ := totp.Code(enrollment.Secret, time.Now())
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login/mfa", "",
+		map[string]string{"mfa_token": challenge, "code": code})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK with a valid code, got %d", res.StatusCode)
+	}
+
+	// A code cannot be replayed
+	res = doJSON(t, http.MethodPost, srv.URL+"/users/login/mfa", "",
+		map[string]string{"mfa_token": mfaToken(), "code": code})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected replayed code to be rejected, got %d", res.StatusCode)
+	}
+
+	// Recovery codes work once
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		res = doJSON(t, http.MethodPost, srv.URL+"/users/login/mfa", "",
+			map[string]string{"mfa_token": mfaToken(), "recovery_code": strings.ToUpper(recovery.RecoveryCodes[0])})
+		if res.StatusCode != want {
+			t.Errorf("recovery code use %d: expected %d, got %d", i+1, want, res.StatusCode)
+		}
+	}
+
+	res = doJSON(t, http.MethodDelete, srv.URL+"/users/me/mfa/totp", session,
+		map[string]string{"recovery_code": recovery.RecoveryCodes[1]})
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content when disabling, got %d", res.StatusCode)
+	}
+	login(t, srv, "leon@gmail.com", "leon123")
+}
+
+func TestLoginLockout(t *testing.T) {
+	srv := newTestServer(t)
+	t.Setenv("LOGIN_MAX_FAILURES", "3")
+	t.Setenv("LOGIN_DELAY_AFTER", "10")
+
+	wrong := map[string]string{"email": "leon@gmail.com", "password": "wrong"}
+	for i := 0; i < 3; i++ {
+		res := doJSON(t, http.MethodPost, srv.URL+"/users/login", "", wrong)
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401 Unauthorized, got %d", i+1, res.StatusCode)
+		}
+	}
+
+	// Even the right password is refused while locked
+	res := doJSON(t, http.MethodPost, srv.URL+"/users/login", "",
+		map[string]string{"email": "leon@gmail.com", "password": "leon123"})
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 Too Many Requests, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Errorf("expected a Retry-After header")
+	}
+
+	// Other accounts are not affected by this account's lockout
+	login(t, srv, "youssef@hotmail.com", "youssef123")
+
+	if !models.ResetLoginFailures(models.AccountThrottleKey("leon@gmail.com")) {
+		t.Fatalf("expected the account to be unlocked")
+	}
+	login(t, srv, "leon@gmail.com", "leon123")
+}
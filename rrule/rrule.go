@@ -0,0 +1,249 @@
+// Package rrule parses and expands a subset of RFC 5545 recurrence rules:
+// DAILY, WEEKLY (optionally BYDAY) and MONTHLY (optionally BYMONTHDAY)
+// frequencies with INTERVAL, COUNT and UNTIL. Weeks start on Monday.
+//
+// Occurrences keep the wall-clock time of the start in its location, so a
+// daily 09:00 task stays at 09:00 across daylight saving time changes.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a rule repeats.
+type Frequency string
+
+// Supported frequencies.
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// The accepted forms of UNTIL: a UTC date-time, or a date, which includes
+// the whole UTC day.
+const (
+	untilDateTime = "20060102T150405Z"
+	untilDate     = "20060102"
+)
+
+// maxPeriods bounds the search for the next occurrence, so that rules that
+// never match again (such as the 30th of every February) end.
+const maxPeriods = 1000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Rule is a parsed recurrence rule. Zero Count and Until do not limit it.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+}
+
+// Parse parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE". An
+// "RRULE:" prefix is allowed.
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return Rule{}, errors.New("empty recurrence rule")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly {
+				return Rule{}, fmt.Errorf("unsupported FREQ %q, use DAILY, WEEKLY or MONTHLY", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = positive("INTERVAL", value)
+		case "COUNT":
+			r.Count, err = positive("COUNT", value)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				wd, ok := weekdays[day]
+				if !ok {
+					return Rule{}, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, convErr := strconv.Atoi(day)
+				if convErr != nil || n == 0 || n < -31 || n > 31 {
+					return Rule{}, fmt.Errorf("invalid BYMONTHDAY %q", day)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		default:
+			return Rule{}, fmt.Errorf("unsupported rule part %s", key)
+		}
+		if err != nil {
+			return Rule{}, err
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return Rule{}, errors.New("FREQ is required")
+	case len(r.ByDay) > 0 && r.Freq != Weekly:
+		return Rule{}, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	case len(r.ByMonthDay) > 0 && r.Freq != Monthly:
+		return Rule{}, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	case r.Count > 0 && !r.Until.IsZero():
+		return Rule{}, errors.New("COUNT and UNTIL cannot be combined")
+	}
+	return r, nil
+}
+
+func positive(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return n, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(untilDateTime, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(untilDate, value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must look like %s or %s", untilDateTime, untilDate)
+}
+
+// String formats the rule in canonical form.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilDateTime))
+	}
+	return strings.Join(parts, ";")
+}
+
+// After returns up to n occurrences that follow from, which is occurrence
+// number occurrence (starting at 1) of the series, and is used as the start
+// of the rule. Occurrences are in from's location.
+func (r Rule) After(from time.Time, occurrence, n int) []time.Time {
+	var result []time.Time
+	for period := 0; period < maxPeriods && len(result) < n; period++ {
+		for _, t := range r.period(from, period) {
+			if !t.After(from) {
+				continue
+			}
+			if r.Count > 0 && occurrence+len(result) >= r.Count {
+				return result
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return result
+			}
+			result = append(result, t)
+			if len(result) == n {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+// period returns the candidate occurrences, in order, of the day, week or
+// month that is period intervals after the one containing start.
+func (r Rule) period(start time.Time, period int) []time.Time {
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	loc := start.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, start.Nanosecond(), loc)
+	}
+
+	switch r.Freq {
+	case Daily:
+		return []time.Time{at(y, m, d+period*r.Interval)}
+
+	case Weekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		monday := d - (int(start.Weekday())+6)%7 + period*r.Interval*7
+		var result []time.Time
+		for _, wd := range days {
+			result = append(result, at(y, m, monday+(int(wd)+6)%7))
+		}
+		return inOrder(result)
+
+	case Monthly:
+		first := time.Date(y, m+time.Month(period*r.Interval), 1, 0, 0, 0, 0, loc)
+		length := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, loc).Day()
+		days := r.ByMonthDay
+		if len(days) == 0 {
+			days = []int{d}
+		}
+		var result []time.Time
+		for _, day := range days {
+			if day < 0 {
+				day = length + day + 1
+			}
+			// Days the month does not have are skipped, as RFC 5545 requires
+			if day >= 1 && day <= length {
+				result = append(result, at(first.Year(), first.Month(), day))
+			}
+		}
+		return inOrder(result)
+	}
+	return nil
+}
+
+// inOrder sorts times and drops duplicates, such as BYMONTHDAY=31,-1 in a
+// month with 31 days.
+func inOrder(times []time.Time) []time.Time {
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	var result []time.Time
+	for _, t := range times {
+		if len(result) == 0 || !t.Equal(result[len(result)-1]) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
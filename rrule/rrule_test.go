@@ -0,0 +1,130 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string) Rule {
+	t.Helper()
+	r, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	return r
+}
+
+func formatAll(times []time.Time) []string {
+	out := make([]string, len(times))
+	for i, t := range times {
+		out[i] = t.Format("2006-01-02 Mon 15:04 MST")
+	}
+	return out
+}
+
+func expect(t *testing.T, name string, got []time.Time, want ...string) {
+	t.Helper()
+	g := formatAll(got)
+	if len(g) != len(want) {
+		t.Errorf("%s: expected %v, got %v", name, want, g)
+		return
+	}
+	for i := range g {
+		if g[i] != want[i] {
+			t.Errorf("%s: expected %v, got %v", name, want, g)
+			return
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	r := mustParse(t, "RRULE:freq=weekly;interval=2;byday=MO,WE;count=5")
+	if got := r.String(); got != "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=5" {
+		t.Errorf("unexpected canonical form %q", got)
+	}
+
+	for _, bad := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=3;UNTIL=20240101",
+		"FREQ=DAILY;BYHOUR=9",
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestDailyAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	start := time.Date(2024, 3, 30, 9, 0, 0, 0, berlin)
+	got := mustParse(t, "FREQ=DAILY").After(start, 1, 3)
+	expect(t, "daily", got,
+		"2024-03-31 Sun 09:00 CEST",
+		"2024-04-01 Mon 09:00 CEST",
+		"2024-04-02 Tue 09:00 CEST",
+	)
+	if d := got[0].Sub(start); d != 23*time.Hour {
+		t.Errorf("expected 23 hours across the DST change, got %s", d)
+	}
+}
+
+func TestWeekly(t *testing.T) {
+	// Wednesday 2024-01-03; every other week on Monday and Wednesday
+	start := time.Date(2024, 1, 3, 18, 30, 0, 0, time.UTC)
+	expect(t, "weekly", mustParse(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=WE,MO").After(start, 1, 4),
+		"2024-01-15 Mon 18:30 UTC",
+		"2024-01-17 Wed 18:30 UTC",
+		"2024-01-29 Mon 18:30 UTC",
+		"2024-01-31 Wed 18:30 UTC",
+	)
+	expect(t, "weekly without BYDAY", mustParse(t, "FREQ=WEEKLY").After(start, 1, 2),
+		"2024-01-10 Wed 18:30 UTC",
+		"2024-01-17 Wed 18:30 UTC",
+	)
+}
+
+func TestMonthly(t *testing.T) {
+	start := time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC)
+	expect(t, "31st", mustParse(t, "FREQ=MONTHLY").After(start, 1, 3),
+		"2024-03-31 Sun 08:00 UTC",
+		"2024-05-31 Fri 08:00 UTC",
+		"2024-07-31 Wed 08:00 UTC",
+	)
+	expect(t, "last day", mustParse(t, "FREQ=MONTHLY;BYMONTHDAY=-1").After(start, 1, 3),
+		"2024-02-29 Thu 08:00 UTC",
+		"2024-03-31 Sun 08:00 UTC",
+		"2024-04-30 Tue 08:00 UTC",
+	)
+	expect(t, "1st and 15th", mustParse(t, "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=15,1").After(start, 1, 3),
+		"2024-04-01 Mon 08:00 UTC",
+		"2024-04-15 Mon 08:00 UTC",
+		"2024-07-01 Mon 08:00 UTC",
+	)
+}
+
+func TestCountAndUntil(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	expect(t, "count", mustParse(t, "FREQ=DAILY;COUNT=3").After(start, 1, 10),
+		"2024-01-02 Tue 12:00 UTC",
+		"2024-01-03 Wed 12:00 UTC",
+	)
+	if got := mustParse(t, "FREQ=DAILY;COUNT=3").After(start, 3, 10); len(got) != 0 {
+		t.Errorf("expected no occurrences after the last one, got %v", formatAll(got))
+	}
+	expect(t, "until", mustParse(t, "FREQ=DAILY;UNTIL=20240103").After(start, 1, 10),
+		"2024-01-02 Tue 12:00 UTC",
+		"2024-01-03 Wed 12:00 UTC",
+	)
+	if got := mustParse(t, "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30").After(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), 1, 1); len(got) != 0 {
+		t.Errorf("expected a rule that never matches to end, got %v", formatAll(got))
+	}
+}
@@ -0,0 +1,286 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is one signing key of a KeySet. HS256 keys are shared secrets and are
+// never published; RS256 and EdDSA keys are published in the JWKS so other
+// services can verify tokens issued by this API.
+type Key struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	Private   string     `json:"private"` // base64 PKCS#8 DER, or the raw secret for HS256
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"` // no longer signs, still verifies until tokens expire
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet is the list of keys the Service signs and verifies with. Exactly one
+// key is active and signs new tokens; retired keys keep verifying the tokens
+// they signed until those have expired.
+type KeySet struct {
+	Active string `json:"active"`
+	Keys   []*Key `json:"keys"`
+}
+
+// GenerateKey creates a new random key for the given algorithm.
+func GenerateKey(alg string) (*Key, error) {
+	var der []byte
+	switch alg {
+	case AlgHS256:
+		der = make([]byte, 32)
+		if _, err := rand.Read(der); err != nil {
+			return nil, err
+		}
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		if der, err = x509.MarshalPKCS8PrivateKey(priv); err != nil {
+			return nil, err
+		}
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if der, err = x509.MarshalPKCS8PrivateKey(priv); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	key := &Key{
+		ID:        NewID()[:16],
+		Algorithm: alg,
+		Private:   base64.StdEncoding.EncodeToString(der),
+		CreatedAt: time.Now().UTC(),
+	}
+	return key, key.parse()
+}
+
+// secretKey wraps a shared HMAC secret, such as JWT_SECRET, as an HS256 key.
+func secretKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:        id,
+		Algorithm: AlgHS256,
+		Private:   base64.StdEncoding.EncodeToString(secret),
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// parse decodes Private into the keys used by the jwt signing methods.
+func (k *Key) parse() error {
+	der, err := base64.StdEncoding.DecodeString(k.Private)
+	if err != nil {
+		return fmt.Errorf("key %s: %w", k.ID, err)
+	}
+
+	if k.Algorithm == AlgHS256 {
+		k.signKey, k.verifyKey = der, der
+		return nil
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return fmt.Errorf("key %s: %w", k.ID, err)
+	}
+	switch p := priv.(type) {
+	case *rsa.PrivateKey:
+		if k.Algorithm != AlgRS256 {
+			return fmt.Errorf("key %s: RSA key cannot be used for %s", k.ID, k.Algorithm)
+		}
+		k.signKey, k.verifyKey = p, &p.PublicKey
+	case ed25519.PrivateKey:
+		if k.Algorithm != AlgEdDSA {
+			return fmt.Errorf("key %s: Ed25519 key cannot be used for %s", k.ID, k.Algorithm)
+		}
+		k.signKey, k.verifyKey = p, p.Public()
+	default:
+		return fmt.Errorf("key %s: unsupported private key type %T", k.ID, priv)
+	}
+	return nil
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// LoadKeySet reads a key set written by Save.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ks KeySet
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for _, k := range ks.Keys {
+		if err := k.parse(); err != nil {
+			return nil, err
+		}
+	}
+	if ks.active() == nil {
+		return nil, fmt.Errorf("%s: active key %q not found", path, ks.Active)
+	}
+	return &ks, nil
+}
+
+// Save writes the key set to path, readable by the owner only.
+func (ks *KeySet) Save(path string) error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Rotate adds a new key for alg and makes it the active one. The previously
+// active key is retired: it stops signing but keeps verifying.
+func (ks *KeySet) Rotate(alg string) (*Key, error) {
+	key, err := GenerateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	if current := ks.active(); current != nil {
+		retiredAt := key.CreatedAt
+		current.RetiredAt = &retiredAt
+	}
+	ks.Keys = append(ks.Keys, key)
+	ks.Active = key.ID
+	return key, nil
+}
+
+// Prune removes keys that were retired more than maxAge ago; no unexpired
+// token can have been signed with them. It returns the removed key IDs.
+func (ks *KeySet) Prune(now time.Time, maxAge time.Duration) []string {
+	var removed []string
+	kept := ks.Keys[:0]
+	for _, k := range ks.Keys {
+		if k.expired(now, maxAge) {
+			removed = append(removed, k.ID)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	ks.Keys = kept
+	return removed
+}
+
+func (ks *KeySet) active() *Key {
+	return ks.find(ks.Active)
+}
+
+func (ks *KeySet) find(kid string) *Key {
+	for _, k := range ks.Keys {
+		if k.ID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+func (k *Key) expired(now time.Time, maxAge time.Duration) bool {
+	return k.RetiredAt != nil && now.After(k.RetiredAt.Add(maxAge))
+}
+
+// JWK is the public part of a key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. HS256 keys are secret and skipped.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range ks.Keys {
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     k.ID,
+				Algorithm: k.Algorithm,
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     k.ID,
+				Algorithm: k.Algorithm,
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+// PublicKey decodes the public key of an RSA or Ed25519 JWK.
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
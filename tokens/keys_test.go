@@ -0,0 +1,171 @@
+package tokens
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func keySetConfig(t *testing.T, alg string) Config {
+	t.Helper()
+	keys := &KeySet{}
+	if _, err := keys.Rotate(alg); err != nil {
+		t.Fatalf("Rotate(%s) returned error: %v", alg, err)
+	}
+	cfg := testConfig()
+	cfg.Secret = nil
+	cfg.Keys = keys
+	return cfg
+}
+
+func TestAsymmetricAlgorithms(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		cfg := keySetConfig(t, alg)
+		s := NewService(cfg)
+
+		signed, _, err := s.Issue(7, "leon@gmail.com")
+		if err != nil {
+			t.Fatalf("%s: Issue returned error: %v", alg, err)
+		}
+		if _, err := s.Parse(signed); err != nil {
+			t.Errorf("%s: Parse returned error: %v", alg, err)
+		}
+
+		// Another service can verify the token with the published JWKS alone
+		jwks := s.JWKS()
+		if len(jwks.Keys) != 1 || jwks.Keys[0].Algorithm != alg {
+			t.Fatalf("%s: expected one published key, got %+v", alg, jwks.Keys)
+		}
+		_, err = jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+			return jwks.Keys[0].PublicKey()
+		}, jwt.WithValidMethods([]string{alg}))
+		if err != nil {
+			t.Errorf("%s: verifying with the JWKS failed: %v", alg, err)
+		}
+	}
+}
+
+func TestHMACKeysAreNotPublished(t *testing.T) {
+	s := NewService(keySetConfig(t, AlgHS256))
+	if n := len(s.JWKS().Keys); n != 0 {
+		t.Errorf("expected HS256 keys to stay secret, got %d published", n)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	cfg := keySetConfig(t, AlgRS256)
+	s := NewService(cfg)
+	oldToken, _, _ := s.Issue(1, "leon@gmail.com")
+
+	if _, err := cfg.Keys.Rotate(AlgEdDSA); err != nil {
+		t.Fatalf("Rotate returned error: %v", err)
+	}
+	newToken, _, _ := s.Issue(1, "leon@gmail.com")
+
+	header, _, _ := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if header.Method.Alg() != AlgEdDSA {
+		t.Errorf("expected new tokens to be signed with the new key, got %s", header.Method.Alg())
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := s.Parse(token); err != nil {
+			t.Errorf("expected %s token to stay valid after rotation, got %v", name, err)
+		}
+	}
+
+	// Once the retired key is pruned, its tokens are rejected
+	removed := cfg.Keys.Prune(time.Now().Add(2*time.Hour), s.MaxAge())
+	if len(removed) != 1 {
+		t.Fatalf("expected the retired key to be pruned, got %v", removed)
+	}
+	if _, err := s.Parse(oldToken); err == nil {
+		t.Errorf("expected token of a pruned key to be rejected")
+	}
+}
+
+func TestKeySetSaveAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := &KeySet{}
+	keys.Rotate(AlgRS256)
+	if err := keys.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	loaded, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+	cfg := testConfig()
+	cfg.Secret = nil
+	cfg.Keys = loaded
+	cfg.KeysFile = path
+	s := NewService(cfg)
+	oldToken, _, _ := s.Issue(1, "leon@gmail.com")
+
+	// Rotate the file as the keys command does; the service picks it up
+	time.Sleep(10 * time.Millisecond)
+	loaded.Rotate(AlgEdDSA)
+	if err := loaded.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if err := s.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys returned error: %v", err)
+	}
+
+	if n := len(s.JWKS().Keys); n != 2 {
+		t.Errorf("expected both keys after reload, got %d", n)
+	}
+	if _, err := s.Parse(oldToken); err != nil {
+		t.Errorf("expected token of the retired key to stay valid, got %v", err)
+	}
+}
+
+func TestLegacyTokensWithoutKid(t *testing.T) {
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "1",
+		Issuer:    "test-issuer",
+		Audience:  jwt.ClaimStrings{"test-audience"},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		ID:        "legacy",
+	}})
+	signed, _ := legacy.SignedString([]byte("test-secret"))
+
+	cfg := keySetConfig(t, AlgRS256)
+	cfg.Secret = []byte("test-secret")
+	if _, err := NewService(cfg).Parse(signed); err != nil {
+		t.Errorf("expected token without kid to verify with the legacy secret, got %v", err)
+	}
+
+	cfg.Secret = nil
+	if _, err := NewService(cfg).Parse(signed); err == nil {
+		t.Errorf("expected token without kid to be rejected without a legacy secret")
+	}
+}
+
+func TestMigrationFromSecretToKeySet(t *testing.T) {
+	// Tokens issued while JWT_SECRET was the only key carry its kid
+	before := NewService(testConfig())
+	issued, _, err := before.Issue(1, "leon@gmail.com")
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+
+	cfg := keySetConfig(t, AlgEdDSA)
+	cfg.Secret = []byte("test-secret")
+	after := NewService(cfg)
+	if _, err := after.Parse(issued); err != nil {
+		t.Errorf("expected token of the secret to stay valid after switching to a key set, got %v", err)
+	}
+	fresh, _, _ := after.Issue(1, "leon@gmail.com")
+	if _, err := after.Parse(fresh); err != nil {
+		t.Errorf("expected token of the key set to verify, got %v", err)
+	}
+
+	cfg.Secret = nil
+	if _, err := NewService(cfg).Parse(issued); err == nil {
+		t.Errorf("expected token of the secret to be rejected once the secret is removed")
+	}
+}
@@ -0,0 +1,26 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewOpaqueToken returns a random, URL-safe token for the client and the
+// hash of it to persist. Only the hash is ever stored server side.
+func NewOpaqueToken() (plain, hash string) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	plain = base64.RawURLEncoding.EncodeToString(b)
+	return plain, HashOpaqueToken(plain)
+}
+
+// HashOpaqueToken returns the hex-encoded SHA-256 of an opaque token. The
+// tokens carry 256 bits of entropy, so a fast hash is sufficient.
+func HashOpaqueToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
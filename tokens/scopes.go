@@ -0,0 +1,63 @@
+package tokens
+
+// Scopes restrict what a token may do. Session tokens from Login carry no
+// scopes and may do everything their user may do.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+	ScopeUserRead   = "user:read"
+	ScopeUserWrite  = "user:write"
+)
+
+// AllScopes lists every scope a token can be granted.
+var AllScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeUserRead, ScopeUserWrite}
+
+// OAuthScopes lists the scopes third-party OAuth clients may request.
+var OAuthScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeUserRead}
+
+// PersonalAccessTokenPrefix starts every personal access token, which lets
+// AuthMiddleware tell them apart from JWTs without parsing.
+const PersonalAccessTokenPrefix = "todo_pat_"
+
+// ValidScope reports whether scope is one of AllScopes.
+func ValidScope(scope string) bool {
+	return contains(AllScopes, scope)
+}
+
+// ValidOAuthScope reports whether scope is one of OAuthScopes.
+func ValidOAuthScope(scope string) bool {
+	return contains(OAuthScopes, scope)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token may be used for scope. A token without
+// any scopes is unrestricted.
+func (c *Claims) HasScope(scope string) bool {
+	if c.Scopes == nil {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOAuthToken reports whether the token was issued to an OAuth client.
+func (c *Claims) IsOAuthToken() bool {
+	return c.ClientID != ""
+}
+
+// IsPersonalAccessToken reports whether the claims come from a personal access token.
+func (c *Claims) IsPersonalAccessToken() bool {
+	return c.PersonalAccessTokenID != 0
+}
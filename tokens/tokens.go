@@ -0,0 +1,397 @@
+// Package tokens owns issuance and verification of the API's JWT access
+// tokens: signing keys and their rotation, claim schema, validation rules
+// and clock skew.
+// handlers.Login issues tokens through it and middleware.AuthMiddleware
+// verifies them through it, so both sides always agree.
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joho/godotenv"
+)
+
+// ErrInvalidToken is returned by Parse for any token that fails validation.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+func init() {
+	// Issue times are compared with logout-all revocations, which can happen
+	// in the same second as a later login
+	jwt.TimePrecision = time.Microsecond
+}
+
+// Claims is the claim schema of every access token issued by this API.
+type Claims struct {
+	Email  string   `json:"email,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+	// ClientID is the OAuth client the token was issued to, if any.
+	ClientID string `json:"client_id,omitempty"`
+	// SessionID identifies the login session the token belongs to, if any.
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+
+	// PersonalAccessTokenID is set by AuthMiddleware when the request was
+	// authenticated with a personal access token instead of a JWT.
+	PersonalAccessTokenID uint `json:"-"`
+}
+
+// UserID returns the user ID carried in the "sub" claim.
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("invalid user ID in token")
+	}
+	return uint(id), nil
+}
+
+// Config holds the settings of a token Service.
+type Config struct {
+	Secret   []byte        // legacy HS256 secret, used when there is no key set
+	Issuer   string        // "iss" claim, checked on verification
+	Audience string        // "aud" claim, checked on verification
+	TTL      time.Duration // lifetime of issued access tokens
+	Leeway   time.Duration // allowed clock skew when checking exp, nbf and iat
+
+	// RefreshTTL is the lifetime of opaque refresh tokens
+	RefreshTTL time.Duration
+
+	// Keys are the signing keys identified by kid. KeysFile is where they
+	// were loaded from, so that rotations can be picked up by ReloadKeys.
+	Keys     *KeySet
+	KeysFile string
+}
+
+// ConfigFromEnv reads the token configuration from the environment (and .env).
+func ConfigFromEnv() Config {
+	_ = godotenv.Load()
+	return Config{
+		Secret:   []byte(os.Getenv("JWT_SECRET")),
+		Issuer:   envOr("JWT_ISSUER", "go-todo-list"),
+		Audience: envOr("JWT_AUDIENCE", "go-todo-list"),
+		TTL:      envDuration("JWT_TTL", 15*time.Minute),
+		Leeway:   envDuration("JWT_LEEWAY", 30*time.Second),
+
+		RefreshTTL: envDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+
+		KeysFile: os.Getenv("JWT_KEYS_FILE"),
+	}
+}
+
+// Service signs and verifies access tokens.
+type Service struct {
+	cfg Config
+	now func() time.Time
+
+	mu           sync.RWMutex
+	keys         *KeySet
+	keysModTime  time.Time
+	legacySecret *Key
+}
+
+// legacyKeyID is the kid of tokens signed with cfg.Secret when there is no
+// key set.
+const legacyKeyID = "default"
+
+// NewService creates a Service from cfg. Without a key set, cfg.Secret is
+// used as the only, HS256, signing key. With a key set, cfg.Secret only
+// verifies tokens issued before the key set was introduced, with or without
+// a kid.
+func NewService(cfg Config) *Service {
+	s := &Service{cfg: cfg, now: time.Now, keys: cfg.Keys}
+	if len(cfg.Secret) > 0 {
+		s.legacySecret = secretKey("", cfg.Secret)
+		if s.keys == nil {
+			s.keys = &KeySet{Active: legacyKeyID, Keys: []*Key{secretKey(legacyKeyID, cfg.Secret)}}
+		}
+	}
+	if s.keys == nil {
+		s.keys = &KeySet{}
+	}
+	if cfg.KeysFile != "" {
+		if info, err := os.Stat(cfg.KeysFile); err == nil {
+			s.keysModTime = info.ModTime()
+		}
+	}
+	return s
+}
+
+// ReloadKeys re-reads the key file if it changed since it was last loaded,
+// so that keys added by a rotation are used without a restart.
+func (s *Service) ReloadKeys() error {
+	if s.cfg.KeysFile == "" {
+		return nil
+	}
+	info, err := os.Stat(s.cfg.KeysFile)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.keysModTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	keys, err := LoadKeySet(s.cfg.KeysFile)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.keysModTime = info.ModTime()
+	s.mu.Unlock()
+	return nil
+}
+
+// JWKS returns the public signing keys, for other services to verify tokens.
+func (s *Service) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys.JWKS()
+}
+
+// TTL returns the lifetime of issued access tokens.
+func (s *Service) TTL() time.Duration {
+	return s.cfg.TTL
+}
+
+// MaxAge returns how long after issuance a token may still be accepted,
+// i.e. its lifetime plus the allowed clock skew.
+func (s *Service) MaxAge() time.Duration {
+	return s.cfg.TTL + s.cfg.Leeway
+}
+
+// RefreshTTL returns the lifetime of refresh tokens.
+func (s *Service) RefreshTTL() time.Duration {
+	return s.cfg.RefreshTTL
+}
+
+// Issue signs a new access token for the given user and returns it together with its claims.
+func (s *Service) Issue(userID uint, email string) (string, *Claims, error) {
+	return s.issue(userID, &Claims{Email: email})
+}
+
+// IssueSession signs an access token like Issue that belongs to the login
+// session sessionID, so that revoking the session revokes the token.
+func (s *Service) IssueSession(userID uint, email, sessionID string) (string, *Claims, error) {
+	return s.issue(userID, &Claims{Email: email, SessionID: sessionID})
+}
+
+// IssueScoped signs an access token restricted to scopes, like Issue. A nil
+// scopes slice means unrestricted. clientID names the OAuth client the token
+// is issued to, if any.
+func (s *Service) IssueScoped(userID uint, email string, scopes []string, clientID string) (string, *Claims, error) {
+	// An empty scope list would be dropped from the JWT and read back as unrestricted
+	if scopes != nil && len(scopes) == 0 {
+		return "", nil, errors.New("a scoped token needs at least one scope")
+	}
+	return s.issue(userID, &Claims{Email: email, Scopes: scopes, ClientID: clientID})
+}
+
+// issue fills in the registered claims of claims for userID and signs them.
+func (s *Service) issue(userID uint, claims *Claims) (string, *Claims, error) {
+	now := s.now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Issuer:    s.cfg.Issuer,
+		Audience:  jwt.ClaimStrings{s.cfg.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.TTL)),
+		ID:        NewID(),
+	}
+
+	signed, err := s.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// sign signs claims with the active key and names it in the kid header.
+func (s *Service) sign(claims *Claims) (string, error) {
+	s.mu.RLock()
+	key := s.keys.active()
+	s.mu.RUnlock()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", fmt.Errorf("signing token: %w", err)
+	}
+	return signed, nil
+}
+
+// Parse verifies the signature and claims of an access token and returns its claims.
+func (s *Service) Parse(tokenStr string) (*Claims, error) {
+	return s.parse(tokenStr, s.cfg.Audience)
+}
+
+// parse verifies tokenStr, which must have been issued for audience.
+func (s *Service) parse(tokenStr, audience string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims,
+		s.verificationKey,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}),
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(s.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// verificationKey picks the key matching the token's kid header. Tokens
+// without a kid, or with the kid of the secret when the key set does not
+// have it, were issued before the key set and verify with cfg.Secret.
+func (s *Service) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var key *Key
+	if kid != "" {
+		s.mu.RLock()
+		key = s.keys.find(kid)
+		s.mu.RUnlock()
+	}
+
+	if key == nil && (kid == "" || kid == legacyKeyID) {
+		if s.legacySecret != nil && token.Method.Alg() == AlgHS256 {
+			return s.legacySecret.verifyKey, nil
+		}
+		if kid == "" {
+			return nil, errors.New("missing kid")
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if key.Algorithm != token.Method.Alg() {
+		return nil, fmt.Errorf("kid %q does not sign with %s", kid, token.Method.Alg())
+	}
+	if key.expired(s.now(), s.MaxAge()) {
+		return nil, fmt.Errorf("kid %q is retired", kid)
+	}
+	return key.verifyKey, nil
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultService *Service
+)
+
+// Default returns the process-wide Service, configured from the environment on first use.
+func Default() *Service {
+	defaultOnce.Do(func() {
+		if defaultService != nil {
+			return
+		}
+		cfg := ConfigFromEnv()
+		if cfg.KeysFile != "" {
+			keys, err := LoadKeySet(cfg.KeysFile)
+			if err != nil {
+				log.Fatalf("Failed to load JWT keys: %v", err)
+			}
+			cfg.Keys = keys
+		}
+		if len(cfg.Secret) == 0 && cfg.Keys == nil {
+			log.Fatal("Secret Key cannot be empty")
+		}
+		defaultService = NewService(cfg)
+	})
+	return defaultService
+}
+
+// SetDefault replaces the process-wide Service, e.g. in tests.
+func SetDefault(s *Service) {
+	defaultOnce.Do(func() {})
+	defaultService = s
+}
+
+// WatchKeys periodically reloads the default Service's key file until ctx is cancelled.
+func WatchKeys(ctx context.Context, interval time.Duration) {
+	s := Default()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.ReloadKeys(); err != nil {
+					slog.Error("Failed to reload JWT keys", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the verified claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the verified claims stored by AuthMiddleware, if any.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// NewID returns a random 128-bit hex identifier, used for jti claims and token families.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,153 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testConfig() Config {
+	return Config{
+		Secret:   []byte("test-secret"),
+		Issuer:   "test-issuer",
+		Audience: "test-audience",
+		TTL:      time.Hour,
+		Leeway:   30 * time.Second,
+	}
+}
+
+func TestIssueAndParse(t *testing.T) {
+	s := NewService(testConfig())
+
+	signed, issued, err := s.Issue(42, "leon@gmail.com")
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+
+	claims, err := s.Parse(signed)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	userID, err := claims.UserID()
+	if err != nil || userID != 42 {
+		t.Errorf("expected user ID 42, got %d (%v)", userID, err)
+	}
+	if claims.Email != "leon@gmail.com" {
+		t.Errorf("expected email leon@gmail.com, got %q", claims.Email)
+	}
+	if claims.ID == "" || claims.ID != issued.ID {
+		t.Errorf("expected jti %q, got %q", issued.ID, claims.ID)
+	}
+	if claims.Issuer != "test-issuer" {
+		t.Errorf("expected issuer test-issuer, got %q", claims.Issuer)
+	}
+}
+
+func TestParseRejectsInvalidTokens(t *testing.T) {
+	s := NewService(testConfig())
+	signed, _, _ := s.Issue(1, "leon@gmail.com")
+
+	otherSecret := testConfig()
+	otherSecret.Secret = []byte("other-secret")
+
+	otherIssuer := testConfig()
+	otherIssuer.Issuer = "someone-else"
+
+	otherAudience := testConfig()
+	otherAudience.Audience = "another-service"
+
+	for name, cfg := range map[string]Config{
+		"wrong secret":   otherSecret,
+		"wrong issuer":   otherIssuer,
+		"wrong audience": otherAudience,
+	} {
+		if _, err := NewService(cfg).Parse(signed); err == nil {
+			t.Errorf("%s: expected token to be rejected", name)
+		}
+	}
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "1"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := s.Parse(unsigned); err == nil {
+		t.Errorf("expected unsigned token to be rejected")
+	}
+
+	if _, err := s.Parse("not-a-jwt"); err == nil {
+		t.Errorf("expected garbage to be rejected")
+	}
+}
+
+func TestParseClockSkew(t *testing.T) {
+	s := NewService(testConfig())
+	issuedAt := time.Now()
+	s.now = func() time.Time { return issuedAt }
+	signed, _, _ := s.Issue(1, "leon@gmail.com")
+
+	// Just past expiry but within the leeway
+	s.now = func() time.Time { return issuedAt.Add(time.Hour + 10*time.Second) }
+	if _, err := s.Parse(signed); err != nil {
+		t.Errorf("expected token within leeway to be accepted, got %v", err)
+	}
+
+	// Beyond the leeway
+	s.now = func() time.Time { return issuedAt.Add(time.Hour + time.Minute) }
+	if _, err := s.Parse(signed); err == nil {
+		t.Errorf("expected expired token to be rejected")
+	}
+
+	// Issued slightly in the future, e.g. by a server with a fast clock
+	s.now = func() time.Time { return issuedAt.Add(-10 * time.Second) }
+	if _, err := s.Parse(signed); err != nil {
+		t.Errorf("expected token issued within leeway in the future to be accepted, got %v", err)
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	session := &Claims{}
+	if !session.HasScope(ScopeTasksWrite) {
+		t.Errorf("expected a token without scopes to be unrestricted")
+	}
+
+	readOnly := &Claims{Scopes: []string{ScopeTasksRead}}
+	if !readOnly.HasScope(ScopeTasksRead) {
+		t.Errorf("expected tasks:read to be granted")
+	}
+	if readOnly.HasScope(ScopeTasksWrite) {
+		t.Errorf("expected tasks:write not to be granted")
+	}
+	if readOnly.HasScope(ScopeUserRead) {
+		t.Errorf("expected user:read not to be granted")
+	}
+
+	if ValidScope("tasks:admin") {
+		t.Errorf("expected unknown scope to be invalid")
+	}
+}
+
+func TestChallengeTokens(t *testing.T) {
+	s := NewService(testConfig())
+
+	challenge, err := s.IssueChallenge(5, ChallengeMFA, time.Minute)
+	if err != nil {
+		t.Fatalf("IssueChallenge returned error: %v", err)
+	}
+
+	userID, err := s.ParseChallenge(challenge, ChallengeMFA)
+	if err != nil || userID != 5 {
+		t.Errorf("expected challenge for user 5, got %d (%v)", userID, err)
+	}
+
+	if _, err := s.Parse(challenge); err == nil {
+		t.Errorf("a challenge token must not be accepted as an access token")
+	}
+	if _, err := s.ParseChallenge(challenge, "other"); err == nil {
+		t.Errorf("a challenge token must not be accepted for another purpose")
+	}
+
+	access, _, _ := s.Issue(5, "leon@gmail.com")
+	if _, err := s.ParseChallenge(access, ChallengeMFA); err == nil {
+		t.Errorf("an access token must not be accepted as a challenge")
+	}
+}
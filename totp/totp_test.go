@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits.
+func TestCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := Code(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("Code returned error: %v", err)
+		}
+		if got != want {
+			t.Errorf("at %d: expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret returned error: %v", err)
+	}
+	now := time.Now()
+	code, _ := Code(secret, now)
+
+	step, ok := Validate(secret, code, now)
+	if !ok || step != Step(now) {
+		t.Errorf("expected current code to validate at step %d, got %d (%v)", Step(now), step, ok)
+	}
+
+	if _, ok := Validate(secret, code, now.Add(Period)); !ok {
+		t.Errorf("expected code of the previous step to be accepted")
+	}
+	if _, ok := Validate(secret, code, now.Add(3*Period)); ok {
+		t.Errorf("expected code outside the skew window to be rejected")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Errorf("expected short code to be rejected")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Todo List", "leon@gmail.com", "ABCDEF")
+	if !strings.HasPrefix(uri, "otpauth://totp/Todo%20List:leon@gmail.com?") {
+		t.Errorf("unexpected URI label: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=ABCDEF") || !strings.Contains(uri, "issuer=Todo+List") {
+		t.Errorf("expected secret and issuer parameters: %s", uri)
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Env returns the environment variable key, or fallback when it is unset.
+func Env(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// EnvDuration parses the environment variable key as a time.Duration, or
+// returns fallback when it is unset or invalid.
+func EnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
+// EnvInt parses the environment variable key as an int, or returns fallback
+// when it is unset or invalid.
+func EnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+// EnvBool parses the environment variable key as a bool, or returns fallback
+// when it is unset or invalid.
+func EnvBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %t", key, v, fallback)
+		return fallback
+	}
+	return b
+}
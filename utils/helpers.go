@@ -1,29 +1,18 @@
 package utils
 import(
 	"errors"
-	"strconv"
 	"net/http"
-	"github.com/youssef-abbih/go-todo-list/middleware"
+	"github.com/youssef-abbih/go-todo-list/tokens"
 )
 func GetUserID(r *http.Request) (uint, error) {
-	// 1. Extract user ID from context
-	userIDVal := r.Context().Value(middleware.UserContextKey)
-	if userIDVal == nil {
-		return 0, errors.New("user not authorized")
-	}
-
-	userIDStr, ok := userIDVal.(string)
+	// 1. Extract the verified claims from context
+	claims, ok := tokens.FromContext(r.Context())
 	if !ok {
-		return 0, errors.New("invalid user ID type")
-	}
-
-	// 2. Convert string to uint
-	userIDInt, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		return 0, err
+		return 0, errors.New("user not authorized")
 	}
 
-	return uint(userIDInt), nil
+	// 2. Read the user ID from the "sub" claim
+	return claims.UserID()
 }
 
 // parseID extracts the task ID from the URL path